@@ -1,12 +1,14 @@
 package main
 
 import (
-	//"context"
+	"context"
+	"net/http"
 	"os"
 	"time"
 
 	"github.com/spf13/pflag"
 	kubeinformers "k8s.io/client-go/informers"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog"
 
@@ -15,11 +17,17 @@ import (
 	"github.com/garvinmsft/auto-private-link/pkg/azure"
 	"github.com/garvinmsft/auto-private-link/pkg/config"
 	"github.com/garvinmsft/auto-private-link/pkg/controller/connection"
+	"github.com/garvinmsft/auto-private-link/pkg/controller/gc"
+	"github.com/garvinmsft/auto-private-link/pkg/controller/policy"
 	"github.com/garvinmsft/auto-private-link/pkg/controller/service"
 	clientset "github.com/garvinmsft/auto-private-link/pkg/generated/clientset/versioned"
 	informers "github.com/garvinmsft/auto-private-link/pkg/generated/informers/externalversions"
+	"github.com/garvinmsft/auto-private-link/pkg/health"
 	"github.com/garvinmsft/auto-private-link/pkg/k8scontext"
+	"github.com/garvinmsft/auto-private-link/pkg/metrics"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	"k8s.io/sample-controller/pkg/signals"
 )
 
@@ -69,6 +77,7 @@ func main() {
 
 	serviceInformer := kubeInformerFactory.Core().V1().Services()
 	aplInformer := aplInformerFactory.Apl().V1alpha1().ServiceConnections()
+	policyInformer := aplInformerFactory.Apl().V1alpha1().PrivateLinkConnectionPolicies()
 
 	cfg, err := config.NewConfigFromEnv();
 	if err != nil {
@@ -82,19 +91,92 @@ func main() {
 	}
 
 	stopCh := signals.SetupSignalHandler()
-	
+
 	//maybe build 2 separate binaries?
 	svcController:= service.New(kubeClient, serviceInformer, cfg, azCtx)
 	connController := connection.New(aplClient, kubeClient, aplInformer, serviceInformer, cfg, azCtx, recorder)
+	policyController := policy.New(aplClient, policyInformer, aplInformer, serviceInformer, cfg, azCtx, recorder)
+	collector := gc.New(serviceInformer, aplInformer, cfg, azCtx)
+	checker := health.New(azCtx, cfg.ArmHealthMaxAge, svcController.HasSynced, connController.HasSynced, policyController.HasSynced)
+
+	//Every replica serves metrics and probes, not just the leader
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+
+	go func() {
+		if err := http.ListenAndServe(cfg.MetricsAddress, mux); err != nil {
+			klog.Fatal("Error serving metrics:", err)
+		}
+	}()
+
+	go func() {
+		if err := http.ListenAndServe(cfg.HealthAddress, checker.Handler(cfg.EnablePprof)); err != nil {
+			klog.Fatal("Error serving health checks:", err)
+		}
+	}()
 
+	//Informers run on every replica so a new leader starts with a warm cache
 	kubeInformerFactory.Start(stopCh)
 	aplInformerFactory.Start(stopCh)
-	
-	svcController.Run(stopCh, 1)
-	connController.Run(stopCh, 1)
 
-	klog.Info("Starting Services and connection controllers")
-	<-stopCh
+	run := func(stopCh <-chan struct{}) {
+		svcController.Run(stopCh, 1)
+		connController.Run(stopCh, 1)
+		policyController.Run(stopCh, 1)
+		collector.Run(stopCh)
+
+		klog.Info("Starting Services and connection controllers")
+		<-stopCh
+	}
+
+	if !cfg.LeaderElection() {
+		run(stopCh)
+		klog.Info("Stopped controllers - Hope this is not a surprise")
+		return
+	}
 
-	klog.Info("Stopped controllers - Hope this is not a surprise")
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta: metav1.ObjectMeta{
+				Name:      cfg.LeaseName,
+				Namespace: cfg.PodNamespace,
+			},
+			Client: kubeClient.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{
+				Identity:      cfg.PodName,
+				EventRecorder: recorder,
+			},
+		},
+		LeaseDuration:   cfg.LeaseDuration,
+		RenewDeadline:   cfg.RenewDeadline,
+		RetryPeriod:     cfg.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            component,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				klog.Infof("%v acquired lease %v/%v", cfg.PodName, cfg.PodNamespace, cfg.LeaseName)
+				run(ctx.Done())
+			},
+			OnStoppedLeading: func() {
+				select {
+				case <-stopCh:
+					klog.Info("Stopped controllers - Hope this is not a surprise")
+				default:
+					//Workers may still be running, restart to rejoin the election with a clean slate
+					klog.Fatalf("%v lost lease %v/%v", cfg.PodName, cfg.PodNamespace, cfg.LeaseName)
+				}
+			},
+			OnNewLeader: func(identity string) {
+				if identity != cfg.PodName {
+					klog.Infof("%v is the leader", identity)
+				}
+			},
+		},
+	})
 }
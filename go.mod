@@ -3,9 +3,10 @@ module github.com/garvinmsft/auto-private-link
 go 1.15
 
 require (
-	github.com/Azure/azure-sdk-for-go v43.2.0+incompatible
-	github.com/Azure/go-autorest/autorest v0.9.6 // indirect; indirect
-	github.com/Azure/go-autorest/autorest/azure/auth v0.4.2
+	github.com/Azure/azure-sdk-for-go v59.3.0+incompatible
+	github.com/Azure/go-autorest/autorest v0.11.29
+	github.com/Azure/go-autorest/autorest/adal v0.9.23
+	github.com/Azure/go-autorest/autorest/azure/auth v0.5.12
 	github.com/Azure/go-autorest/autorest/to v0.3.0
 	github.com/Azure/go-autorest/autorest/validation v0.2.0 // indirect
 	github.com/fsnotify/fsnotify v1.4.9 // indirect
@@ -13,8 +14,8 @@ require (
 	github.com/google/go-cmp v0.4.0 // indirect
 	github.com/googleapis/gnostic v0.4.0 // indirect
 	github.com/kr/pretty v0.2.0 // indirect
+	github.com/prometheus/client_golang v1.0.0
 	github.com/spf13/pflag v1.0.5
-	golang.org/x/net v0.0.0-20200324143707-d3edc9973b7e // indirect
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
 	k8s.io/api v0.18.2
 	k8s.io/apimachinery v0.18.2
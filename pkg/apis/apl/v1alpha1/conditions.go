@@ -0,0 +1,30 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SetCondition adds or updates a condition, moving the transition time only when the status changes
+func SetCondition(conditions *[]Condition, condition Condition) {
+
+	for i := range *conditions {
+		existing := &(*conditions)[i]
+
+		if existing.Type != condition.Type {
+			continue
+		}
+
+		if existing.Status != condition.Status {
+			existing.Status = condition.Status
+			existing.LastTransitionTime = metav1.Now()
+		}
+
+		existing.Reason = condition.Reason
+		existing.Message = condition.Message
+		existing.ObservedGeneration = condition.ObservedGeneration
+		return
+	}
+
+	condition.LastTransitionTime = metav1.Now()
+	*conditions = append(*conditions, condition)
+}
@@ -49,6 +49,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&ServiceConnection{},
 		&ServiceConnectionList{},
+		&PrivateLinkConnectionPolicy{},
+		&PrivateLinkConnectionPolicyList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
@@ -20,6 +20,38 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	// ConditionReady is true when the private endpoint is provisioned and its connection approved
+	ConditionReady = "Ready"
+
+	// ConditionEndpointProvisioned is true when the private endpoint exists in Azure
+	ConditionEndpointProvisioned = "EndpointProvisioned"
+
+	// ConditionApproved is true when the private link service approved the endpoint connection
+	ConditionApproved = "Approved"
+
+	// ConditionFailed is true when the connection was rejected or disconnected and the Fail recovery policy stopped reconciling it
+	ConditionFailed = "Failed"
+
+	// RecoveryPolicyLeave keeps a rejected or disconnected endpoint and reports its state
+	RecoveryPolicyLeave = "Leave"
+
+	// RecoveryPolicyRecreate deletes a rejected or disconnected endpoint so it is created and requested again
+	RecoveryPolicyRecreate = "Recreate"
+
+	// RecoveryPolicyFail keeps a rejected or disconnected endpoint and stops reconciling the connection until its spec changes
+	RecoveryPolicyFail = "Fail"
+
+	// DeniedActionLeave keeps connections a policy does not allow as they are
+	DeniedActionLeave = "Leave"
+
+	// DeniedActionReject rejects connections a policy does not allow
+	DeniedActionReject = "Reject"
+
+	// DeniedActionRemove deletes connections a policy does not allow from the private link service
+	DeniedActionRemove = "Remove"
+)
+
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
@@ -29,20 +61,114 @@ type ServiceConnection struct {
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
 	Spec   ServiceConnectionSpec   `json:"spec"`
-	Status ServiceConnectionStatus `json:"status"`
+	Status ServiceConnectionStatus `json:"status,omitempty"`
 }
 
 // ServiceConnectionSpec is the spec for a ServiceConnection resource
 type ServiceConnectionSpec struct {
-	ServiceName string `json:"serviceName"`
+	// ServiceName is a kubernetes service in the same namespace whose private link service the endpoint connects to.
+	// Exactly one of ServiceName, PrivateLinkServiceID and PrivateLinkServiceAlias is set
+	ServiceName string `json:"serviceName,omitempty"`
+
+	// PrivateLinkServiceID is the Azure resource ID of a private link service or PaaS resource outside the cluster
+	PrivateLinkServiceID string `json:"privateLinkServiceId,omitempty"`
+
+	// PrivateLinkServiceAlias is the alias of a private link service outside the cluster
+	PrivateLinkServiceAlias string `json:"privateLinkServiceAlias,omitempty"`
+
+	// GroupIDs are the sub-resources of a PaaS resource to connect to, e.g. blob or sqlServer
+	GroupIDs []string `json:"groupIds,omitempty"`
+
+	// RequestMessage is shown to the owner of the target when they approve the connection
+	RequestMessage string `json:"requestMessage,omitempty"`
+
+	// RecoveryPolicy decides what happens when the connection is rejected or disconnected: Leave (default), Recreate or Fail
+	RecoveryPolicy string `json:"recoveryPolicy,omitempty"`
+
 	ResourceGroup string `json:"resourceGroup"`
 	VnetName string `json:"vnetName"`
 	SubnetName string `json:"subnetName"`
+
+	// SubscriptionID is the subscription of the resource group and vnet. Defaults to the controller's subscription
+	SubscriptionID string `json:"subscriptionId,omitempty"`
+
+	// IPAddress is a static private IP for the endpoint. It must be a free address of the subnet
+	// and only applies when the endpoint is created
+	IPAddress string `json:"ipAddress,omitempty"`
+
+	// CustomNetworkInterfaceName is the name of the network interface of the endpoint. It only applies when the endpoint is created
+	CustomNetworkInterfaceName string `json:"customNetworkInterfaceName,omitempty"`
+
+	// DNS is the private DNS zone an A record for the endpoint is maintained in. No record is created when unset
+	DNS *DNSSpec `json:"dns,omitempty"`
+}
+
+// DNSSpec selects the private DNS zone and record of a ServiceConnection.
+// The zone is given either by ZoneID or by ZoneName and ResourceGroup
+type DNSSpec struct {
+	// ZoneID is the Azure resource ID of the private DNS zone
+	ZoneID string `json:"zoneId,omitempty"`
+
+	// ZoneName is the name of the private DNS zone, e.g. privatelink.example.com
+	ZoneName string `json:"zoneName,omitempty"`
+
+	// ResourceGroup is the resource group of the zone named by ZoneName
+	ResourceGroup string `json:"resourceGroup,omitempty"`
+
+	// SubscriptionID is the subscription of the zone named by ZoneName. Defaults to the subscription of the endpoint
+	SubscriptionID string `json:"subscriptionId,omitempty"`
+
+	// RecordName is the relative name of the A record. Defaults to the service name
+	RecordName string `json:"recordName,omitempty"`
+
+	// TTL of the record in seconds. Defaults to 300
+	TTL int64 `json:"ttl,omitempty"`
 }
 
 // ServiceConnectionStatus is the status for a ServiceConnection resource
 type ServiceConnectionStatus struct {
-	ConnectionStatus string `json:"connectionStatus"`
+	// PrivateEndpointID is the Azure resource ID of the private endpoint
+	PrivateEndpointID string `json:"privateEndpointId,omitempty"`
+
+	// PrivateIPAddresses are the addresses assigned to the private endpoint in the consumer subnet
+	PrivateIPAddresses []string `json:"privateIpAddresses,omitempty"`
+
+	// ConnectionStatus is the state of the private link service connection: Pending, Approved, Rejected or Disconnected
+	ConnectionStatus string `json:"connectionStatus,omitempty"`
+
+	// DNSRecord is the fully qualified name of the A record pointing at the endpoint
+	DNSRecord string `json:"dnsRecord,omitempty"`
+
+	// DNSRecordID is the Azure resource ID of the A record pointing at the endpoint
+	DNSRecordID string `json:"dnsRecordId,omitempty"`
+
+	// ObservedGeneration is the generation of the spec the status was computed from
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions are the latest observations of the connection's state
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// Condition contains details for one aspect of the current state of a resource.
+// It mirrors metav1.Condition, which is not available in the apimachinery version used here.
+type Condition struct {
+	// Type of condition in CamelCase
+	Type string `json:"type"`
+
+	// Status of the condition, one of True, False, Unknown
+	Status metav1.ConditionStatus `json:"status"`
+
+	// ObservedGeneration is the generation the condition was set based upon
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastTransitionTime is the last time the condition changed status
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+
+	// Reason is a programmatic identifier for the condition's last transition
+	Reason string `json:"reason"`
+
+	// Message is a human readable description of the transition
+	Message string `json:"message"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -54,3 +180,66 @@ type ServiceConnectionList struct {
 
 	Items []ServiceConnection `json:"items"`
 }
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// PrivateLinkConnectionPolicy decides which private endpoints created outside the cluster may connect to the private link service of a service
+type PrivateLinkConnectionPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PrivateLinkConnectionPolicySpec   `json:"spec"`
+	Status PrivateLinkConnectionPolicyStatus `json:"status,omitempty"`
+}
+
+// PrivateLinkConnectionPolicySpec is the spec for a PrivateLinkConnectionPolicy resource.
+// A connection is allowed when its endpoint matches any of the allowed subscriptions, tenants or endpoints
+type PrivateLinkConnectionPolicySpec struct {
+	// ServiceName is the kubernetes service in the same namespace whose private link service the policy applies to
+	ServiceName string `json:"serviceName"`
+
+	// AllowedSubscriptions are the subscription IDs whose endpoints are approved
+	AllowedSubscriptions []string `json:"allowedSubscriptions,omitempty"`
+
+	// AllowedTenants are the Azure AD tenant IDs whose endpoints are approved
+	AllowedTenants []string `json:"allowedTenants,omitempty"`
+
+	// AllowedEndpoints are endpoint resource ID patterns whose endpoints are approved. * matches any characters
+	AllowedEndpoints []string `json:"allowedEndpoints,omitempty"`
+
+	// DeniedAction is what happens to connections that are not allowed: Leave (default) keeps them as they are,
+	// Reject rejects them while they are pending and Remove deletes them from the private link service
+	DeniedAction string `json:"deniedAction,omitempty"`
+}
+
+// PrivateLinkConnectionPolicyStatus is the status for a PrivateLinkConnectionPolicy resource
+type PrivateLinkConnectionPolicyStatus struct {
+	// ObservedGeneration is the generation of the spec the status was computed from
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastSyncTime is when the connections of the private link service were last checked
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+
+	// Approved is the number of approved connections from outside the cluster
+	Approved int32 `json:"approved"`
+
+	// Pending is the number of connections from outside the cluster waiting for approval
+	Pending int32 `json:"pending"`
+
+	// Rejected is the number of rejected connections from outside the cluster
+	Rejected int32 `json:"rejected"`
+
+	// Conditions are the latest observations of the policy's state
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// PrivateLinkConnectionPolicyList is a list of PrivateLinkConnectionPolicy resources
+type PrivateLinkConnectionPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []PrivateLinkConnectionPolicy `json:"items"`
+}
@@ -0,0 +1,244 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	n "github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-05-01/network"
+	apl "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	//VisibilityAnnotation is a comma separated list of subscriptions that can see the private link service. Use * for everyone
+	VisibilityAnnotation = "garvinmsft.github.com/apl-visibility"
+
+	//AutoApprovalAnnotation is a comma separated list of subscriptions whose endpoints are approved automatically
+	AutoApprovalAnnotation = "garvinmsft.github.com/apl-auto-approval"
+
+	//ProxyProtocolAnnotation enables TCP proxy protocol v2 on the private link service when set to true
+	ProxyProtocolAnnotation = "garvinmsft.github.com/apl-proxy-protocol"
+
+	//FqdnsAnnotation is a comma separated list of fqdns set on the private link service
+	FqdnsAnnotation = "garvinmsft.github.com/apl-fqdns"
+
+	//TagsAnnotation is a comma separated list of key=value tags set on the private link service
+	TagsAnnotation = "garvinmsft.github.com/apl-tags"
+
+	//ApprovalModeAnnotation is auto (default) to have the controller approve connections from ServiceConnections,
+	//or manual to wait for them to be listed in ApprovalsAnnotation
+	ApprovalModeAnnotation = "garvinmsft.github.com/apl-approval-mode"
+
+	//ApprovalsAnnotation is a JSON object mapping the names of ServiceConnections to their approval,
+	//e.g. {"example-sc": {"approvedBy": "jane@contoso.com", "description": "CHG-1234"}}
+	ApprovalsAnnotation = "garvinmsft.github.com/apl-approvals"
+
+	//IngressIPsAnnotation is a comma separated list of the load balancer ingress ips exposed through the private link service.
+	//IPv4 and IPv6 select every ingress ip of that family. All ingress ips are exposed by default
+	IngressIPsAnnotation = "garvinmsft.github.com/apl-ingress-ips"
+
+	approvalModeAuto = "auto"
+	approvalModeManual = "manual"
+	controllerApprover = "auto-private-link"
+
+	invalidAnnotation = "InvalidAnnotation"
+	allSubscriptions = "*"
+)
+
+var (
+	subscriptionIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+//ApplyServiceAnnotations sets the private link service properties controlled by annotations on the kubernetes service
+func ApplyServiceAnnotations(service *v1.Service, pls *n.PrivateLinkService) error {
+
+	visibility, err := subscriptionsAnnotation(service, VisibilityAnnotation, true)
+
+	if err != nil {
+		return err
+	}
+
+	autoApproval, err := subscriptionsAnnotation(service, AutoApprovalAnnotation, false)
+
+	if err != nil {
+		return err
+	}
+
+	manual, err := manualApproval(service)
+
+	if err != nil {
+		return err
+	}
+
+	//Auto approval on the private link service would let connections bypass the approvers
+	if manual && len(autoApproval) > 0 {
+		return fmt.Errorf("Annotation %v cannot be combined with %v: %v", AutoApprovalAnnotation, ApprovalModeAnnotation, approvalModeManual)
+	}
+
+	pls.Visibility = &n.PrivateLinkServicePropertiesVisibility{
+		Subscriptions: &visibility,
+	}
+
+	pls.AutoApproval = &n.PrivateLinkServicePropertiesAutoApproval{
+		Subscriptions: &autoApproval,
+	}
+
+	proxyProtocol, err := boolAnnotation(service, ProxyProtocolAnnotation)
+
+	if err != nil {
+		return err
+	}
+
+	pls.EnableProxyProtocol = &proxyProtocol
+
+	fqdns := listAnnotation(service, FqdnsAnnotation)
+	pls.Fqdns = &fqdns
+
+	tags, err := tagsAnnotation(service, TagsAnnotation)
+
+	if err != nil {
+		return err
+	}
+
+	if pls.Tags == nil {
+		pls.Tags = map[string]*string{}
+	}
+
+	for k, v := range tags {
+		pls.Tags[k] = v
+	}
+
+	return nil
+}
+
+//Approval is the decision to approve the connection of a ServiceConnection to a service
+type Approval struct {
+	ApprovedBy string `json:"approvedBy"`
+	Description string `json:"description,omitempty"`
+}
+
+//String is the description recorded in the state of the approved connection
+func (a Approval) String() string {
+	if a.Description == "" {
+		return fmt.Sprintf("Approved by %v", a.ApprovedBy)
+	}
+	return fmt.Sprintf("Approved by %v: %v", a.ApprovedBy, a.Description)
+}
+
+//ConnectionApproval is the approval the controller applies to the pending connection of a ServiceConnection to service.
+//It is nil while a service in manual approval mode has not approved the connection.
+func ConnectionApproval(service *v1.Service, conn *apl.ServiceConnection) (*Approval, error) {
+
+	manual, err := manualApproval(service)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !manual {
+		return &Approval{ApprovedBy: controllerApprover, Description: "approved automatically"}, nil
+	}
+
+	value := strings.TrimSpace(service.Annotations[ApprovalsAnnotation])
+
+	if value == "" {
+		return nil, nil
+	}
+
+	approvals := map[string]Approval{}
+
+	if err := json.Unmarshal([]byte(value), &approvals); err != nil {
+		return nil, fmt.Errorf("Annotation %v must be a JSON object of connection names to approvals: %v", ApprovalsAnnotation, err)
+	}
+
+	approval, ok := approvals[conn.Name]
+
+	if !ok {
+		return nil, nil
+	}
+
+	if strings.TrimSpace(approval.ApprovedBy) == "" {
+		return nil, fmt.Errorf("Annotation %v approves %v without approvedBy", ApprovalsAnnotation, conn.Name)
+	}
+
+	return &approval, nil
+}
+
+//manualApproval reports whether a service waits for connections to be approved in ApprovalsAnnotation
+func manualApproval(service *v1.Service) (bool, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(service.Annotations[ApprovalModeAnnotation])); mode {
+	case "", approvalModeAuto:
+		return false, nil
+	case approvalModeManual:
+		return true, nil
+	default:
+		return false, fmt.Errorf("Annotation %v must be %v or %v, got %q", ApprovalModeAnnotation, approvalModeAuto, approvalModeManual, mode)
+	}
+}
+
+//tagsAnnotation reads a comma separated list of key=value pairs
+func tagsAnnotation(service *v1.Service, key string) (map[string]*string, error) {
+	tags := map[string]*string{}
+
+	for _, item := range listAnnotation(service, key) {
+		pair := strings.SplitN(item, "=", 2)
+
+		if len(pair) != 2 || strings.TrimSpace(pair[0]) == "" {
+			return tags, fmt.Errorf("Annotation %v contains %q which is not a key=value pair", key, item)
+		}
+
+		value := strings.TrimSpace(pair[1])
+		tags[strings.TrimSpace(pair[0])] = &value
+	}
+
+	return tags, nil
+}
+
+//boolAnnotation reads a true/false annotation, treating a missing annotation as false
+func boolAnnotation(service *v1.Service, key string) (bool, error) {
+	value, ok := service.Annotations[key]
+
+	if !ok || strings.TrimSpace(value) == "" {
+		return false, nil
+	}
+
+	result, err := strconv.ParseBool(strings.TrimSpace(value))
+
+	if err != nil {
+		return false, fmt.Errorf("Annotation %v must be true or false, got %q", key, value)
+	}
+
+	return result, nil
+}
+
+//listAnnotation splits a comma separated annotation into its trimmed, non empty values
+func listAnnotation(service *v1.Service, key string) []string {
+	values := []string{}
+
+	for _, item := range strings.Split(service.Annotations[key], ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+
+	return values
+}
+
+func subscriptionsAnnotation(service *v1.Service, key string, allowAll bool) ([]string, error) {
+	values := listAnnotation(service, key)
+
+	for _, item := range values {
+		if allowAll && item == allSubscriptions {
+			continue
+		}
+
+		if !subscriptionIDPattern.MatchString(item) {
+			return values, fmt.Errorf("Annotation %v contains %q which is not a subscription id", key, item)
+		}
+	}
+
+	return values, nil
+}
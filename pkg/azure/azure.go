@@ -2,77 +2,154 @@ package azure
 
 import (
 	"context"
-	n "github.com/Azure/azure-sdk-for-go/services/network/mgmt/2020-05-01/network"
-	"github.com/Azure/go-autorest/autorest/azure/auth"
+	"net/http"
+	"sync/atomic"
+	"time"
+	"github.com/Azure/go-autorest/autorest"
+	n "github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-05-01/network"
 	"github.com/garvinmsft/auto-private-link/pkg/config"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/apimachinery/pkg/runtime"
 	v1 "k8s.io/api/core/v1"
+	apl "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
 )
 
-var (
-	policyDisabled = "Disabled" 
-)
+//AzContext is the set of private link operations the controllers rely on
+type AzContext interface {
+	//AddUpdatePrivateService adds or updates the private link service for a kubernetes service
+	AddUpdatePrivateService(service *v1.Service) (PrivateLinkServiceStatus, error)
+
+	//RemoveService removes the private link service of a kubernetes service if it exists
+	RemoveService(service *v1.Service) error
+
+	//AddUpdatePrivateConnection adds or updates the private endpoint of a service connection.
+	//A pending connection is approved with approval, or left pending when it is nil.
+	AddUpdatePrivateConnection(conn *apl.ServiceConnection, serviceName string, approval *Approval) (PrivateEndpointStatus, error)
+
+	//RemoveEndpoint removes the private endpoint of a service connection
+	RemoveEndpoint(conn *apl.ServiceConnection) error
+
+	//ListOwnedResources lists the resources tagged as created by this cluster in the garbage collection resource groups.
+	//It returns the resources it found along with an error when some resource groups could not be listed
+	ListOwnedResources() ([]OwnedResource, error)
+
+	//RemoveOwnedResource deletes a resource returned by ListOwnedResources
+	RemoveOwnedResource(resource OwnedResource) error
+
+	//ApplyConnectionPolicy approves, rejects or removes the connections from outside the cluster to the private link service of a policy's service.
+	//Connections of the private endpoints of the managed ServiceConnections are left alone.
+	ApplyConnectionPolicy(policy *apl.PrivateLinkConnectionPolicy, managed []*apl.ServiceConnection) (ConnectionPolicyStatus, error)
+
+	//Ping returns nil if an ARM request succeeded within maxAge. Otherwise it checks ARM can be reached with the configured credentials
+	Ping(maxAge time.Duration) error
+}
 
-//AzContext is the holder of all az api clients
-type AzContext struct {
+//armContext is the holder of all az api clients
+type armContext struct {
+	VnetClient n.VirtualNetworksClient
 	SubnetClient n.SubnetsClient
 	PrivateLinkServicesClient n.PrivateLinkServicesClient
-	PrivateEndpointsClient  n.PrivateEndpointsClient
 	LbFrontEndConfigClient n.LoadBalancerFrontendIPConfigurationsClient
+	LoadBalancersClient n.LoadBalancersClient
 	recorder record.EventRecorder
 	Location string
+	SubscriptionID string
 	cfg config.Config
+	lastSuccess *int64
+	endpointClients *clientCache
+	tenants *tenantCache
+	frontends *frontendCache
 }
 
 
 //NewAzContext creates a new azure api client
 func NewAzContext(cfg config.Config, recorder record.EventRecorder) (AzContext, error) {
 
-	azCtx := AzContext{
-		cfg: cfg,
-		recorder: recorder,
+	env, err := cloudEnvironment(cfg)
+	if err!= nil{
+		return nil, err
 	}
 
-	settings, err := auth.GetSettingsFromFile()
+	authorizer, subscriptionID, err := newAuthorizer(cfg, env)
 	if err!= nil{
-		return azCtx, err
+		return nil, err
 	}
 
-	authorizer, err := auth.NewAuthorizerFromFile(n.DefaultBaseURI)
-	if err!= nil{
-		return azCtx, err
+	return NewAzContextWithClient(cfg, recorder, env.ResourceManagerEndpoint, authorizer, subscriptionID, nil)
+}
+
+//NewAzContextWithClient creates an azure api client for the ARM endpoint at baseURI that sends its requests with httpClient,
+//e.g. one that answers them in memory for tests. A nil httpClient uses the default clients of the SDK
+func NewAzContextWithClient(cfg config.Config, recorder record.EventRecorder, baseURI string, authorizer autorest.Authorizer, subscriptionID string, httpClient *http.Client) (AzContext, error) {
+
+	azCtx := armContext{
+		cfg: cfg,
+		recorder: recorder,
+		lastSuccess: new(int64),
+	}
+
+	var sender autorest.Sender
+	if httpClient != nil {
+		sender = httpClient
 	}
-	
-	vnetClient := n.NewVirtualNetworksClient(settings.GetSubscriptionID())
-	vnetClient.Authorizer = authorizer
 
-	vnet, err := vnetClient.Get(context.TODO(), 
+	azCtx.VnetClient = n.NewVirtualNetworksClientWithBaseURI(baseURI, subscriptionID)
+	prepareClient(&azCtx.VnetClient.Client, authorizer, sender, azCtx.lastSuccess)
+
+	vnet, err := azCtx.VnetClient.Get(context.TODO(), 
 				cfg.VnetResourceGroupName,
 				cfg.VnetName,"")
 
 	if err!= nil {
-		return azCtx, err
+		return nil, err
 	}
 
 	azCtx.Location = *vnet.Location
-	azCtx.SubnetClient = n.NewSubnetsClient(settings.GetSubscriptionID())
-	azCtx.PrivateLinkServicesClient = n.NewPrivateLinkServicesClient(settings.GetSubscriptionID())
-	azCtx.PrivateEndpointsClient = n.NewPrivateEndpointsClient(settings.GetSubscriptionID()) 
-	azCtx.LbFrontEndConfigClient =  n.NewLoadBalancerFrontendIPConfigurationsClient(settings.GetSubscriptionID())
-	
-	azCtx.SubnetClient.Authorizer = authorizer
-	azCtx.PrivateLinkServicesClient.Authorizer = authorizer
-	azCtx.PrivateEndpointsClient.Authorizer = authorizer
-	azCtx.LbFrontEndConfigClient.Authorizer = authorizer
+	azCtx.SubscriptionID = subscriptionID
+	azCtx.endpointClients = newClientCache(baseURI, authorizer, sender, azCtx.lastSuccess)
+	azCtx.tenants = newTenantCache(baseURI, httpClient)
+	azCtx.frontends = newFrontendCache()
+	azCtx.SubnetClient = n.NewSubnetsClientWithBaseURI(baseURI, subscriptionID)
+	azCtx.PrivateLinkServicesClient = n.NewPrivateLinkServicesClientWithBaseURI(baseURI, subscriptionID)
+	azCtx.LbFrontEndConfigClient =  n.NewLoadBalancerFrontendIPConfigurationsClientWithBaseURI(baseURI, subscriptionID)
+	azCtx.LoadBalancersClient = n.NewLoadBalancersClientWithBaseURI(baseURI, subscriptionID)
+
+	prepareClient(&azCtx.SubnetClient.Client, authorizer, sender, azCtx.lastSuccess)
+	prepareClient(&azCtx.PrivateLinkServicesClient.Client, authorizer, sender, azCtx.lastSuccess)
+	prepareClient(&azCtx.LbFrontEndConfigClient.Client, authorizer, sender, azCtx.lastSuccess)
+	prepareClient(&azCtx.LoadBalancersClient.Client, authorizer, sender, azCtx.lastSuccess)
 
 	return azCtx, nil
 }
 
-func(azCtx AzContext) successEvent(object runtime.Object, reason string, message string){
+//prepareClient sets the authorizer of a client, replaces its sender when one is given and instruments it
+func prepareClient(client *autorest.Client, authorizer autorest.Authorizer, sender autorest.Sender, lastSuccess *int64) {
+	client.Authorizer = authorizer
+
+	if sender != nil {
+		client.Sender = sender
+	}
+
+	instrument(client, lastSuccess)
+}
+
+//Ping reads the configured vnet when no ARM request succeeded recently
+func (azCtx armContext) Ping(maxAge time.Duration) error {
+
+	last := time.Unix(0, atomic.LoadInt64(azCtx.lastSuccess))
+
+	if time.Since(last) < maxAge {
+		return nil
+	}
+
+	_, err := azCtx.VnetClient.Get(context.TODO(), azCtx.cfg.VnetResourceGroupName, azCtx.cfg.VnetName, "")
+	return err
+}
+
+func(azCtx armContext) successEvent(object runtime.Object, reason string, message string){
 	azCtx.recorder.Event(object, v1.EventTypeNormal, reason, message )
 }
 
-func(azCtx AzContext) warningEvent(object runtime.Object, reason string, message string){
+func(azCtx armContext) warningEvent(object runtime.Object, reason string, message string){
 	azCtx.recorder.Event(object, v1.EventTypeWarning, reason, message)
 }
\ No newline at end of file
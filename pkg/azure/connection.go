@@ -2,9 +2,14 @@ package azure
 
 import (
 	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"net"
+	"strings"
 	apl "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
-	n "github.com/Azure/azure-sdk-for-go/services/network/mgmt/2020-05-01/network"
+	n "github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-05-01/network"
+	"github.com/Azure/go-autorest/autorest/azure"
 	"github.com/Azure/go-autorest/autorest/to"
 )
 
@@ -14,90 +19,225 @@ const (
 	privateEndpointSubnetError = "PrivateEndpointSubnetError"
 	privateEndpointCreationError = "PrivateEndpointCreationError"
 	privateEndpointCreated = "PrivateEndpointCreated"
+
+	//InvalidPrivateIPAddress is the reason reported when the static ip of a connection is not usable in its subnet
+	InvalidPrivateIPAddress = "InvalidPrivateIPAddress"
+
+	//PrivateIPAddressInUse is the reason reported when the static ip of a connection is taken by another resource
+	PrivateIPAddressInUse = "PrivateIPAddressInUse"
+
+	//PrivateIPAddressMismatch is the reason reported when the endpoint was created with another ip than the one requested
+	PrivateIPAddressMismatch = "PrivateIPAddressMismatch"
+
+	//ConnectionRejected is the state of a connection the owner of the private link service rejected
+	ConnectionRejected = "Rejected"
+
+	//ConnectionDisconnected is the state of a connection whose private link service went away or removed it
+	ConnectionDisconnected = "Disconnected"
+
+	//InvalidConnectionTarget is the reason reported when a connection does not name exactly one private link service
+	InvalidConnectionTarget = "InvalidConnectionTarget"
 )
 
+//ConnectionError is a failed reconcile with the reason the connection reports in its conditions
+type ConnectionError struct {
+	Reason string
+	Err error
+}
+
+func (e *ConnectionError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConnectionError) Unwrap() error {
+	return e.Err
+}
+
+//PrivateEndpointStatus is the state of a private endpoint as observed in Azure
+type PrivateEndpointStatus struct {
+	ID string
+	ProvisioningState string
+	IPAddresses []string
+	ConnectionStatus string
+	ConnectionDescription string
+	DNSRecordID string
+	FQDN string
+}
+
 //AddUpdatePrivateConnection adds or updates a private link endpoint
-func (azCtx AzContext) AddUpdatePrivateConnection(conn *apl.ServiceConnection, serviceName string) error {
+func (azCtx armContext) AddUpdatePrivateConnection(conn *apl.ServiceConnection, serviceName string, approval *Approval) (PrivateEndpointStatus, error) {
 
 	ctx := context.TODO()
+	var status PrivateEndpointStatus
+	plsName := PrivateLinkServiceName(azCtx.cfg, conn.Namespace, serviceName)
+
+	if err := ValidateTarget(conn); err != nil {
+		azCtx.warningEvent(conn, InvalidConnectionTarget, err.Error())
+		return status, &ConnectionError{Reason: InvalidConnectionTarget, Err: err}
+	}
 	
 	subnet, err := azCtx.getPrivateEndpointSubnet(conn)
 
 	if err != nil {
-		azCtx.warningEvent(conn, privateEndpointSubnetError, err.Error())
-		return err
+		if !azCtx.authorizationEvent(conn, err) {
+			azCtx.warningEvent(conn, privateEndpointSubnetError, err.Error())
+		}
+		return status, err
+	}
+
+	if err := ValidateStaticIP(conn, subnet); err != nil {
+		azCtx.warningEvent(conn, InvalidPrivateIPAddress, err.Error())
+		return status, &ConnectionError{Reason: InvalidPrivateIPAddress, Err: err}
 	}
 	
-	ep, err := azCtx.getOrCreateEndpoint(conn, serviceName, subnet)
+	ep, err := azCtx.getOrCreateEndpoint(conn, plsName, subnet)
 
 	if err!=nil {
-		return err
+		return status, err
+	}
+
+	status.ID = *ep.ID
+	status.ProvisioningState = string(ep.ProvisioningState)
+
+	if status.IPAddresses, err = azCtx.getEndpointIPAddresses(ep); err != nil {
+		azCtx.authorizationEvent(conn, err)
+		return status, err
 	}
 
-	if len(*ep.PrivateEndpointProperties.ManualPrivateLinkServiceConnections) == 0 {
-		return fmt.Errorf("No connections found on endpoint. This should never happen?")
+	if err := CheckStaticIP(conn, status.IPAddresses); err != nil {
+		azCtx.warningEvent(conn, PrivateIPAddressMismatch, err.Error())
+		return status, &ConnectionError{Reason: PrivateIPAddressMismatch, Err: err}
 	}
 
-	connStatus := (*ep.PrivateEndpointProperties.ManualPrivateLinkServiceConnections)[0].PrivateLinkServiceConnectionState.Status
+	if err := azCtx.reconcileDNSRecord(conn, serviceName, status.IPAddresses, &status); err != nil {
+		return status, err
+	}
+
+	connection, ok := EndpointConnection(ep)
+
+	if !ok {
+		return status, fmt.Errorf("No connections found on endpoint. This should never happen?")
+	}
+
+	connStatus := connection.PrivateLinkServiceConnectionState.Status
+	status.ConnectionStatus = *connStatus
+	status.ConnectionDescription = to.String(connection.PrivateLinkServiceConnectionState.Description)
 	
 	//No need to proceed if the status is approved.
 	if *connStatus == approved {
-		return nil
+		return status, nil
 	} 
 
-	//TODO: Other statuses may require delete and recreate. Deal with that later
+	//Rejected and disconnected connections are handled by the recovery policy of the connection
 	if *connStatus != pending {
-		return fmt.Errorf("The status of this connection is %v", *connStatus)
+		return status, &ConnectionError{Reason: *connStatus, Err: fmt.Errorf("The status of this connection is %v", *connStatus)}
 	} 
 
+	//Services outside the cluster are approved by their owner. Keep reporting the state until they do.
+	if IsRemoteTarget(conn) {
+		return status, nil
+	}
+
+	//Services in manual approval mode wait for someone to approve the connection on the service
+	if approval == nil {
+		status.ConnectionDescription = fmt.Sprintf("Waiting for approval in annotation %v of service %v", ApprovalsAnnotation, serviceName)
+		return status, nil
+	}
+
 	//Proceed with manual approval
 	cons, err := azCtx.PrivateLinkServicesClient.ListPrivateEndpointConnections(ctx,
 		azCtx.cfg.LoadBalancerResourceGroup,
-		serviceName)
+		plsName)
 	
 	if err!= nil {
-		return err
+		return status, err
 	}
 
 	var connName string 
 	for _, v := range cons.Values() {
-		print(*v.PrivateEndpointConnectionProperties.PrivateEndpoint.ID)
-		if *v.PrivateEndpoint.ID == *ep.ID {
-			connName = *v.Name
+		//Connections from outside the cluster may not carry an endpoint
+		if v.PrivateEndpointConnectionProperties == nil || v.PrivateEndpoint == nil || v.PrivateEndpoint.ID == nil {
+			continue
+		}
+
+		if strings.EqualFold(*v.PrivateEndpoint.ID, to.String(ep.ID)) {
+			connName = to.String(v.Name)
 			break
 		}
 	}
 
 	if connName == "" {
-		return fmt.Errorf("Could not find connection in: %v for endpoint: %v", serviceName, ep.Name)
+		return status, fmt.Errorf("Could not find connection in: %v for endpoint: %v", plsName, *ep.Name)
 	}
 
 	_, err = azCtx.PrivateLinkServicesClient.UpdatePrivateEndpointConnection(ctx,
 		azCtx.cfg.LoadBalancerResourceGroup,
-		serviceName,
+		plsName,
 		connName,
 		n.PrivateEndpointConnection{
 			Name: &connName,
 			PrivateEndpointConnectionProperties: &n.PrivateEndpointConnectionProperties{
 				PrivateLinkServiceConnectionState: &n.PrivateLinkServiceConnectionState{
 					Status: to.StringPtr(approved),
+					Description: to.StringPtr(approval.String()),
 				},
 			},
 		},
 	)
 
 	if err!=nil {
-		return err
+		return status, err
 	}
+
+	status.ConnectionStatus = approved
+	status.ConnectionDescription = approval.String()
 	
-	return nil
+	return status, nil
+}
+
+//getEndpointIPAddresses gets the private ips of the network interfaces attached to an endpoint
+func (azCtx armContext) getEndpointIPAddresses(ep n.PrivateEndpoint) ([]string, error) {
+
+	ctx := context.TODO()
+	var ips []string
+
+	if ep.NetworkInterfaces == nil {
+		return ips, nil
+	}
+
+	for _, item := range *ep.NetworkInterfaces {
+		resource, err := azure.ParseResourceID(*item.ID)
+
+		if err != nil {
+			return ips, err
+		}
+
+		nic, err := azCtx.clientsFor(resource.SubscriptionID).InterfacesClient.Get(ctx, resource.ResourceGroup, resource.ResourceName, "")
+
+		if err != nil {
+			return ips, err
+		}
+
+		if nic.IPConfigurations == nil {
+			continue
+		}
+
+		for _, ipConfig := range *nic.IPConfigurations {
+			if ipConfig.PrivateIPAddress != nil {
+				ips = append(ips, *ipConfig.PrivateIPAddress)
+			}
+		}
+	}
+
+	return ips, nil
 }
 
-func (azCtx AzContext) getPrivateEndpointSubnet(conn *apl.ServiceConnection) (n.Subnet, error) {
+func (azCtx armContext) getPrivateEndpointSubnet(conn *apl.ServiceConnection) (n.Subnet, error) {
 	
 	ctx := context.TODO()
+	client := azCtx.clientsFor(conn.Spec.SubscriptionID).SubnetClient
 
-	subnet, err := azCtx.SubnetClient.Get(ctx, 
+	subnet, err := client.Get(ctx, 
 					conn.Spec.ResourceGroup, 
 					conn.Spec.VnetName,
 					conn.Spec.SubnetName, "")
@@ -107,27 +247,27 @@ func (azCtx AzContext) getPrivateEndpointSubnet(conn *apl.ServiceConnection) (n.
 	}
 
 	//fix policy setting
-	if *subnet.PrivateEndpointNetworkPolicies != policyDisabled { 
-		future, _ := azCtx.SubnetClient.CreateOrUpdate(ctx,
+	if subnet.PrivateEndpointNetworkPolicies != n.VirtualNetworkPrivateEndpointNetworkPoliciesDisabled { 
+		future, _ := client.CreateOrUpdate(ctx,
 			conn.Spec.ResourceGroup,
 			conn.Spec.VnetName,
 			conn.Spec.SubnetName,
 			n.Subnet{
 				SubnetPropertiesFormat: &n.SubnetPropertiesFormat{
-					PrivateEndpointNetworkPolicies: &policyDisabled,
+					PrivateEndpointNetworkPolicies: n.VirtualNetworkPrivateEndpointNetworkPoliciesDisabled,
 					AddressPrefix: subnet.AddressPrefix,
 				},
 			},
 			
 		)
 
-		err = future.WaitForCompletionRef(ctx, azCtx.PrivateEndpointsClient.Client)
+		err = future.WaitForCompletionRef(ctx, client.Client)
 
 		if err != nil {
 			return subnet, err
 		} 
 
-		subnet, err = future.Result(azCtx.SubnetClient)
+		subnet, err = future.Result(client)
 
 		if err != nil {
 			return subnet, err
@@ -137,23 +277,36 @@ func (azCtx AzContext) getPrivateEndpointSubnet(conn *apl.ServiceConnection) (n.
 	return subnet, nil
 }
 
-func (azCtx AzContext) getOrCreateEndpoint(conn *apl.ServiceConnection, serviceName string, subnet n.Subnet) (n.PrivateEndpoint, error) {
-	ctx := context.TODO()
+func (azCtx armContext) getOrCreateEndpoint(conn *apl.ServiceConnection, plsName string, subnet n.Subnet) (n.PrivateEndpoint, error) {
 
-	ep, err := azCtx.PrivateEndpointsClient.Get(ctx, conn.Spec.ResourceGroup, conn.Name, "")
+	ep, exists, err := azCtx.getEndpoint(conn)
 
-	if err != nil && ep.Response.Response.StatusCode != 404 {
+	if err != nil {
+		azCtx.authorizationEvent(conn, err)
 		return ep, err
 	} 
 	
-	if err == nil {
+	if exists {
+		if err := CheckOwner(azCtx.cfg, *ep.Name, ep.Tags, conn); err != nil {
+			azCtx.warningEvent(conn, resourceOwnershipConflict, err.Error())
+			return ep, err
+		}
+
 		return ep, nil
 	}
 
-	ep, err = azCtx.createEndpoint(conn, serviceName, subnet)
+	ep, err = azCtx.createEndpoint(conn, plsName, subnet)
 
 	if err!= nil {
-		azCtx.warningEvent(conn, privateEndpointCreationError, err.Error())
+		if hasErrorCode(err, PrivateIPAddressInUse) {
+			err = fmt.Errorf("ipAddress %v is already in use in subnet %v: %v", conn.Spec.IPAddress, conn.Spec.SubnetName, err)
+			azCtx.warningEvent(conn, PrivateIPAddressInUse, err.Error())
+			return ep, &ConnectionError{Reason: PrivateIPAddressInUse, Err: err}
+		}
+
+		if !azCtx.authorizationEvent(conn, err) {
+			azCtx.warningEvent(conn, privateEndpointCreationError, err.Error())
+		}
 		return ep, err
 	}
 
@@ -162,38 +315,96 @@ func (azCtx AzContext) getOrCreateEndpoint(conn *apl.ServiceConnection, serviceN
 
 }
 
-func (azCtx AzContext) createEndpoint(conn *apl.ServiceConnection, serviceName string, subnet n.Subnet) (n.PrivateEndpoint, error) {
+func (azCtx armContext) getEndpoint(conn *apl.ServiceConnection) (n.PrivateEndpoint, bool, error) {
+	ctx := context.TODO()
+
+	ep, err := azCtx.clientsFor(conn.Spec.SubscriptionID).PrivateEndpointsClient.Get(ctx, 
+		conn.Spec.ResourceGroup, 
+		PrivateEndpointName(azCtx.cfg, conn.Namespace, conn.Name), 
+		"")
+
+	if err != nil {
+		if ep.Response.Response != nil && ep.Response.Response.StatusCode == 404 {
+			return ep, false, nil
+		}
+		return ep, false, err
+	}
+
+	return ep, true, nil
+}
+
+func (azCtx armContext) createEndpoint(conn *apl.ServiceConnection, plsName string, subnet n.Subnet) (n.PrivateEndpoint, error) {
 
 	ctx := context.TODO()
 	var ep n.PrivateEndpoint
+	name := PrivateEndpointName(azCtx.cfg, conn.Namespace, conn.Name)
+	client := azCtx.clientsFor(conn.Spec.SubscriptionID).PrivateEndpointsClient
+
+	connection := n.PrivateLinkServiceConnection{
+		Name: &name,
+		PrivateLinkServiceConnectionProperties: &n.PrivateLinkServiceConnectionProperties{},
+	}
 
-	//get service ID (can this exist if the endoint doesn't?)
-	pls, err := azCtx.PrivateLinkServicesClient.Get(ctx, azCtx.cfg.LoadBalancerResourceGroup, serviceName, "")
+	if conn.Spec.RequestMessage != "" {
+		connection.RequestMessage = to.StringPtr(conn.Spec.RequestMessage)
+	}
 
-	if err!= nil {
-		return ep, err
+	properties := &n.PrivateEndpointProperties{
+		Subnet: &n.Subnet{
+			ID: subnet.ID,
+		},
+	}
+
+	if IsRemoteTarget(conn) {
+		//ARM takes either the resource ID or the alias of the target as its ID
+		target := conn.Spec.PrivateLinkServiceID
+		if target == "" {
+			target = conn.Spec.PrivateLinkServiceAlias
+		}
+
+		connection.PrivateLinkServiceID = &target
+
+		if len(conn.Spec.GroupIDs) > 0 {
+			groupIDs := conn.Spec.GroupIDs
+			connection.GroupIds = &groupIDs
+		}
+
+		properties.PrivateLinkServiceConnections = &[]n.PrivateLinkServiceConnection{connection}
+	} else {
+		//get service ID (can this exist if the endoint doesn't?)
+		pls, err := azCtx.PrivateLinkServicesClient.Get(ctx, azCtx.cfg.LoadBalancerResourceGroup, plsName, "")
+
+		if err!= nil {
+			return ep, err
+		}
+
+		connection.PrivateLinkServiceID = pls.ID
+		properties.ManualPrivateLinkServiceConnections = &[]n.PrivateLinkServiceConnection{connection}
+	}
+
+	if conn.Spec.IPAddress != "" {
+		properties.IPConfigurations = &[]n.PrivateEndpointIPConfiguration{
+			{
+				Name: &name,
+				PrivateEndpointIPConfigurationProperties: &n.PrivateEndpointIPConfigurationProperties{
+					PrivateIPAddress: to.StringPtr(conn.Spec.IPAddress),
+				},
+			},
+		}
 	}
 
-	future, err := azCtx.PrivateEndpointsClient.CreateOrUpdate(ctx,
+	if conn.Spec.CustomNetworkInterfaceName != "" {
+		properties.CustomNetworkInterfaceName = to.StringPtr(conn.Spec.CustomNetworkInterfaceName)
+	}
+
+	future, err := client.CreateOrUpdate(ctx,
 		conn.Spec.ResourceGroup,
-		conn.Name,
+		name,
 		n.PrivateEndpoint{
-			Name: &conn.Name,
+			Name: &name,
 			Location: &azCtx.Location,
-			PrivateEndpointProperties: &n.PrivateEndpointProperties{
-				Subnet: &n.Subnet{
-					ID: subnet.ID,
-				},
-				ManualPrivateLinkServiceConnections: &[]n.PrivateLinkServiceConnection{
-					{
-						Name: &conn.Name,
-						PrivateLinkServiceConnectionProperties: &n.PrivateLinkServiceConnectionProperties{
-							PrivateLinkServiceID: pls.ID,
-							
-						},
-					},
-				},
-			},
+			Tags: OwnerTags(azCtx.cfg, conn),
+			PrivateEndpointProperties: properties,
 		},
 	)
 
@@ -201,13 +412,13 @@ func (azCtx AzContext) createEndpoint(conn *apl.ServiceConnection, serviceName s
 		return ep, err
 	}
 
-	err = future.WaitForCompletionRef(ctx, azCtx.PrivateEndpointsClient.Client)
+	err = future.WaitForCompletionRef(ctx, client.Client)
 
 	if err != nil {
 		return ep, err
 	}
 
-	ep, err = future.Result(azCtx.PrivateEndpointsClient)
+	ep, err = future.Result(client)
 
 	if err != nil {
 		return ep, err
@@ -216,22 +427,189 @@ func (azCtx AzContext) createEndpoint(conn *apl.ServiceConnection, serviceName s
 	return ep, nil
 }
 
+//IsRemoteTarget reports whether a connection targets a private link service outside the cluster
+func IsRemoteTarget(conn *apl.ServiceConnection) bool {
+	return conn.Spec.PrivateLinkServiceID != "" || conn.Spec.PrivateLinkServiceAlias != ""
+}
+
+//ValidateTarget checks a connection names exactly one private link service
+func ValidateTarget(conn *apl.ServiceConnection) error {
+
+	targets := 0
+	for _, target := range []string{conn.Spec.ServiceName, conn.Spec.PrivateLinkServiceID, conn.Spec.PrivateLinkServiceAlias} {
+		if target != "" {
+			targets++
+		}
+	}
+
+	if targets != 1 {
+		return fmt.Errorf("Exactly one of serviceName, privateLinkServiceId and privateLinkServiceAlias must be set")
+	}
+
+	if conn.Spec.PrivateLinkServiceID != "" {
+		if _, err := azure.ParseResourceID(conn.Spec.PrivateLinkServiceID); err != nil {
+			return fmt.Errorf("privateLinkServiceId %q is not an Azure resource ID", conn.Spec.PrivateLinkServiceID)
+		}
+	}
+
+	if len(conn.Spec.GroupIDs) > 0 && conn.Spec.PrivateLinkServiceID == "" {
+		return fmt.Errorf("groupIds only apply to a privateLinkServiceId")
+	}
+
+	return nil
+}
+
+//EndpointConnection is the connection of an endpoint to its private link service, from either
+//the manual or the automatically approved list
+func EndpointConnection(ep n.PrivateEndpoint) (n.PrivateLinkServiceConnection, bool) {
+
+	if ep.PrivateEndpointProperties == nil {
+		return n.PrivateLinkServiceConnection{}, false
+	}
+
+	for _, list := range []*[]n.PrivateLinkServiceConnection{ep.ManualPrivateLinkServiceConnections, ep.PrivateLinkServiceConnections} {
+		if list == nil {
+			continue
+		}
+
+		for _, item := range *list {
+			if item.PrivateLinkServiceConnectionProperties != nil && item.PrivateLinkServiceConnectionState != nil {
+				return item, true
+			}
+		}
+	}
+
+	return n.PrivateLinkServiceConnection{}, false
+}
+
+//ValidateStaticIP checks the static ip of a connection is a usable address of the endpoint subnet.
+//Azure reserves the first four and the last address of every subnet.
+func ValidateStaticIP(conn *apl.ServiceConnection, subnet n.Subnet) error {
+
+	if conn.Spec.IPAddress == "" {
+		return nil
+	}
+
+	return validateSubnetIP("ipAddress", conn.Spec.IPAddress, conn.Spec.SubnetName, subnet)
+}
+
+//validateSubnetIP checks an IPv4 address is in the subnet and not one of the addresses Azure reserves
+func validateSubnetIP(field string, address string, subnetName string, subnet n.Subnet) error {
+
+	ip := net.ParseIP(address).To4()
+
+	if ip == nil {
+		return fmt.Errorf("%v %q is not an IPv4 address", field, address)
+	}
+
+	prefixes := subnetPrefixes(subnet)
+
+	for _, prefix := range prefixes {
+		_, cidr, err := net.ParseCIDR(prefix)
+
+		if err != nil || !cidr.Contains(ip) || cidr.IP.To4() == nil {
+			continue
+		}
+
+		ones, bits := cidr.Mask.Size()
+		offset := binary.BigEndian.Uint32(ip) - binary.BigEndian.Uint32(cidr.IP.To4())
+
+		if offset < 4 || uint64(offset) == (uint64(1)<<uint(bits-ones))-1 {
+			return fmt.Errorf("%v %v is reserved by Azure in subnet %v (%v)", field, ip, subnetName, prefix)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("%v %v is not in the address space %v of subnet %v", field, ip, strings.Join(prefixes, ","), subnetName)
+}
+
+//CheckStaticIP returns an error when the endpoint of a connection has addresses but not the requested static ip
+func CheckStaticIP(conn *apl.ServiceConnection, ips []string) error {
+
+	if conn.Spec.IPAddress == "" || len(ips) == 0 {
+		return nil
+	}
+
+	for _, ip := range ips {
+		if ip == conn.Spec.IPAddress {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("The private endpoint has ip %v but ipAddress is %v. The address is only set when the endpoint is created; recreate the ServiceConnection to move it",
+		strings.Join(ips, ","), conn.Spec.IPAddress)
+}
+
+func subnetPrefixes(subnet n.Subnet) []string {
+	prefixes := []string{}
+
+	if subnet.SubnetPropertiesFormat == nil {
+		return prefixes
+	}
+
+	if subnet.AddressPrefix != nil {
+		prefixes = append(prefixes, *subnet.AddressPrefix)
+	}
+
+	return append(prefixes, stringValues(subnet.AddressPrefixes)...)
+}
+
+//hasErrorCode reports whether ARM failed a request with the given error code
+func hasErrorCode(err error, code string) bool {
+	var requestErr *azure.RequestError
+	if errors.As(err, &requestErr) && requestErr.ServiceError != nil && requestErr.ServiceError.Code == code {
+		return true
+	}
+
+	var serviceErr *azure.ServiceError
+	if errors.As(err, &serviceErr) && serviceErr.Code == code {
+		return true
+	}
+
+	//Failed long running operations only carry the code in their message
+	return strings.Contains(err.Error(), code)
+}
+
 //RemoveEndpoint Deletes a private endpoint
-func (azCtx AzContext) RemoveEndpoint(conn *apl.ServiceConnection) error {
+func (azCtx armContext) RemoveEndpoint(conn *apl.ServiceConnection) error {
 
 	ctx := context.TODO()
 
-	future, err := azCtx.PrivateEndpointsClient.Delete(ctx,
+	if err := azCtx.removeDNSRecords(conn); err != nil {
+		return err
+	}
+
+	ep, exists, err := azCtx.getEndpoint(conn)
+
+	if err != nil {
+		azCtx.authorizationEvent(conn, err)
+		return err
+	}
+
+	if !exists {
+		return nil
+	}
+
+	//Never delete an endpoint that another connection or cluster owns
+	if err := CheckOwner(azCtx.cfg, *ep.Name, ep.Tags, conn); err != nil {
+		azCtx.warningEvent(conn, resourceOwnershipConflict, err.Error())
+		return nil
+	}
+
+	client := azCtx.clientsFor(conn.Spec.SubscriptionID).PrivateEndpointsClient
+
+	future, err := client.Delete(ctx,
 		conn.Spec.ResourceGroup,
-		conn.Name,
+		*ep.Name,
 		)
 
-	//404 on delete shouldn't return an error correct?
 	if err != nil {
+		azCtx.authorizationEvent(conn, err)
 		return err
 	}
 	
-	err = future.WaitForCompletionRef(ctx, azCtx.PrivateEndpointsClient.Client)
+	err = future.WaitForCompletionRef(ctx, client.Client)
 	
 	if err != nil {
 			return err
@@ -239,4 +617,4 @@ func (azCtx AzContext) RemoveEndpoint(conn *apl.ServiceConnection) error {
 
 	return nil
 
-}
\ No newline at end of file
+}
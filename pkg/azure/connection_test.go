@@ -0,0 +1,82 @@
+package azure
+
+import (
+	"testing"
+
+	n "github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-05-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	apl "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
+)
+
+func TestValidateSubnetIP(t *testing.T) {
+
+	subnet := n.Subnet{
+		SubnetPropertiesFormat: &n.SubnetPropertiesFormat{
+			AddressPrefix:   to.StringPtr("10.0.1.0/24"),
+			AddressPrefixes: &[]string{"10.0.8.0/29"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		address string
+		subnet  n.Subnet
+		valid   bool
+	}{
+		{name: "first usable address", address: "10.0.1.4", subnet: subnet, valid: true},
+		{name: "last usable address", address: "10.0.1.254", subnet: subnet, valid: true},
+		{name: "network address", address: "10.0.1.0", subnet: subnet},
+		{name: "gateway", address: "10.0.1.1", subnet: subnet},
+		{name: "last reserved dns address", address: "10.0.1.3", subnet: subnet},
+		{name: "broadcast", address: "10.0.1.255", subnet: subnet},
+		{name: "usable address of the second prefix", address: "10.0.8.4", subnet: subnet, valid: true},
+		{name: "broadcast of the second prefix", address: "10.0.8.7", subnet: subnet},
+		{name: "outside the subnet", address: "10.0.2.4", subnet: subnet},
+		{name: "not an address", address: "10.0.1", subnet: subnet},
+		{name: "IPv6", address: "fd00::4", subnet: subnet},
+		{name: "subnet without properties", address: "10.0.1.4", subnet: n.Subnet{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateSubnetIP("ipAddress", test.address, "endpoints", test.subnet)
+
+			if test.valid && err != nil {
+				t.Fatalf("validateSubnetIP(%q) = %v, want nil", test.address, err)
+			}
+			if !test.valid && err == nil {
+				t.Fatalf("validateSubnetIP(%q) = nil, want an error", test.address)
+			}
+		})
+	}
+}
+
+func TestCheckStaticIP(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		ipAddress string
+		ips       []string
+		valid     bool
+	}{
+		{name: "no static ip requested", ips: []string{"10.0.1.4"}, valid: true},
+		{name: "endpoint without addresses yet", ipAddress: "10.0.1.10", valid: true},
+		{name: "endpoint has the static ip", ipAddress: "10.0.1.10", ips: []string{"10.0.1.10"}, valid: true},
+		{name: "static ip among several", ipAddress: "10.0.1.10", ips: []string{"10.0.1.4", "10.0.1.10"}, valid: true},
+		{name: "endpoint has another ip", ipAddress: "10.0.1.10", ips: []string{"10.0.1.4"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn := &apl.ServiceConnection{Spec: apl.ServiceConnectionSpec{IPAddress: test.ipAddress}}
+			err := CheckStaticIP(conn, test.ips)
+
+			if test.valid && err != nil {
+				t.Fatalf("CheckStaticIP() = %v, want nil", err)
+			}
+			if !test.valid && err == nil {
+				t.Fatal("CheckStaticIP() = nil, want an error")
+			}
+		})
+	}
+}
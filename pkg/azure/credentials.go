@@ -0,0 +1,113 @@
+package azure
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/azure/auth"
+	"github.com/garvinmsft/auto-private-link/pkg/config"
+)
+
+const (
+	jwtBearerAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+)
+
+//cloudEnvironment resolves the endpoints of the configured cloud. A metadata URL, as used by Azure Stack Hub
+//or a local stand-in for ARM, takes precedence over the environment name.
+func cloudEnvironment(cfg config.Config) (azure.Environment, error) {
+	if cfg.CloudEnvironmentURL != "" {
+		return azure.EnvironmentFromURL(cfg.CloudEnvironmentURL)
+	}
+
+	return azure.EnvironmentFromName(cfg.CloudEnvironmentName)
+}
+
+//newAuthorizer builds the ARM authorizer for the configured auth mode and returns the subscription to manage
+func newAuthorizer(cfg config.Config, env azure.Environment) (autorest.Authorizer, string, error) {
+
+	switch cfg.AuthMode {
+	case config.AuthModeFile:
+		settings, err := auth.GetSettingsFromFile()
+		if err != nil {
+			return nil, "", err
+		}
+
+		authorizer, err := auth.NewAuthorizerFromFileWithResource(env.TokenAudience)
+		return authorizer, settings.GetSubscriptionID(), err
+
+	case config.AuthModeManagedIdentity, config.AuthModePodIdentity:
+		endpoint, err := adal.GetMSIVMEndpoint()
+		if err != nil {
+			return nil, "", err
+		}
+
+		var token *adal.ServicePrincipalToken
+		if cfg.ClientID != "" {
+			token, err = adal.NewServicePrincipalTokenFromMSIWithUserAssignedID(endpoint, env.TokenAudience, cfg.ClientID)
+		} else {
+			token, err = adal.NewServicePrincipalTokenFromMSI(endpoint, env.TokenAudience)
+		}
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		return autorest.NewBearerAuthorizer(token), cfg.SubscriptionID, nil
+
+	case config.AuthModeWorkloadIdentity:
+		authority := env.ActiveDirectoryEndpoint
+		if cfg.AuthorityHost != "" {
+			authority = cfg.AuthorityHost
+		}
+
+		oauthConfig, err := adal.NewOAuthConfig(authority, cfg.TenantID)
+		if err != nil {
+			return nil, "", err
+		}
+
+		token, err := adal.NewServicePrincipalTokenWithSecret(*oauthConfig,
+			cfg.ClientID,
+			env.TokenAudience,
+			&federatedTokenSecret{path: cfg.FederatedTokenFile})
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		return autorest.NewBearerAuthorizer(token), cfg.SubscriptionID, nil
+
+	case config.AuthModeCertificate:
+		certificate := auth.NewClientCertificateConfig(cfg.ClientCertificatePath, cfg.ClientCertificatePassword, cfg.ClientID, cfg.TenantID)
+		certificate.AADEndpoint = env.ActiveDirectoryEndpoint
+		certificate.Resource = env.TokenAudience
+
+		authorizer, err := certificate.Authorizer()
+		return authorizer, cfg.SubscriptionID, err
+	}
+
+	return nil, "", fmt.Errorf("Unsupported auth mode %v", cfg.AuthMode)
+}
+
+//federatedTokenSecret authenticates with the service account token projected by AKS workload identity.
+//The file is read on every refresh because the kubelet rotates the token.
+type federatedTokenSecret struct {
+	path string
+}
+
+//SetAuthenticationValues implements adal.ServicePrincipalSecret
+func (secret *federatedTokenSecret) SetAuthenticationValues(spt *adal.ServicePrincipalToken, values *url.Values) error {
+
+	token, err := ioutil.ReadFile(secret.path)
+	if err != nil {
+		return fmt.Errorf("Could not read federated token file %v: %v", secret.path, err)
+	}
+
+	values.Set("client_assertion_type", jwtBearerAssertionType)
+	values.Set("client_assertion", strings.TrimSpace(string(token)))
+	return nil
+}
@@ -0,0 +1,168 @@
+package azure
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	n "github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-05-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+//DiffPrivateLinkService lists the properties of the actual private link service that differ from the desired one
+func DiffPrivateLinkService(desired n.PrivateLinkService, actual n.PrivateLinkService) []string {
+
+	var changed []string
+
+	if actual.PrivateLinkServiceProperties == nil {
+		actual.PrivateLinkServiceProperties = &n.PrivateLinkServiceProperties{}
+	}
+
+	if !sameValues(frontendIDs(desired), frontendIDs(actual)) {
+		changed = append(changed, "frontend IP configurations")
+	}
+
+	if !sameValues(ipConfigurations(desired), ipConfigurations(actual)) {
+		changed = append(changed, "IP configurations")
+	}
+
+	if !sameValues(visibilitySubscriptions(desired), visibilitySubscriptions(actual)) {
+		changed = append(changed, "visibility")
+	}
+
+	if !sameValues(autoApprovalSubscriptions(desired), autoApprovalSubscriptions(actual)) {
+		changed = append(changed, "auto approval")
+	}
+
+	if !sameValues(stringValues(desired.Fqdns), stringValues(actual.Fqdns)) {
+		changed = append(changed, "fqdns")
+	}
+
+	if !hasTags(actual.Tags, desired.Tags) {
+		changed = append(changed, "tags")
+	}
+
+	if to.Bool(desired.EnableProxyProtocol) != to.Bool(actual.EnableProxyProtocol) {
+		changed = append(changed, "proxy protocol")
+	}
+
+	return changed
+}
+
+//mergePrivateLinkService applies the desired properties to the actual private link service,
+//keeping the tags that were added outside of the controller
+func mergePrivateLinkService(desired n.PrivateLinkService, actual n.PrivateLinkService) n.PrivateLinkService {
+
+	merged := actual
+	properties := *desired.PrivateLinkServiceProperties
+	merged.PrivateLinkServiceProperties = &properties
+
+	tags := map[string]*string{}
+	for k, v := range actual.Tags {
+		tags[k] = v
+	}
+	for k, v := range desired.Tags {
+		tags[k] = v
+	}
+	merged.Tags = tags
+
+	return merged
+}
+
+func frontendIDs(pls n.PrivateLinkService) []string {
+	ids := []string{}
+
+	if pls.LoadBalancerFrontendIPConfigurations == nil {
+		return ids
+	}
+
+	for _, item := range *pls.LoadBalancerFrontendIPConfigurations {
+		ids = append(ids, to.String(item.ID))
+	}
+
+	return ids
+}
+
+//ipConfigurations describes each NAT IP configuration by its subnet, whether it is primary and its address when static
+func ipConfigurations(pls n.PrivateLinkService) []string {
+	configs := []string{}
+
+	if pls.IPConfigurations == nil {
+		return configs
+	}
+
+	for _, item := range *pls.IPConfigurations {
+		var subnetID, address string
+		var primary bool
+
+		if properties := item.PrivateLinkServiceIPConfigurationProperties; properties != nil {
+			if properties.Subnet != nil {
+				subnetID = to.String(properties.Subnet.ID)
+			}
+
+			primary = to.Bool(properties.Primary)
+
+			//Dynamic addresses are picked by Azure and not part of the desired state
+			if properties.PrivateIPAllocationMethod == n.IPAllocationMethodStatic {
+				address = to.String(properties.PrivateIPAddress)
+			}
+		}
+
+		configs = append(configs, fmt.Sprintf("%v|%v|%v", subnetID, primary, address))
+	}
+
+	return configs
+}
+
+func visibilitySubscriptions(pls n.PrivateLinkService) []string {
+	if pls.Visibility == nil {
+		return []string{}
+	}
+	return stringValues(pls.Visibility.Subscriptions)
+}
+
+func autoApprovalSubscriptions(pls n.PrivateLinkService) []string {
+	if pls.AutoApproval == nil {
+		return []string{}
+	}
+	return stringValues(pls.AutoApproval.Subscriptions)
+}
+
+func stringValues(values *[]string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return *values
+}
+
+//hasTags checks every expected tag is set on the resource. Azure compares tag names ignoring case.
+func hasTags(tags map[string]*string, expected map[string]*string) bool {
+	lower := map[string]string{}
+	for k, v := range tags {
+		lower[strings.ToLower(k)] = to.String(v)
+	}
+
+	for k, v := range expected {
+		if actual, ok := lower[strings.ToLower(k)]; !ok || actual != to.String(v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+//sameValues compares two lists ignoring order and case. ARM does not preserve the case of resource IDs.
+func sameValues(a []string, b []string) bool {
+	return strings.Join(normalize(a), ",") == strings.Join(normalize(b), ",")
+}
+
+func normalize(values []string) []string {
+	normalized := []string{}
+
+	for _, item := range values {
+		normalized = append(normalized, strings.ToLower(item))
+	}
+
+	sort.Strings(normalized)
+	return normalized
+}
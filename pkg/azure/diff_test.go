@@ -0,0 +1,166 @@
+package azure
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	n "github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-05-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+const (
+	testFrontendID = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/kubernetes-internal/frontendIPConfigurations/a1"
+	testSubnetID   = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/virtualNetworks/vnet/subnets/nat"
+)
+
+func testPrivateLinkService() n.PrivateLinkService {
+	return n.PrivateLinkService{
+		Tags: map[string]*string{"owner": to.StringPtr("cluster")},
+		PrivateLinkServiceProperties: &n.PrivateLinkServiceProperties{
+			LoadBalancerFrontendIPConfigurations: &[]n.FrontendIPConfiguration{{ID: to.StringPtr(testFrontendID)}},
+			IPConfigurations: &[]n.PrivateLinkServiceIPConfiguration{{
+				Name: to.StringPtr("nat-0"),
+				PrivateLinkServiceIPConfigurationProperties: &n.PrivateLinkServiceIPConfigurationProperties{
+					Subnet:                    &n.Subnet{ID: to.StringPtr(testSubnetID)},
+					Primary:                   to.BoolPtr(true),
+					PrivateIPAllocationMethod: n.IPAllocationMethodDynamic,
+				},
+			}},
+			Visibility:   &n.PrivateLinkServicePropertiesVisibility{Subscriptions: &[]string{"sub-a", "sub-b"}},
+			AutoApproval: &n.PrivateLinkServicePropertiesAutoApproval{Subscriptions: &[]string{"sub-a"}},
+			Fqdns:        &[]string{"app.contoso.com"},
+		},
+	}
+}
+
+func TestDiffPrivateLinkService(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		actual func(pls *n.PrivateLinkService)
+		want   []string
+	}{
+		{
+			name:   "unchanged",
+			actual: func(pls *n.PrivateLinkService) {},
+		},
+		{
+			name: "resource IDs differ in case",
+			actual: func(pls *n.PrivateLinkService) {
+				pls.LoadBalancerFrontendIPConfigurations = &[]n.FrontendIPConfiguration{{ID: to.StringPtr(strings.ToUpper(testFrontendID))}}
+			},
+		},
+		{
+			name: "subscriptions in another order",
+			actual: func(pls *n.PrivateLinkService) {
+				pls.Visibility = &n.PrivateLinkServicePropertiesVisibility{Subscriptions: &[]string{"sub-b", "sub-a"}}
+			},
+		},
+		{
+			name: "address picked by Azure for a dynamic configuration",
+			actual: func(pls *n.PrivateLinkService) {
+				(*pls.IPConfigurations)[0].PrivateIPAddress = to.StringPtr("10.0.2.4")
+			},
+		},
+		{
+			name: "tags added outside the controller",
+			actual: func(pls *n.PrivateLinkService) {
+				pls.Tags = map[string]*string{"Owner": to.StringPtr("cluster"), "team": to.StringPtr("web")}
+			},
+		},
+		{
+			name: "missing frontend",
+			actual: func(pls *n.PrivateLinkService) {
+				pls.LoadBalancerFrontendIPConfigurations = nil
+			},
+			want: []string{"frontend IP configurations"},
+		},
+		{
+			name: "NAT configuration made static",
+			actual: func(pls *n.PrivateLinkService) {
+				pls.IPConfigurations = &[]n.PrivateLinkServiceIPConfiguration{{
+					PrivateLinkServiceIPConfigurationProperties: &n.PrivateLinkServiceIPConfigurationProperties{
+						Subnet:                    &n.Subnet{ID: to.StringPtr(testSubnetID)},
+						Primary:                   to.BoolPtr(true),
+						PrivateIPAllocationMethod: n.IPAllocationMethodStatic,
+						PrivateIPAddress:          to.StringPtr("10.0.2.4"),
+					},
+				}}
+			},
+			want: []string{"IP configurations"},
+		},
+		{
+			name: "visibility and auto approval",
+			actual: func(pls *n.PrivateLinkService) {
+				pls.Visibility = nil
+				pls.AutoApproval = &n.PrivateLinkServicePropertiesAutoApproval{Subscriptions: &[]string{"sub-c"}}
+			},
+			want: []string{"visibility", "auto approval"},
+		},
+		{
+			name: "fqdns",
+			actual: func(pls *n.PrivateLinkService) {
+				pls.Fqdns = &[]string{}
+			},
+			want: []string{"fqdns"},
+		},
+		{
+			name: "tag value",
+			actual: func(pls *n.PrivateLinkService) {
+				pls.Tags = map[string]*string{"owner": to.StringPtr("other")}
+			},
+			want: []string{"tags"},
+		},
+		{
+			name: "proxy protocol",
+			actual: func(pls *n.PrivateLinkService) {
+				pls.EnableProxyProtocol = to.BoolPtr(true)
+			},
+			want: []string{"proxy protocol"},
+		},
+		{
+			name: "no properties",
+			actual: func(pls *n.PrivateLinkService) {
+				pls.PrivateLinkServiceProperties = nil
+			},
+			want: []string{"frontend IP configurations", "IP configurations", "visibility", "auto approval", "fqdns"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := testPrivateLinkService()
+			test.actual(&actual)
+
+			got := DiffPrivateLinkService(testPrivateLinkService(), actual)
+
+			if len(got) != 0 || len(test.want) != 0 {
+				if !reflect.DeepEqual(got, test.want) {
+					t.Fatalf("DiffPrivateLinkService() = %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMergePrivateLinkService(t *testing.T) {
+
+	desired := testPrivateLinkService()
+	actual := testPrivateLinkService()
+	actual.Name = to.StringPtr("pls")
+	actual.Tags = map[string]*string{"owner": to.StringPtr("other"), "team": to.StringPtr("web")}
+	actual.Fqdns = nil
+
+	merged := mergePrivateLinkService(desired, actual)
+
+	if to.String(merged.Name) != "pls" {
+		t.Errorf("name = %q, want pls", to.String(merged.Name))
+	}
+	if to.String(merged.Tags["owner"]) != "cluster" || to.String(merged.Tags["team"]) != "web" {
+		t.Errorf("tags = %v, want the desired tags over the actual ones", merged.Tags)
+	}
+	if diff := DiffPrivateLinkService(desired, merged); len(diff) != 0 {
+		t.Errorf("merged service differs from the desired one in %v", diff)
+	}
+}
@@ -0,0 +1,320 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/privatedns/mgmt/2018-09-01/privatedns"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/to"
+	apl "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
+)
+
+const (
+	privateDNSZoneType = "privateDnsZones"
+	defaultDNSTTL = 300
+
+	privateDNSRecordError = "PrivateDNSRecordError"
+	privateDNSRecordUpdated = "PrivateDNSRecordUpdated"
+	privateDNSRecordDeleted = "PrivateDNSRecordDeleted"
+)
+
+//DNSRecord identifies the A record of a service connection in a private DNS zone
+type DNSRecord struct {
+	SubscriptionID string
+	ResourceGroup string
+	Zone string
+	Name string
+}
+
+//ID is the Azure resource ID of the record
+func (r DNSRecord) ID() string {
+	return fmt.Sprintf("/subscriptions/%v/resourceGroups/%v/providers/Microsoft.Network/%v/%v/A/%v",
+		r.SubscriptionID, r.ResourceGroup, privateDNSZoneType, r.Zone, r.Name)
+}
+
+//FQDN is the fully qualified name the record resolves
+func (r DNSRecord) FQDN() string {
+	if r.Name == "@" {
+		return r.Zone
+	}
+	return r.Name + "." + r.Zone
+}
+
+//DesiredDNSRecord is the record the spec of a connection asks for. It reports false when the connection has no dns settings.
+//The zone subscription defaults to defaultSubscription and the record name to the service, or the connection for targets outside the cluster.
+func DesiredDNSRecord(conn *apl.ServiceConnection, serviceName string, defaultSubscription string) (DNSRecord, bool, error) {
+
+	var record DNSRecord
+	spec := conn.Spec.DNS
+
+	if spec == nil {
+		return record, false, nil
+	}
+
+	switch {
+	case spec.ZoneID != "":
+		resource, err := azure.ParseResourceID(spec.ZoneID)
+
+		if err != nil || !strings.EqualFold(resource.ResourceType, privateDNSZoneType) {
+			return record, true, fmt.Errorf("dns.zoneId %q is not the resource ID of a private DNS zone", spec.ZoneID)
+		}
+
+		record.SubscriptionID = resource.SubscriptionID
+		record.ResourceGroup = resource.ResourceGroup
+		record.Zone = resource.ResourceName
+	case spec.ZoneName != "" && spec.ResourceGroup != "":
+		record.SubscriptionID = spec.SubscriptionID
+		record.ResourceGroup = spec.ResourceGroup
+		record.Zone = spec.ZoneName
+	default:
+		return record, true, fmt.Errorf("dns needs either zoneId or zoneName and resourceGroup")
+	}
+
+	if record.SubscriptionID == "" {
+		record.SubscriptionID = defaultSubscription
+	}
+
+	record.Zone = strings.TrimSuffix(strings.ToLower(record.Zone), ".")
+	record.Name = strings.ToLower(spec.RecordName)
+
+	if record.Name == "" {
+		record.Name = strings.ToLower(serviceName)
+	}
+
+	if record.Name == "" {
+		record.Name = strings.ToLower(conn.Name)
+	}
+
+	return record, true, nil
+}
+
+//ParseDNSRecordID splits the resource ID of a private DNS A record
+func ParseDNSRecordID(id string) (DNSRecord, error) {
+
+	var record DNSRecord
+	segments := strings.Split(strings.Trim(id, "/"), "/")
+
+	if len(segments) != 10 ||
+		!strings.EqualFold(segments[0], "subscriptions") ||
+		!strings.EqualFold(segments[2], "resourceGroups") ||
+		!strings.EqualFold(segments[4], "providers") ||
+		!strings.EqualFold(segments[6], privateDNSZoneType) ||
+		!strings.EqualFold(segments[8], "A") {
+		return record, fmt.Errorf("%q is not the resource ID of a private DNS A record", id)
+	}
+
+	record.SubscriptionID = segments[1]
+	record.ResourceGroup = segments[3]
+	record.Zone = segments[7]
+	record.Name = segments[9]
+
+	return record, nil
+}
+
+//DNSTTL is the time to live of the record of a connection
+func DNSTTL(conn *apl.ServiceConnection) int64 {
+	if conn.Spec.DNS == nil || conn.Spec.DNS.TTL <= 0 {
+		return defaultDNSTTL
+	}
+	return conn.Spec.DNS.TTL
+}
+
+//DNSMetadata converts ownership tags into record set metadata, whose keys only allow letters, digits and underscores
+func DNSMetadata(tags map[string]*string) map[string]*string {
+	metadata := map[string]*string{}
+	for k, v := range tags {
+		metadata[strings.Replace(k, "-", "_", -1)] = v
+	}
+	return metadata
+}
+
+//DNSMetadataTags converts record set metadata back into ownership tags
+func DNSMetadataTags(metadata map[string]*string) map[string]*string {
+	tags := map[string]*string{}
+	for k, v := range metadata {
+		tags[strings.Replace(k, "_", "-", -1)] = v
+	}
+	return tags
+}
+
+//reconcileDNSRecord points the record of a connection at the endpoint ips, removing the record
+//the connection used before when the zone or name changed
+func (azCtx armContext) reconcileDNSRecord(conn *apl.ServiceConnection, serviceName string, ips []string, status *PrivateEndpointStatus) error {
+
+	record, wanted, err := DesiredDNSRecord(conn, serviceName, azCtx.connectionSubscription(conn))
+
+	if err != nil {
+		azCtx.warningEvent(conn, privateDNSRecordError, err.Error())
+		return err
+	}
+
+	if previous := conn.Status.DNSRecordID; previous != "" && (!wanted || !strings.EqualFold(previous, record.ID())) {
+		old, err := ParseDNSRecordID(previous)
+
+		if err == nil {
+			if err := azCtx.deleteDNSRecord(conn, old); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !wanted {
+		return nil
+	}
+
+	//Endpoints get their ip once provisioned; keep the old record until then
+	if len(ips) == 0 {
+		status.DNSRecordID = conn.Status.DNSRecordID
+		status.FQDN = conn.Status.DNSRecord
+		return nil
+	}
+
+	if err := azCtx.ensureDNSRecord(conn, record, ips); err != nil {
+		return err
+	}
+
+	status.DNSRecordID = record.ID()
+	status.FQDN = record.FQDN()
+	return nil
+}
+
+func (azCtx armContext) ensureDNSRecord(conn *apl.ServiceConnection, record DNSRecord, ips []string) error {
+
+	ctx := context.TODO()
+	client := azCtx.clientsFor(record.SubscriptionID).RecordSetsClient
+	ttl := DNSTTL(conn)
+
+	existing, err := client.Get(ctx, record.ResourceGroup, record.Zone, privatedns.A, record.Name)
+
+	if err != nil && !isNotFound(existing.Response.Response) {
+		azCtx.warningEvent(conn, privateDNSRecordError, err.Error())
+		return err
+	}
+
+	metadata := DNSMetadata(OwnerTags(azCtx.cfg, conn))
+
+	if err == nil && existing.RecordSetProperties != nil {
+		if err := CheckOwner(azCtx.cfg, record.FQDN(), DNSMetadataTags(existing.Metadata), conn); err != nil {
+			azCtx.warningEvent(conn, resourceOwnershipConflict, err.Error())
+			return err
+		}
+
+		if sameValues(aRecordAddresses(existing.RecordSetProperties), ips) &&
+			to.Int64(existing.TTL) == ttl &&
+			hasTags(existing.Metadata, metadata) {
+			return nil
+		}
+
+		for k, v := range existing.Metadata {
+			if _, ok := tagValue(metadata, k); !ok {
+				metadata[k] = v
+			}
+		}
+	}
+
+	aRecords := []privatedns.ARecord{}
+	for _, ip := range ips {
+		aRecords = append(aRecords, privatedns.ARecord{Ipv4Address: to.StringPtr(ip)})
+	}
+
+	_, err = client.CreateOrUpdate(ctx,
+		record.ResourceGroup,
+		record.Zone,
+		privatedns.A,
+		record.Name,
+		privatedns.RecordSet{
+			RecordSetProperties: &privatedns.RecordSetProperties{
+				Metadata: metadata,
+				TTL: &ttl,
+				ARecords: &aRecords,
+			},
+		},
+		"", "")
+
+	if err != nil {
+		azCtx.warningEvent(conn, privateDNSRecordError, err.Error())
+		return err
+	}
+
+	azCtx.successEvent(conn, privateDNSRecordUpdated, fmt.Sprintf("%v -> %v", record.FQDN(), strings.Join(ips, ",")))
+	return nil
+}
+
+//removeDNSRecords deletes the record the spec of a connection asks for and the one recorded in its status
+func (azCtx armContext) removeDNSRecords(conn *apl.ServiceConnection) error {
+
+	var records []DNSRecord
+
+	if record, wanted, err := DesiredDNSRecord(conn, conn.Spec.ServiceName, azCtx.connectionSubscription(conn)); err == nil && wanted {
+		records = append(records, record)
+	}
+
+	if conn.Status.DNSRecordID != "" {
+		if record, err := ParseDNSRecordID(conn.Status.DNSRecordID); err == nil &&
+			(len(records) == 0 || !strings.EqualFold(records[0].ID(), record.ID())) {
+			records = append(records, record)
+		}
+	}
+
+	for _, record := range records {
+		if err := azCtx.deleteDNSRecord(conn, record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//deleteDNSRecord deletes a record if it exists and belongs to the connection
+func (azCtx armContext) deleteDNSRecord(conn *apl.ServiceConnection, record DNSRecord) error {
+
+	ctx := context.TODO()
+	client := azCtx.clientsFor(record.SubscriptionID).RecordSetsClient
+
+	existing, err := client.Get(ctx, record.ResourceGroup, record.Zone, privatedns.A, record.Name)
+
+	if err != nil {
+		if isNotFound(existing.Response.Response) {
+			return nil
+		}
+		azCtx.warningEvent(conn, privateDNSRecordError, err.Error())
+		return err
+	}
+
+	//Never delete a record that another connection or cluster owns
+	if err := CheckOwner(azCtx.cfg, record.FQDN(), DNSMetadataTags(existing.Metadata), conn); err != nil {
+		azCtx.warningEvent(conn, resourceOwnershipConflict, err.Error())
+		return nil
+	}
+
+	response, err := client.Delete(ctx, record.ResourceGroup, record.Zone, privatedns.A, record.Name, "")
+
+	if err != nil && !isNotFound(response.Response) {
+		azCtx.warningEvent(conn, privateDNSRecordError, err.Error())
+		return err
+	}
+
+	azCtx.successEvent(conn, privateDNSRecordDeleted, record.FQDN())
+	return nil
+}
+
+func aRecordAddresses(properties *privatedns.RecordSetProperties) []string {
+	ips := []string{}
+
+	if properties.ARecords == nil {
+		return ips
+	}
+
+	for _, item := range *properties.ARecords {
+		ips = append(ips, to.String(item.Ipv4Address))
+	}
+
+	return ips
+}
+
+func isNotFound(response *http.Response) bool {
+	return response != nil && response.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,157 @@
+package azure
+
+import (
+	"testing"
+
+	apl "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDesiredDNSRecord(t *testing.T) {
+
+	const zoneID = "/subscriptions/zone-sub/resourceGroups/dns/providers/Microsoft.Network/privateDnsZones/Privatelink.Contoso.com"
+
+	tests := []struct {
+		name        string
+		dns         *apl.DNSSpec
+		serviceName string
+		wanted      bool
+		valid       bool
+		want        DNSRecord
+		fqdn        string
+	}{
+		{name: "no dns settings", serviceName: "db", valid: true},
+		{
+			name:        "zone ID",
+			dns:         &apl.DNSSpec{ZoneID: zoneID},
+			serviceName: "DB",
+			wanted:      true,
+			valid:       true,
+			want:        DNSRecord{SubscriptionID: "zone-sub", ResourceGroup: "dns", Zone: "privatelink.contoso.com", Name: "db"},
+			fqdn:        "db.privatelink.contoso.com",
+		},
+		{
+			name:        "zone name in the endpoint subscription",
+			dns:         &apl.DNSSpec{ZoneName: "privatelink.contoso.com.", ResourceGroup: "dns"},
+			serviceName: "db",
+			wanted:      true,
+			valid:       true,
+			want:        DNSRecord{SubscriptionID: "endpoint-sub", ResourceGroup: "dns", Zone: "privatelink.contoso.com", Name: "db"},
+			fqdn:        "db.privatelink.contoso.com",
+		},
+		{
+			name:        "zone name in another subscription",
+			dns:         &apl.DNSSpec{ZoneName: "privatelink.contoso.com", ResourceGroup: "dns", SubscriptionID: "zone-sub"},
+			serviceName: "db",
+			wanted:      true,
+			valid:       true,
+			want:        DNSRecord{SubscriptionID: "zone-sub", ResourceGroup: "dns", Zone: "privatelink.contoso.com", Name: "db"},
+			fqdn:        "db.privatelink.contoso.com",
+		},
+		{
+			name:        "record name",
+			dns:         &apl.DNSSpec{ZoneID: zoneID, RecordName: "Orders"},
+			serviceName: "db",
+			wanted:      true,
+			valid:       true,
+			want:        DNSRecord{SubscriptionID: "zone-sub", ResourceGroup: "dns", Zone: "privatelink.contoso.com", Name: "orders"},
+			fqdn:        "orders.privatelink.contoso.com",
+		},
+		{
+			name:   "zone apex",
+			dns:    &apl.DNSSpec{ZoneID: zoneID, RecordName: "@"},
+			wanted: true,
+			valid:  true,
+			want:   DNSRecord{SubscriptionID: "zone-sub", ResourceGroup: "dns", Zone: "privatelink.contoso.com", Name: "@"},
+			fqdn:   "privatelink.contoso.com",
+		},
+		{
+			name:   "target outside the cluster is named after the connection",
+			dns:    &apl.DNSSpec{ZoneID: zoneID},
+			wanted: true,
+			valid:  true,
+			want:   DNSRecord{SubscriptionID: "zone-sub", ResourceGroup: "dns", Zone: "privatelink.contoso.com", Name: "conn"},
+			fqdn:   "conn.privatelink.contoso.com",
+		},
+		{
+			name:   "public dns zone",
+			dns:    &apl.DNSSpec{ZoneID: "/subscriptions/zone-sub/resourceGroups/dns/providers/Microsoft.Network/dnszones/contoso.com"},
+			wanted: true,
+		},
+		{
+			name:   "not a resource ID",
+			dns:    &apl.DNSSpec{ZoneID: "privatelink.contoso.com"},
+			wanted: true,
+		},
+		{
+			name:   "zone name without resource group",
+			dns:    &apl.DNSSpec{ZoneName: "privatelink.contoso.com"},
+			wanted: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn := &apl.ServiceConnection{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: "Conn"},
+				Spec:       apl.ServiceConnectionSpec{DNS: test.dns},
+			}
+
+			record, wanted, err := DesiredDNSRecord(conn, test.serviceName, "endpoint-sub")
+
+			if wanted != test.wanted {
+				t.Fatalf("DesiredDNSRecord() wanted = %v, want %v", wanted, test.wanted)
+			}
+			if !test.valid {
+				if err == nil {
+					t.Fatal("DesiredDNSRecord() = nil error, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DesiredDNSRecord() = %v, want nil", err)
+			}
+			if record != test.want {
+				t.Fatalf("DesiredDNSRecord() = %+v, want %+v", record, test.want)
+			}
+			if test.fqdn != "" && record.FQDN() != test.fqdn {
+				t.Fatalf("FQDN() = %q, want %q", record.FQDN(), test.fqdn)
+			}
+		})
+	}
+}
+
+func TestParseDNSRecordID(t *testing.T) {
+
+	record := DNSRecord{SubscriptionID: "sub", ResourceGroup: "dns", Zone: "privatelink.contoso.com", Name: "db"}
+
+	tests := []struct {
+		name  string
+		id    string
+		valid bool
+	}{
+		{name: "record ID", id: record.ID(), valid: true},
+		{name: "segments in another case", id: "/SUBSCRIPTIONS/sub/resourcegroups/dns/providers/Microsoft.Network/PRIVATEDNSZONES/privatelink.contoso.com/a/db", valid: true},
+		{name: "without the leading slash", id: "subscriptions/sub/resourceGroups/dns/providers/Microsoft.Network/privateDnsZones/privatelink.contoso.com/A/db", valid: true},
+		{name: "CNAME record", id: "/subscriptions/sub/resourceGroups/dns/providers/Microsoft.Network/privateDnsZones/privatelink.contoso.com/CNAME/db"},
+		{name: "public zone", id: "/subscriptions/sub/resourceGroups/dns/providers/Microsoft.Network/dnszones/privatelink.contoso.com/A/db"},
+		{name: "zone ID", id: "/subscriptions/sub/resourceGroups/dns/providers/Microsoft.Network/privateDnsZones/privatelink.contoso.com"},
+		{name: "empty", id: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseDNSRecordID(test.id)
+
+			if !test.valid {
+				if err == nil {
+					t.Fatalf("ParseDNSRecordID(%q) = %+v, want an error", test.id, got)
+				}
+				return
+			}
+			if err != nil || got != record {
+				t.Fatalf("ParseDNSRecordID(%q) = %+v, %v, want %+v", test.id, got, err, record)
+			}
+		})
+	}
+}
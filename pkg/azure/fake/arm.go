@@ -0,0 +1,1093 @@
+package fake
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	n "github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-05-01/network"
+	"github.com/Azure/azure-sdk-for-go/services/privatedns/mgmt/2018-09-01/privatedns"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// resourceTypes maps the lower case type segments of ARM paths to the names actions and errors use
+var resourceTypes = map[string]string{
+	"virtualnetworks":            "virtualNetworks",
+	"subnets":                    "subnets",
+	"loadbalancers":              "loadBalancers",
+	"frontendipconfigurations":   "frontendIPConfigurations",
+	"privatelinkservices":        "privateLinkServices",
+	"privateendpointconnections": "privateEndpointConnections",
+	"privateendpoints":           "privateEndpoints",
+	"networkinterfaces":          "networkInterfaces",
+	"privatednszones":            "privateDnsZones",
+	"a":                          "recordSets",
+	"operations":                 "operations",
+}
+
+// transport answers the requests of the azure clients from the state of the fake
+type transport struct {
+	f *AzContext
+}
+
+// response is the answer of the fake to a request. body is encoded as JSON
+type response struct {
+	status int
+	header http.Header
+	body   interface{}
+}
+
+// request is a request for a resource or a list of resources, split along the segments of its path
+type request struct {
+	*http.Request
+	id       string
+	resource string
+	name     string
+	list     bool
+	body     []byte
+}
+
+func (t transport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	var body []byte
+	if req.Body != nil {
+		body, _ = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+	}
+
+	res := t.f.serve(req, body)
+
+	var content []byte
+	if res.body != nil {
+		content, _ = json.Marshal(res.body)
+	}
+
+	header := res.header
+	if header == nil {
+		header = http.Header{}
+	}
+	if len(content) > 0 {
+		header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%v %v", res.status, http.StatusText(res.status)),
+		StatusCode:    res.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(content)),
+		ContentLength: int64(len(content)),
+		Request:       req,
+	}, nil
+}
+
+// serve routes a request to the handler of its resource type
+func (f *AzContext) serve(req *http.Request, body []byte) response {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+
+	//Anonymous requests for a subscription are answered with a challenge naming its tenant
+	if len(segments) == 2 && strings.EqualFold(segments[0], "subscriptions") {
+		f.actions = append(f.actions, Action{Verb: "get", Resource: "subscriptions", Name: segments[1]})
+		return f.serveTenant(segments[1])
+	}
+
+	if len(segments) == 8 && strings.EqualFold(segments[6], "operations") {
+		f.actions = append(f.actions, Action{Verb: "poll", Resource: "operations", Name: segments[7]})
+		return f.poll(segments[7])
+	}
+
+	if len(segments) < 7 || !strings.EqualFold(segments[0], "subscriptions") || !strings.EqualFold(segments[2], "resourceGroups") ||
+		!strings.EqualFold(segments[4], "providers") || !strings.EqualFold(segments[5], "Microsoft.Network") {
+		return unsupported(req)
+	}
+
+	parts := segments[6:]
+	r := request{Request: req, id: "/" + strings.Join(segments, "/"), body: body}
+
+	//Paths with an odd number of segments after the provider name a collection
+	if len(parts)%2 == 1 {
+		r.list = true
+		r.resource = resourceTypes[strings.ToLower(parts[len(parts)-1])]
+		r.name = segments[3]
+		if len(parts) > 1 {
+			r.name = parts[len(parts)-2]
+		}
+	} else {
+		r.resource = resourceTypes[strings.ToLower(parts[len(parts)-2])]
+		r.name = parts[len(parts)-1]
+	}
+
+	verb := strings.ToLower(req.Method)
+	if r.list {
+		verb = "list"
+	}
+
+	f.actions = append(f.actions, Action{Verb: verb, Resource: r.resource, Name: r.name})
+
+	if status, ok := f.errors[verb+"/"+r.resource]; ok {
+		return failure(status, errorCode(status), fmt.Sprintf("%v %v failed", verb, r.id))
+	}
+
+	switch r.resource {
+	case "virtualNetworks":
+		return f.serveVirtualNetwork(r)
+	case "subnets":
+		return f.serveSubnet(r)
+	case "loadBalancers":
+		return f.serveLoadBalancer(r)
+	case "frontendIPConfigurations":
+		return f.serveFrontend(r)
+	case "privateLinkServices":
+		return f.servePrivateLinkService(r)
+	case "privateEndpointConnections":
+		return f.serveConnection(r)
+	case "privateEndpoints":
+		return f.servePrivateEndpoint(r)
+	case "networkInterfaces":
+		return f.serveInterface(r)
+	case "privateDnsZones":
+		return f.serveZone(r)
+	case "recordSets":
+		return f.serveRecord(r)
+	}
+
+	return unsupported(req)
+}
+
+func (f *AzContext) serveTenant(subscriptionID string) response {
+
+	tenant, ok := f.tenants[strings.ToLower(subscriptionID)]
+	if !ok {
+		return failure(http.StatusNotFound, "SubscriptionNotFound", fmt.Sprintf("The subscription '%v' could not be found.", subscriptionID))
+	}
+
+	header := http.Header{}
+	header.Set("WWW-Authenticate", fmt.Sprintf(`Bearer authorization_uri="https://login.microsoftonline.com/%v", error="invalid_token", error_description="The authentication failed because of missing 'Authorization' header."`, tenant))
+
+	return response{
+		status: http.StatusUnauthorized,
+		header: header,
+		body:   errorBody("AuthenticationFailed", "Authentication failed. The 'Authorization' header is missing."),
+	}
+}
+
+// poll answers InProgress until the operation was polled OperationPolls times and then completes it
+func (f *AzContext) poll(id string) response {
+
+	op, ok := f.operations[id]
+	if !ok {
+		return failure(http.StatusNotFound, "OperationNotFound", fmt.Sprintf("Operation %v was not found.", id))
+	}
+
+	status := "InProgress"
+
+	if op.remaining > 0 {
+		op.remaining--
+	} else {
+		op.complete()
+		delete(f.operations, id)
+		status = succeeded
+	}
+
+	return response{status: http.StatusOK, header: retryNow(), body: map[string]interface{}{"status": status}}
+}
+
+// longRunning completes a put or delete right away, or starts an operation the client has to poll when OperationPolls is set.
+// The body is rendered after completing the operation
+func (f *AzContext) longRunning(r request, status int, body func() interface{}, complete func()) response {
+
+	if f.OperationPolls <= 0 {
+		complete()
+
+		if r.Method == http.MethodDelete {
+			return response{status: http.StatusOK}
+		}
+		return response{status: status, body: body()}
+	}
+
+	f.sequence++
+	id := fmt.Sprintf("operation-%v", f.sequence)
+	f.operations[id] = &operation{remaining: f.OperationPolls, complete: complete}
+
+	header := retryNow()
+	header.Set("Azure-AsyncOperation", fmt.Sprintf("%vsubscriptions/%v/providers/Microsoft.Network/locations/%v/operations/%v",
+		baseURI, f.subscriptionID, Location, id))
+
+	if r.Method == http.MethodDelete {
+		return response{status: http.StatusAccepted, header: header}
+	}
+	return response{status: http.StatusCreated, header: header, body: body()}
+}
+
+func (f *AzContext) serveVirtualNetwork(r request) response {
+
+	if r.Method != http.MethodGet || r.list {
+		return unsupported(r.Request)
+	}
+
+	key := strings.ToLower(r.id)
+	if _, ok := f.vnets[key]; !ok {
+		return notFound(r)
+	}
+	return success(f.renderVirtualNetwork(key))
+}
+
+func (f *AzContext) serveSubnet(r request) response {
+
+	key := strings.ToLower(r.id)
+
+	switch {
+	case r.list:
+		return unsupported(r.Request)
+
+	case r.Method == http.MethodGet:
+		if _, ok := f.subnets[key]; !ok {
+			return notFound(r)
+		}
+		return success(f.renderSubnet(key))
+
+	case r.Method == http.MethodPut:
+		vnetKey := key[:strings.LastIndex(key, "/subnets/")]
+		if _, ok := f.vnets[vnetKey]; !ok {
+			return failure(http.StatusNotFound, "ParentResourceNotFound", fmt.Sprintf("Virtual network of %v was not found.", r.id))
+		}
+
+		var desired n.Subnet
+		if err := json.Unmarshal(r.body, &desired); err != nil || desired.SubnetPropertiesFormat == nil {
+			return failure(http.StatusBadRequest, "InvalidRequestFormat", fmt.Sprintf("Cannot parse the request: %v", err))
+		}
+
+		status := http.StatusOK
+		subnet, exists := f.subnets[key]
+		if !exists {
+			status = http.StatusCreated
+			subnet = &n.Subnet{ID: to.StringPtr(r.id), Name: to.StringPtr(r.name), SubnetPropertiesFormat: &n.SubnetPropertiesFormat{}}
+			f.subnets[key] = subnet
+		}
+
+		subnet.AddressPrefix = desired.AddressPrefix
+		subnet.AddressPrefixes = desired.AddressPrefixes
+		subnet.PrivateEndpointNetworkPolicies = desired.PrivateEndpointNetworkPolicies
+		subnet.PrivateLinkServiceNetworkPolicies = desired.PrivateLinkServiceNetworkPolicies
+		subnet.ProvisioningState = updating
+
+		return f.longRunning(r, status,
+			func() interface{} { return f.renderSubnet(key) },
+			func() { subnet.ProvisioningState = succeeded })
+	}
+
+	return unsupported(r.Request)
+}
+
+func (f *AzContext) serveLoadBalancer(r request) response {
+
+	if !r.list || r.Method != http.MethodGet {
+		return unsupported(r.Request)
+	}
+
+	var lbs []interface{}
+	for _, key := range f.children(f.loadBalancers, r.id) {
+		lbs = append(lbs, document(f.loadBalancers[key]))
+	}
+	return list(lbs)
+}
+
+func (f *AzContext) serveFrontend(r request) response {
+
+	if r.Method != http.MethodGet {
+		return unsupported(r.Request)
+	}
+
+	if r.list {
+		lb, ok := f.loadBalancers[strings.ToLower(r.id[:strings.LastIndex(r.id, "/")])]
+		if !ok {
+			return notFound(r)
+		}
+
+		var frontends []interface{}
+		for _, frontend := range *lb.FrontendIPConfigurations {
+			frontends = append(frontends, document(frontend))
+		}
+		return list(frontends)
+	}
+
+	frontend, found := f.findFrontend(r.id)
+	if !found {
+		return notFound(r)
+	}
+	return success(frontend)
+}
+
+func (f *AzContext) servePrivateLinkService(r request) response {
+
+	key := strings.ToLower(r.id)
+
+	switch {
+	case r.list && r.Method == http.MethodGet:
+		var services []interface{}
+		for _, key := range f.children(f.services, r.id) {
+			services = append(services, document(f.renderPrivateLinkService(key)))
+		}
+		return list(services)
+
+	case r.Method == http.MethodGet:
+		if _, ok := f.services[key]; !ok {
+			return notFound(r)
+		}
+		return success(f.renderPrivateLinkService(key))
+
+	case r.Method == http.MethodPut:
+		return f.putPrivateLinkService(r)
+
+	case r.Method == http.MethodDelete:
+		if _, ok := f.services[key]; !ok {
+			return response{status: http.StatusNoContent}
+		}
+
+		f.services[key].ProvisioningState = deleting
+
+		return f.longRunning(r, http.StatusOK, nil, func() {
+			delete(f.services, key)
+
+			//Endpoints outlive their private link service with a disconnected connection
+			for endpointKey, conn := range f.connections {
+				if conn.service != key {
+					continue
+				}
+				if _, ok := f.endpoints[endpointKey]; !ok {
+					delete(f.connections, endpointKey)
+					continue
+				}
+				conn.service = ""
+				conn.status = disconnected
+			}
+		})
+	}
+
+	return unsupported(r.Request)
+}
+
+// putPrivateLinkService validates the frontends and NAT subnets like ARM does and hands out the NAT ips
+func (f *AzContext) putPrivateLinkService(r request) response {
+
+	key := strings.ToLower(r.id)
+
+	var desired n.PrivateLinkService
+	if err := json.Unmarshal(r.body, &desired); err != nil || desired.PrivateLinkServiceProperties == nil {
+		return failure(http.StatusBadRequest, "InvalidRequestFormat", fmt.Sprintf("Cannot parse the request: %v", err))
+	}
+
+	if desired.LoadBalancerFrontendIPConfigurations == nil || len(*desired.LoadBalancerFrontendIPConfigurations) == 0 {
+		return failure(http.StatusBadRequest, "PrivateLinkServiceWithoutFrontendIPConfiguration", "A private link service needs a load balancer frontend ip configuration.")
+	}
+
+	for _, frontend := range *desired.LoadBalancerFrontendIPConfigurations {
+		if _, ok := f.findFrontend(to.String(frontend.ID)); !ok {
+			return failure(http.StatusBadRequest, "InvalidResourceReference", fmt.Sprintf("Resource %v referenced by %v was not found.", to.String(frontend.ID), r.id))
+		}
+	}
+
+	if desired.IPConfigurations == nil || len(*desired.IPConfigurations) == 0 {
+		return failure(http.StatusBadRequest, "PrivateLinkServiceWithoutIPConfiguration", "A private link service needs an ip configuration.")
+	}
+
+	existing, exists := f.services[key]
+	var taken []string
+	configs := []n.PrivateLinkServiceIPConfiguration{}
+
+	for _, config := range *desired.IPConfigurations {
+		if config.PrivateLinkServiceIPConfigurationProperties == nil || config.Subnet == nil {
+			return failure(http.StatusBadRequest, "InvalidRequestFormat", "Every ip configuration needs a subnet.")
+		}
+
+		subnetID := to.String(config.Subnet.ID)
+		if _, ok := f.subnets[strings.ToLower(subnetID)]; !ok {
+			return failure(http.StatusBadRequest, "InvalidResourceReference", fmt.Sprintf("Resource %v referenced by %v was not found.", subnetID, r.id))
+		}
+
+		ip := to.String(config.PrivateIPAddress)
+
+		switch {
+		case ip != "":
+			if f.addressInUse(subnetID, ip, key) || contains(taken, ip) {
+				return failure(http.StatusBadRequest, "PrivateIPAddressInUse", fmt.Sprintf("Private static IP address %v is already in use in subnet %v.", ip, subnetID))
+			}
+
+		case exists:
+			//Dynamic addresses stay with their configuration
+			for _, item := range *existing.IPConfigurations {
+				if to.String(item.Name) == to.String(config.Name) && strings.EqualFold(to.String(item.Subnet.ID), subnetID) {
+					ip = to.String(item.PrivateIPAddress)
+				}
+			}
+		}
+
+		if ip == "" {
+			var free bool
+			if ip, free = f.allocateIP(subnetID, taken, key); !free {
+				return failure(http.StatusBadRequest, "SubnetIsFull", fmt.Sprintf("Subnet %v has no free address.", subnetID))
+			}
+		}
+
+		taken = append(taken, ip)
+		config.ID = to.StringPtr(r.id + "/ipConfigurations/" + to.String(config.Name))
+		config.PrivateIPAddress = to.StringPtr(ip)
+		config.PrivateIPAddressVersion = n.IPVersionIPv4
+		config.ProvisioningState = succeeded
+		configs = append(configs, config)
+	}
+
+	pls := &desired
+	pls.ID = to.StringPtr(r.id)
+	pls.Name = to.StringPtr(r.name)
+	pls.Type = to.StringPtr("Microsoft.Network/privateLinkServices")
+	pls.IPConfigurations = &configs
+	pls.PrivateEndpointConnections = nil
+	pls.ProvisioningState = updating
+
+	status := http.StatusOK
+	if exists {
+		pls.Alias = existing.Alias
+	} else {
+		status = http.StatusCreated
+		f.sequence++
+		pls.Alias = to.StringPtr(fmt.Sprintf("%v.%08x-0000-0000-0000-000000000000.%v.azure.privatelinkservice", r.name, f.sequence, Location))
+	}
+
+	f.services[key] = pls
+
+	return f.longRunning(r, status,
+		func() interface{} { return f.renderPrivateLinkService(key) },
+		func() { pls.ProvisioningState = succeeded })
+}
+
+// serveConnection serves the connections of a private link service
+func (f *AzContext) serveConnection(r request) response {
+
+	serviceID := r.id[:strings.LastIndex(strings.ToLower(r.id), "/privateendpointconnections")]
+	serviceKey := strings.ToLower(serviceID)
+
+	if _, ok := f.services[serviceKey]; !ok {
+		return notFound(r)
+	}
+
+	if r.list {
+		var connections []interface{}
+		for _, conn := range f.serviceConnections(serviceKey) {
+			connections = append(connections, document(f.renderConnection(serviceID, conn)))
+		}
+		return list(connections)
+	}
+
+	var conn *connection
+	var endpointKey string
+	for key, item := range f.connections {
+		if item.service == serviceKey && strings.EqualFold(item.name, r.name) {
+			conn, endpointKey = item, key
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if conn == nil {
+			return notFound(r)
+		}
+		return success(f.renderConnection(serviceID, conn))
+
+	case http.MethodPut:
+		if conn == nil {
+			return notFound(r)
+		}
+
+		var desired n.PrivateEndpointConnection
+		if err := json.Unmarshal(r.body, &desired); err != nil || desired.PrivateEndpointConnectionProperties == nil ||
+			desired.PrivateLinkServiceConnectionState == nil {
+			return failure(http.StatusBadRequest, "InvalidRequestFormat", fmt.Sprintf("Cannot parse the request: %v", err))
+		}
+
+		conn.status = to.String(desired.PrivateLinkServiceConnectionState.Status)
+		conn.description = to.String(desired.PrivateLinkServiceConnectionState.Description)
+		return success(f.renderConnection(serviceID, conn))
+
+	case http.MethodDelete:
+		if conn == nil {
+			return response{status: http.StatusNoContent}
+		}
+
+		return f.longRunning(r, http.StatusOK, nil, func() {
+			//The endpoint stays with a disconnected connection; endpoints outside the fake are forgotten
+			if _, ok := f.endpoints[endpointKey]; !ok {
+				delete(f.connections, endpointKey)
+				return
+			}
+			conn.service = ""
+			conn.status = disconnected
+			conn.description = ""
+		})
+	}
+
+	return unsupported(r.Request)
+}
+
+func (f *AzContext) servePrivateEndpoint(r request) response {
+
+	key := strings.ToLower(r.id)
+
+	switch {
+	case r.list && r.Method == http.MethodGet:
+		var endpoints []interface{}
+		for _, key := range f.children(f.endpoints, r.id) {
+			endpoints = append(endpoints, document(f.renderPrivateEndpoint(key)))
+		}
+		return list(endpoints)
+
+	case r.Method == http.MethodGet:
+		if _, ok := f.endpoints[key]; !ok {
+			return notFound(r)
+		}
+		return success(f.renderPrivateEndpoint(key))
+
+	case r.Method == http.MethodPut:
+		return f.putPrivateEndpoint(r)
+
+	case r.Method == http.MethodDelete:
+		ep, ok := f.endpoints[key]
+		if !ok {
+			return response{status: http.StatusNoContent}
+		}
+
+		ep.ProvisioningState = deleting
+
+		return f.longRunning(r, http.StatusOK, nil, func() {
+			for _, nic := range *ep.NetworkInterfaces {
+				delete(f.interfaces, strings.ToLower(to.String(nic.ID)))
+			}
+			delete(f.endpoints, key)
+			delete(f.connections, key)
+		})
+	}
+
+	return unsupported(r.Request)
+}
+
+// putPrivateEndpoint creates an endpoint with its network interface and its connection to the target private link service.
+// Existing endpoints only get their tags updated
+func (f *AzContext) putPrivateEndpoint(r request) response {
+
+	key := strings.ToLower(r.id)
+
+	var desired n.PrivateEndpoint
+	if err := json.Unmarshal(r.body, &desired); err != nil || desired.PrivateEndpointProperties == nil {
+		return failure(http.StatusBadRequest, "InvalidRequestFormat", fmt.Sprintf("Cannot parse the request: %v", err))
+	}
+
+	if ep, ok := f.endpoints[key]; ok {
+		ep.Tags = desired.Tags
+		return success(f.renderPrivateEndpoint(key))
+	}
+
+	if desired.Subnet == nil {
+		return failure(http.StatusBadRequest, "InvalidRequestFormat", "A private endpoint needs a subnet.")
+	}
+
+	subnetID := to.String(desired.Subnet.ID)
+	if _, ok := f.subnets[strings.ToLower(subnetID)]; !ok {
+		return failure(http.StatusBadRequest, "InvalidResourceReference", fmt.Sprintf("Resource %v referenced by %v was not found.", subnetID, r.id))
+	}
+
+	connections := desired.PrivateLinkServiceConnections
+	manual := false
+	if desired.ManualPrivateLinkServiceConnections != nil && len(*desired.ManualPrivateLinkServiceConnections) > 0 {
+		connections = desired.ManualPrivateLinkServiceConnections
+		manual = true
+	}
+
+	if connections == nil || len(*connections) != 1 || (*connections)[0].PrivateLinkServiceConnectionProperties == nil {
+		return failure(http.StatusBadRequest, "InvalidRequestFormat", "A private endpoint needs one private link service connection.")
+	}
+
+	ip := ""
+	if desired.IPConfigurations != nil && len(*desired.IPConfigurations) > 0 {
+		ip = to.String((*desired.IPConfigurations)[0].PrivateIPAddress)
+	}
+
+	allocation := n.IPAllocationMethodStatic
+	if ip == "" {
+		var free bool
+		if ip, free = f.allocateIP(subnetID, nil, ""); !free {
+			return failure(http.StatusBadRequest, "SubnetIsFull", fmt.Sprintf("Subnet %v has no free address.", subnetID))
+		}
+		allocation = n.IPAllocationMethodDynamic
+	} else if f.addressInUse(subnetID, ip, "") {
+		return failure(http.StatusBadRequest, "PrivateIPAddressInUse", fmt.Sprintf("Private static IP address %v is already in use in subnet %v.", ip, subnetID))
+	}
+
+	f.sequence++
+	nicName := to.String(desired.CustomNetworkInterfaceName)
+	if nicName == "" {
+		nicName = fmt.Sprintf("%v.nic.%08x-0000-0000-0000-000000000000", r.name, f.sequence)
+	}
+	nicID := r.id[:strings.LastIndex(strings.ToLower(r.id), "/privateendpoints/")] + "/networkInterfaces/" + nicName
+
+	f.interfaces[strings.ToLower(nicID)] = &n.Interface{
+		ID:       to.StringPtr(nicID),
+		Name:     to.StringPtr(nicName),
+		Location: desired.Location,
+		InterfacePropertiesFormat: &n.InterfacePropertiesFormat{
+			IPConfigurations: &[]n.InterfaceIPConfiguration{
+				{
+					ID:   to.StringPtr(nicID + "/ipConfigurations/privateEndpointIpConfig"),
+					Name: to.StringPtr("privateEndpointIpConfig"),
+					InterfaceIPConfigurationPropertiesFormat: &n.InterfaceIPConfigurationPropertiesFormat{
+						PrivateIPAddress:          to.StringPtr(ip),
+						PrivateIPAllocationMethod: allocation,
+						PrivateIPAddressVersion:   n.IPVersionIPv4,
+						Subnet:                    &n.Subnet{ID: to.StringPtr(subnetID)},
+						ProvisioningState:         succeeded,
+					},
+				},
+			},
+			ProvisioningState: succeeded,
+		},
+	}
+
+	target := (*connections)[0]
+	conn := &connection{
+		name:           fmt.Sprintf("%v.%08x-0000-0000-0000-000000000000", r.name, f.sequence),
+		endpointID:     r.id,
+		target:         to.String(target.PrivateLinkServiceID),
+		manual:         manual,
+		requestMessage: to.String(target.RequestMessage),
+		status:         pending,
+	}
+
+	if target.GroupIds != nil {
+		conn.groupIDs = *target.GroupIds
+	}
+
+	//Targets outside the fake stay pending until SetConnectionState
+	for serviceKey, pls := range f.services {
+		if strings.EqualFold(to.String(pls.ID), conn.target) || strings.EqualFold(to.String(pls.Alias), conn.target) {
+			conn.service = serviceKey
+			if !manual {
+				conn.status = autoApprovalStatus(pls, r.id)
+			}
+		}
+	}
+
+	f.connections[key] = conn
+
+	ep := &desired
+	ep.ID = to.StringPtr(r.id)
+	ep.Name = to.StringPtr(r.name)
+	ep.Type = to.StringPtr("Microsoft.Network/privateEndpoints")
+	ep.Subnet = &n.Subnet{ID: to.StringPtr(subnetID)}
+	ep.NetworkInterfaces = &[]n.Interface{{ID: to.StringPtr(nicID)}}
+	ep.ProvisioningState = updating
+	f.endpoints[key] = ep
+
+	return f.longRunning(r, http.StatusCreated,
+		func() interface{} { return f.renderPrivateEndpoint(key) },
+		func() { ep.ProvisioningState = succeeded })
+}
+
+func (f *AzContext) serveInterface(r request) response {
+
+	if r.list || r.Method != http.MethodGet {
+		return unsupported(r.Request)
+	}
+
+	nic, found := f.interfaces[strings.ToLower(r.id)]
+	if !found {
+		return notFound(r)
+	}
+	return success(nic)
+}
+
+func (f *AzContext) serveZone(r request) response {
+
+	if !r.list || r.Method != http.MethodGet {
+		return unsupported(r.Request)
+	}
+
+	var zones []interface{}
+	for _, key := range f.children(f.zones, r.id) {
+		zones = append(zones, document(f.zones[key]))
+	}
+	return list(zones)
+}
+
+func (f *AzContext) serveRecord(r request) response {
+
+	zoneID := strings.TrimSuffix(r.id, "/"+r.name)
+	if r.list {
+		zoneID = r.id
+	}
+	zoneID = zoneID[:len(zoneID)-len("/A")]
+
+	zone, found := f.zones[strings.ToLower(zoneID)]
+	if !found {
+		return failure(http.StatusNotFound, "ParentResourceNotFound", fmt.Sprintf("Private DNS zone %v was not found.", zoneID))
+	}
+
+	key := strings.ToLower(r.id)
+
+	switch {
+	case r.list && r.Method == http.MethodGet:
+		var records []interface{}
+		for _, key := range f.children(f.records, r.id) {
+			records = append(records, document(f.records[key]))
+		}
+		return list(records)
+
+	case r.Method == http.MethodGet:
+		record, ok := f.records[key]
+		if !ok {
+			return notFound(r)
+		}
+		return success(record)
+
+	case r.Method == http.MethodPut:
+		var desired privatedns.RecordSet
+		if err := json.Unmarshal(r.body, &desired); err != nil || desired.RecordSetProperties == nil {
+			return failure(http.StatusBadRequest, "InvalidRequestFormat", fmt.Sprintf("Cannot parse the request: %v", err))
+		}
+
+		status := http.StatusOK
+		if _, ok := f.records[key]; !ok {
+			status = http.StatusCreated
+		}
+
+		desired.ID = to.StringPtr(r.id)
+		desired.Name = to.StringPtr(r.name)
+		desired.Type = to.StringPtr("Microsoft.Network/privateDnsZones/A")
+		desired.Fqdn = to.StringPtr(fmt.Sprintf("%v.%v.", r.name, to.String(zone.Name)))
+		f.records[key] = &desired
+
+		return response{status: status, body: document(&desired)}
+
+	case r.Method == http.MethodDelete:
+		if _, ok := f.records[key]; !ok {
+			return response{status: http.StatusNoContent}
+		}
+		delete(f.records, key)
+		return response{status: http.StatusOK}
+	}
+
+	return unsupported(r.Request)
+}
+
+// children returns the keys of the resources of a collection in the order they sort in
+func (f *AzContext) children(resources interface{}, collectionID string) []string {
+	prefix := strings.ToLower(collectionID) + "/"
+
+	var keys []string
+	for _, key := range reflect.ValueOf(resources).MapKeys() {
+		if id := key.String(); strings.HasPrefix(id, prefix) && !strings.Contains(id[len(prefix):], "/") {
+			keys = append(keys, id)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// serviceConnections returns the connections to a private link service in the order of their names
+func (f *AzContext) serviceConnections(serviceKey string) []*connection {
+	var names []string
+	byName := map[string]*connection{}
+
+	for _, conn := range f.connections {
+		if conn.service == serviceKey {
+			names = append(names, conn.name)
+			byName[conn.name] = conn
+		}
+	}
+
+	sort.Strings(names)
+
+	connections := []*connection{}
+	for _, name := range names {
+		connections = append(connections, byName[name])
+	}
+	return connections
+}
+
+func (f *AzContext) findFrontend(id string) (n.FrontendIPConfiguration, bool) {
+
+	index := strings.LastIndex(strings.ToLower(id), "/frontendipconfigurations/")
+	if index < 0 {
+		return n.FrontendIPConfiguration{}, false
+	}
+
+	lb, ok := f.loadBalancers[strings.ToLower(id[:index])]
+	if !ok {
+		return n.FrontendIPConfiguration{}, false
+	}
+
+	for _, frontend := range *lb.FrontendIPConfigurations {
+		if strings.EqualFold(to.String(frontend.ID), id) {
+			return frontend, true
+		}
+	}
+	return n.FrontendIPConfiguration{}, false
+}
+
+// renderVirtualNetwork is a vnet with its subnets, as ARM returns it
+func (f *AzContext) renderVirtualNetwork(key string) n.VirtualNetwork {
+	vnet := *f.vnets[key]
+	properties := *vnet.VirtualNetworkPropertiesFormat
+
+	subnets := []n.Subnet{}
+	for _, subnetKey := range f.children(f.subnets, key+"/subnets") {
+		subnets = append(subnets, f.renderSubnet(subnetKey))
+	}
+
+	properties.Subnets = &subnets
+	vnet.VirtualNetworkPropertiesFormat = &properties
+	return vnet
+}
+
+// renderSubnet is a subnet with the ip configurations of the network interfaces and private link services using it
+func (f *AzContext) renderSubnet(key string) n.Subnet {
+	subnet := *f.subnets[key]
+	properties := *subnet.SubnetPropertiesFormat
+
+	configs := []n.IPConfiguration{}
+
+	for _, nicKey := range sortedKeys(f.interfaces) {
+		for _, config := range *f.interfaces[nicKey].IPConfigurations {
+			if strings.EqualFold(to.String(config.Subnet.ID), to.String(subnet.ID)) {
+				configs = append(configs, n.IPConfiguration{ID: config.ID})
+			}
+		}
+	}
+
+	for _, serviceKey := range sortedKeys(f.services) {
+		for _, config := range *f.services[serviceKey].IPConfigurations {
+			if strings.EqualFold(to.String(config.Subnet.ID), to.String(subnet.ID)) {
+				configs = append(configs, n.IPConfiguration{ID: config.ID})
+			}
+		}
+	}
+
+	properties.IPConfigurations = &configs
+	subnet.SubnetPropertiesFormat = &properties
+	return subnet
+}
+
+// renderPrivateLinkService is a private link service with the connections of its endpoints
+func (f *AzContext) renderPrivateLinkService(key string) n.PrivateLinkService {
+	pls := *f.services[key]
+	properties := *pls.PrivateLinkServiceProperties
+
+	connections := []n.PrivateEndpointConnection{}
+	for _, conn := range f.serviceConnections(key) {
+		connections = append(connections, f.renderConnection(to.String(pls.ID), conn))
+	}
+
+	properties.PrivateEndpointConnections = &connections
+	pls.PrivateLinkServiceProperties = &properties
+	return pls
+}
+
+// renderConnection is a connection as the private link service sees it
+func (f *AzContext) renderConnection(serviceID string, conn *connection) n.PrivateEndpointConnection {
+	return n.PrivateEndpointConnection{
+		ID:   to.StringPtr(serviceID + "/privateEndpointConnections/" + conn.name),
+		Name: to.StringPtr(conn.name),
+		Type: to.StringPtr("Microsoft.Network/privateLinkServices/privateEndpointConnections"),
+		PrivateEndpointConnectionProperties: &n.PrivateEndpointConnectionProperties{
+			PrivateEndpoint:                   &n.PrivateEndpoint{ID: to.StringPtr(conn.endpointID)},
+			PrivateLinkServiceConnectionState: conn.state(),
+			ProvisioningState:                 succeeded,
+		},
+	}
+}
+
+// renderPrivateEndpoint is an endpoint with the state of its connection
+func (f *AzContext) renderPrivateEndpoint(key string) n.PrivateEndpoint {
+	ep := *f.endpoints[key]
+	properties := *ep.PrivateEndpointProperties
+
+	conn, found := f.connections[key]
+
+	for _, list := range []**[]n.PrivateLinkServiceConnection{&properties.ManualPrivateLinkServiceConnections, &properties.PrivateLinkServiceConnections} {
+		if *list == nil {
+			continue
+		}
+
+		connections := []n.PrivateLinkServiceConnection{}
+		for _, item := range **list {
+			connectionProperties := *item.PrivateLinkServiceConnectionProperties
+			if found {
+				connectionProperties.PrivateLinkServiceConnectionState = conn.state()
+			}
+			connectionProperties.ProvisioningState = succeeded
+			item.PrivateLinkServiceConnectionProperties = &connectionProperties
+			item.ID = to.StringPtr(to.String(ep.ID) + "/privateLinkServiceConnections/" + to.String(item.Name))
+			connections = append(connections, item)
+		}
+		*list = &connections
+	}
+
+	ep.PrivateEndpointProperties = &properties
+	return ep
+}
+
+func (c *connection) state() *n.PrivateLinkServiceConnectionState {
+	actions := "None"
+	if c.status == pending {
+		actions = "Approve"
+	}
+
+	return &n.PrivateLinkServiceConnectionState{
+		Status:          to.StringPtr(c.status),
+		Description:     to.StringPtr(c.description),
+		ActionsRequired: to.StringPtr(actions),
+	}
+}
+
+func success(resource interface{}) response {
+	return response{status: http.StatusOK, body: document(resource)}
+}
+
+func list(values []interface{}) response {
+	if values == nil {
+		values = []interface{}{}
+	}
+	return response{status: http.StatusOK, body: map[string]interface{}{"value": values}}
+}
+
+func notFound(r request) response {
+	return failure(http.StatusNotFound, "ResourceNotFound", fmt.Sprintf("The Resource '%v' was not found.", r.id))
+}
+
+func unsupported(req *http.Request) response {
+	return failure(http.StatusBadRequest, "UnsupportedRequest", fmt.Sprintf("The fake ARM backend does not serve %v %v", req.Method, req.URL.Path))
+}
+
+func failure(status int, code string, message string) response {
+	return response{status: status, body: errorBody(code, message)}
+}
+
+func errorBody(code string, message string) map[string]interface{} {
+	return map[string]interface{}{"error": map[string]interface{}{"code": code, "message": message}}
+}
+
+// errorCode is the code ARM answers a failed request with
+func errorCode(status int) string {
+	switch status {
+	case http.StatusForbidden:
+		return "AuthorizationFailed"
+	case http.StatusNotFound:
+		return "ResourceNotFound"
+	case http.StatusTooManyRequests:
+		return "TooManyRequests"
+	}
+	return strings.ReplaceAll(http.StatusText(status), " ", "")
+}
+
+// retryNow asks the client to poll again right away instead of waiting the default polling delay
+func retryNow() http.Header {
+	header := http.Header{}
+	header.Set("Retry-After", "0")
+	return header
+}
+
+// sortedKeys returns the keys of a map of resources in order
+func sortedKeys(resources interface{}) []string {
+	var keys []string
+	for _, key := range reflect.ValueOf(resources).MapKeys() {
+		keys = append(keys, key.String())
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// document encodes a resource the way ARM returns it. The SDK leaves read-only properties like
+// provisioningState out of its JSON, so the resource is walked along its json tags instead
+func document(resource interface{}) interface{} {
+	return encode(reflect.ValueOf(resource))
+}
+
+func encode(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return encode(v.Elem())
+
+	case reflect.Struct:
+		fields := map[string]interface{}{}
+
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+
+			if name == "-" || name == "" || (field.PkgPath != "" && !field.Anonymous) {
+				continue
+			}
+
+			if value := encode(v.Field(i)); value != nil {
+				fields[name] = value
+			}
+		}
+		return fields
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+
+		values := []interface{}{}
+		for i := 0; i < v.Len(); i++ {
+			values = append(values, encode(v.Index(i)))
+		}
+		return values
+
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+
+		values := map[string]interface{}{}
+		for _, key := range v.MapKeys() {
+			values[fmt.Sprint(key.Interface())] = encode(v.MapIndex(key))
+		}
+		return values
+
+	case reflect.String:
+		if v.Len() == 0 {
+			return nil
+		}
+		return v.String()
+	}
+
+	return v.Interface()
+}
+
+// decode reads a document into a resource of the SDK
+func decode(doc interface{}, resource interface{}) {
+	content, err := json.Marshal(doc)
+	if err == nil {
+		err = json.Unmarshal(content, resource)
+	}
+
+	//Documents are built from resources of the SDK, so they always read back
+	if err != nil {
+		panic(err)
+	}
+}
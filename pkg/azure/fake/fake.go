@@ -0,0 +1,540 @@
+package fake
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	n "github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-05-01/network"
+	"github.com/Azure/azure-sdk-for-go/services/privatedns/mgmt/2018-09-01/privatedns"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/garvinmsft/auto-private-link/pkg/azure"
+	"github.com/garvinmsft/auto-private-link/pkg/config"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	//SubscriptionID is the subscription of the controller when the config names none
+	SubscriptionID = "00000000-0000-0000-0000-000000000000"
+
+	//Location is the region every fake resource is created in
+	Location = "fakeregion"
+
+	baseURI = "https://management.azure.fake/"
+
+	approved     = "Approved"
+	pending      = "Pending"
+	disconnected = "Disconnected"
+	succeeded    = "Succeeded"
+	updating     = "Updating"
+	deleting     = "Deleting"
+)
+
+var _ azure.AzContext = &AzContext{}
+
+// Action is a request the controllers sent to the fake ARM backend
+type Action struct {
+	Verb     string
+	Resource string
+	Name     string
+}
+
+// AzContext is the real azure.AzContext talking to an in-memory stand-in for ARM. The stand-in keeps vnets, subnets,
+// load balancers, private link services, private endpoints, their network interfaces and private DNS records,
+// so the controllers are exercised against the same code that runs against Azure.
+// Resources are keyed by their resource ID, ignoring case like ARM does.
+type AzContext struct {
+	azure.AzContext
+
+	//OperationPolls is the number of times a long running operation answers InProgress before it completes.
+	//With 0 operations complete in the response to the request that started them
+	OperationPolls int
+
+	cfg            config.Config
+	subscriptionID string
+	recorder       *recorder
+
+	mu            sync.Mutex
+	actions       []Action
+	errors        map[string]int
+	vnets         map[string]*n.VirtualNetwork
+	subnets       map[string]*n.Subnet
+	loadBalancers map[string]*n.LoadBalancer
+	services      map[string]*n.PrivateLinkService
+	endpoints     map[string]*n.PrivateEndpoint
+	interfaces    map[string]*n.Interface
+	connections   map[string]*connection
+	zones         map[string]*privatedns.PrivateZone
+	records       map[string]*privatedns.RecordSet
+	operations    map[string]*operation
+	tenants       map[string]string
+
+	//sequence numbers the aliases, network interfaces, connections and operations ARM names with a GUID
+	sequence int
+}
+
+// connection is the connection of a private endpoint to a private link service, seen from both sides
+type connection struct {
+	name           string
+	endpointID     string
+	service        string
+	target         string
+	manual         bool
+	requestMessage string
+	groupIDs       []string
+	status         string
+	description    string
+}
+
+// operation is a long running operation that completes once polled OperationPolls times
+type operation struct {
+	remaining int
+	complete  func()
+}
+
+// NewAzContext creates a fake ARM backend holding the configured vnet and the azure.AzContext using it
+func NewAzContext(cfg config.Config) *AzContext {
+
+	f := &AzContext{
+		cfg:            cfg,
+		subscriptionID: cfg.SubscriptionID,
+		recorder:       &recorder{},
+		errors:         map[string]int{},
+		vnets:          map[string]*n.VirtualNetwork{},
+		subnets:        map[string]*n.Subnet{},
+		loadBalancers:  map[string]*n.LoadBalancer{},
+		services:       map[string]*n.PrivateLinkService{},
+		endpoints:      map[string]*n.PrivateEndpoint{},
+		interfaces:     map[string]*n.Interface{},
+		connections:    map[string]*connection{},
+		zones:          map[string]*privatedns.PrivateZone{},
+		records:        map[string]*privatedns.RecordSet{},
+		operations:     map[string]*operation{},
+		tenants:        map[string]string{},
+	}
+
+	if f.subscriptionID == "" {
+		f.subscriptionID = SubscriptionID
+	}
+
+	f.AddVirtualNetwork(cfg.VnetResourceGroupName, cfg.VnetName)
+
+	azCtx, err := azure.NewAzContextWithClient(cfg, f.recorder, baseURI, autorest.NullAuthorizer{}, f.subscriptionID,
+		&http.Client{Transport: transport{f}})
+
+	//The configured vnet exists, so reading it can't fail
+	if err != nil {
+		panic(err)
+	}
+
+	f.AzContext = azCtx
+	f.ClearActions()
+
+	return f
+}
+
+// AddFrontendIPConfiguration adds a frontend with the given private ip to the configured load balancer
+func (f *AzContext) AddFrontendIPConfiguration(ip string) string {
+	return f.AddLoadBalancerFrontend(f.cfg.LoadBalancerResourceGroup, f.cfg.LoadBalancerName, ip)
+}
+
+// AddLoadBalancerFrontend adds a frontend with the given private ip to a load balancer in any resource group
+func (f *AzContext) AddLoadBalancerFrontend(resourceGroup string, loadBalancerName string, ip string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := resourceID(f.subscriptionID, resourceGroup, "loadBalancers", loadBalancerName)
+
+	lb, ok := f.loadBalancers[strings.ToLower(id)]
+	if !ok {
+		lb = &n.LoadBalancer{
+			ID:       to.StringPtr(id),
+			Name:     to.StringPtr(loadBalancerName),
+			Location: to.StringPtr(Location),
+			LoadBalancerPropertiesFormat: &n.LoadBalancerPropertiesFormat{
+				FrontendIPConfigurations: &[]n.FrontendIPConfiguration{},
+				ProvisioningState:        succeeded,
+			},
+		}
+		f.loadBalancers[strings.ToLower(id)] = lb
+	}
+
+	name := fmt.Sprintf("frontend-%v", len(*lb.FrontendIPConfigurations)+1)
+	frontends := append(*lb.FrontendIPConfigurations, n.FrontendIPConfiguration{
+		ID:   to.StringPtr(id + "/frontendIPConfigurations/" + name),
+		Name: to.StringPtr(name),
+		FrontendIPConfigurationPropertiesFormat: &n.FrontendIPConfigurationPropertiesFormat{
+			PrivateIPAddress:          to.StringPtr(ip),
+			PrivateIPAllocationMethod: n.IPAllocationMethodDynamic,
+			ProvisioningState:         succeeded,
+		},
+	})
+	lb.FrontendIPConfigurations = &frontends
+
+	return *frontends[len(frontends)-1].ID
+}
+
+// AddVirtualNetwork adds a vnet with the given address space, or extends the address space of an existing one
+func (f *AzContext) AddVirtualNetwork(resourceGroup string, name string, addressSpace ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	vnet := f.virtualNetwork(f.subscriptionID, resourceGroup, name)
+	prefixes := append(*vnet.AddressSpace.AddressPrefixes, addressSpace...)
+	vnet.AddressSpace.AddressPrefixes = &prefixes
+}
+
+// AddSubnet adds a subnet to a vnet of the subscription of the controller, creating the vnet if needed
+func (f *AzContext) AddSubnet(resourceGroup string, vnetName string, name string, prefix string) n.Subnet {
+	return f.AddSubnetInSubscription(f.subscriptionID, resourceGroup, vnetName, name, prefix)
+}
+
+// AddSubnetInSubscription adds a subnet to a vnet of any subscription, creating the vnet if needed
+func (f *AzContext) AddSubnetInSubscription(subscriptionID string, resourceGroup string, vnetName string, name string, prefix string) n.Subnet {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	vnet := f.virtualNetwork(subscriptionID, resourceGroup, vnetName)
+	id := *vnet.ID + "/subnets/" + name
+
+	f.subnets[strings.ToLower(id)] = &n.Subnet{
+		ID:   to.StringPtr(id),
+		Name: to.StringPtr(name),
+		SubnetPropertiesFormat: &n.SubnetPropertiesFormat{
+			AddressPrefix:                     to.StringPtr(prefix),
+			PrivateEndpointNetworkPolicies:    n.VirtualNetworkPrivateEndpointNetworkPoliciesDisabled,
+			PrivateLinkServiceNetworkPolicies: n.VirtualNetworkPrivateLinkServiceNetworkPoliciesDisabled,
+			ProvisioningState:                 succeeded,
+		},
+	}
+
+	var subnet n.Subnet
+	decode(document(f.renderSubnet(strings.ToLower(id))), &subnet)
+	return subnet
+}
+
+// AddPrivateDNSZone adds a private DNS zone to a resource group of the subscription of the controller
+func (f *AzContext) AddPrivateDNSZone(resourceGroup string, zone string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := fmt.Sprintf("/subscriptions/%v/resourceGroups/%v/providers/Microsoft.Network/privateDnsZones/%v", f.subscriptionID, resourceGroup, zone)
+
+	f.zones[strings.ToLower(id)] = &privatedns.PrivateZone{
+		ID:       to.StringPtr(id),
+		Name:     to.StringPtr(zone),
+		Location: to.StringPtr("global"),
+	}
+}
+
+// SetError makes every request with the given verb (get, list, put or delete) on the given resource type
+// fail with statusCode. A statusCode of 0 clears it. The SDK retries 408, 429 and 5xx answers after 30 seconds,
+// so tests use other codes.
+func (f *AzContext) SetError(verb string, resource string, statusCode int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if statusCode == 0 {
+		delete(f.errors, verb+"/"+resource)
+		return
+	}
+	f.errors[verb+"/"+resource] = statusCode
+}
+
+// SetConnectionState changes the state of the connection of an endpoint as if the owner of its private link service acted on it
+func (f *AzContext) SetConnectionState(resourceGroup string, endpointName string, status string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ep, ok := f.findEndpoint(resourceGroup, endpointName)
+	if !ok {
+		return fmt.Errorf("private endpoint %v/%v does not exist", resourceGroup, endpointName)
+	}
+
+	conn, ok := f.connections[strings.ToLower(*ep.ID)]
+	if !ok {
+		return fmt.Errorf("private endpoint %v/%v has no connection", resourceGroup, endpointName)
+	}
+
+	conn.status = status
+	return nil
+}
+
+// SetEndpointProvisioningState changes the provisioning state of an endpoint, e.g. to Failed
+func (f *AzContext) SetEndpointProvisioningState(resourceGroup string, endpointName string, state string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ep, ok := f.findEndpoint(resourceGroup, endpointName)
+	if !ok {
+		return fmt.Errorf("private endpoint %v/%v does not exist", resourceGroup, endpointName)
+	}
+
+	ep.ProvisioningState = n.ProvisioningState(state)
+	return nil
+}
+
+// AddExternalConnection adds a connection from a private endpoint outside the cluster to a private link service.
+// Like in ARM it is approved when the subscription of the endpoint is on the auto approval list, and pending otherwise
+func (f *AzContext) AddExternalConnection(plsName string, endpointID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pls, ok := f.services[strings.ToLower(resourceID(f.subscriptionID, f.cfg.LoadBalancerResourceGroup, "privateLinkServices", plsName))]
+	if !ok {
+		return fmt.Errorf("private link service %v does not exist", plsName)
+	}
+
+	f.connections[strings.ToLower(endpointID)] = &connection{
+		name:       fmt.Sprintf("%v.%v", endpointID[strings.LastIndex(endpointID, "/")+1:], plsName),
+		endpointID: endpointID,
+		service:    strings.ToLower(*pls.ID),
+		target:     *pls.ID,
+		status:     autoApprovalStatus(pls, endpointID),
+	}
+	return nil
+}
+
+// SetTenant sets the Azure AD tenant a subscription belongs to
+func (f *AzContext) SetTenant(subscriptionID string, tenantID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.tenants[strings.ToLower(subscriptionID)] = tenantID
+}
+
+// PrivateLinkService returns the private link service with the given name as ARM returns it
+func (f *AzContext) PrivateLinkService(name string) (n.PrivateLinkService, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var pls n.PrivateLinkService
+	id := strings.ToLower(resourceID(f.subscriptionID, f.cfg.LoadBalancerResourceGroup, "privateLinkServices", name))
+
+	if _, ok := f.services[id]; !ok {
+		return pls, false
+	}
+
+	decode(document(f.renderPrivateLinkService(id)), &pls)
+	return pls, true
+}
+
+// PrivateEndpoint returns the private endpoint with the given name in a resource group of any subscription as ARM returns it
+func (f *AzContext) PrivateEndpoint(resourceGroup string, name string) (n.PrivateEndpoint, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var result n.PrivateEndpoint
+
+	ep, ok := f.findEndpoint(resourceGroup, name)
+	if !ok {
+		return result, false
+	}
+
+	decode(document(f.renderPrivateEndpoint(strings.ToLower(*ep.ID))), &result)
+	return result, true
+}
+
+// DNSRecord returns the private DNS record with the given resource ID
+func (f *AzContext) DNSRecord(id string) (privatedns.RecordSet, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var result privatedns.RecordSet
+
+	record, ok := f.records[strings.ToLower(id)]
+	if !ok {
+		return result, false
+	}
+
+	decode(document(record), &result)
+	return result, true
+}
+
+// Subnet returns the subnet with the given name in the subscription of the controller as ARM returns it
+func (f *AzContext) Subnet(resourceGroup string, vnetName string, name string) (n.Subnet, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var subnet n.Subnet
+	key := strings.ToLower(resourceID(f.subscriptionID, resourceGroup, "virtualNetworks", vnetName) + "/subnets/" + name)
+
+	if _, ok := f.subnets[key]; !ok {
+		return subnet, false
+	}
+
+	decode(document(f.renderSubnet(key)), &subnet)
+	return subnet, true
+}
+
+// Actions returns every request sent to the fake backend in order
+func (f *AzContext) Actions() []Action {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	actions := make([]Action, len(f.actions))
+	copy(actions, f.actions)
+	return actions
+}
+
+// ClearActions forgets the recorded requests
+func (f *AzContext) ClearActions() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.actions = nil
+}
+
+// Events returns the events the azure context recorded, as "type reason message"
+func (f *AzContext) Events() []string {
+	return f.recorder.list()
+}
+
+// virtualNetwork returns a vnet, creating it without address space if needed
+func (f *AzContext) virtualNetwork(subscriptionID string, resourceGroup string, name string) *n.VirtualNetwork {
+	id := resourceID(subscriptionID, resourceGroup, "virtualNetworks", name)
+
+	if vnet, ok := f.vnets[strings.ToLower(id)]; ok {
+		return vnet
+	}
+
+	vnet := &n.VirtualNetwork{
+		ID:       to.StringPtr(id),
+		Name:     to.StringPtr(name),
+		Location: to.StringPtr(Location),
+		VirtualNetworkPropertiesFormat: &n.VirtualNetworkPropertiesFormat{
+			AddressSpace:      &n.AddressSpace{AddressPrefixes: &[]string{}},
+			ProvisioningState: succeeded,
+		},
+	}
+	f.vnets[strings.ToLower(id)] = vnet
+	return vnet
+}
+
+// findEndpoint finds an endpoint by resource group and name in any subscription
+func (f *AzContext) findEndpoint(resourceGroup string, name string) (*n.PrivateEndpoint, bool) {
+	suffix := strings.ToLower(fmt.Sprintf("/resourceGroups/%v/providers/Microsoft.Network/privateEndpoints/%v", resourceGroup, name))
+
+	for id, ep := range f.endpoints {
+		if strings.HasSuffix(id, suffix) {
+			return ep, true
+		}
+	}
+	return nil, false
+}
+
+// autoApprovalStatus is the state ARM gives a new automatic connection: approved when the subscription
+// of the endpoint is on the auto approval list of the private link service
+func autoApprovalStatus(pls *n.PrivateLinkService, endpointID string) string {
+	if pls.PrivateLinkServiceProperties == nil || pls.AutoApproval == nil || pls.AutoApproval.Subscriptions == nil {
+		return pending
+	}
+
+	for _, item := range *pls.AutoApproval.Subscriptions {
+		if strings.HasPrefix(strings.ToLower(endpointID), "/subscriptions/"+strings.ToLower(item)+"/") {
+			return approved
+		}
+	}
+	return pending
+}
+
+// addressInUse reports whether an address of a subnet is held by a network interface or by a NAT ip configuration
+// of a private link service other than except
+func (f *AzContext) addressInUse(subnetID string, ip string, except string) bool {
+	for _, nic := range f.interfaces {
+		for _, config := range *nic.IPConfigurations {
+			if strings.EqualFold(to.String(config.Subnet.ID), subnetID) && net.ParseIP(to.String(config.PrivateIPAddress)).Equal(net.ParseIP(ip)) {
+				return true
+			}
+		}
+	}
+
+	for key, pls := range f.services {
+		if key == except {
+			continue
+		}
+
+		for _, config := range *pls.IPConfigurations {
+			if strings.EqualFold(to.String(config.Subnet.ID), subnetID) && net.ParseIP(to.String(config.PrivateIPAddress)).Equal(net.ParseIP(ip)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// allocateIP hands out the first free address of a subnet, skipping the ones Azure reserves and the ones taken by the request
+func (f *AzContext) allocateIP(subnetID string, taken []string, except string) (string, bool) {
+	subnet, ok := f.subnets[strings.ToLower(subnetID)]
+	if !ok {
+		return "", false
+	}
+
+	_, cidr, err := net.ParseCIDR(to.String(subnet.AddressPrefix))
+	if err != nil || cidr.IP.To4() == nil {
+		return "", false
+	}
+
+	ones, bits := cidr.Mask.Size()
+	start := binary.BigEndian.Uint32(cidr.IP.To4())
+
+	for offset := uint32(4); offset < uint32(1)<<uint(bits-ones)-1; offset++ {
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, start+offset)
+
+		if !f.addressInUse(subnetID, ip.String(), except) && !contains(taken, ip.String()) {
+			return ip.String(), true
+		}
+	}
+
+	return "", false
+}
+
+func contains(values []string, value string) bool {
+	for _, item := range values {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func resourceID(subscriptionID string, resourceGroup string, resourceType string, name string) string {
+	return fmt.Sprintf("/subscriptions/%v/resourceGroups/%v/providers/Microsoft.Network/%v/%v",
+		subscriptionID, resourceGroup, resourceType, name)
+}
+
+// recorder keeps the events recorded by the azure context
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) Event(object runtime.Object, eventtype string, reason string, message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, fmt.Sprintf("%v %v %v", eventtype, reason, message))
+}
+
+func (r *recorder) Eventf(object runtime.Object, eventtype string, reason string, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *recorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype string, reason string, messageFmt string, args ...interface{}) {
+	r.Eventf(object, eventtype, reason, messageFmt, args...)
+}
+
+func (r *recorder) list() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := make([]string, len(r.events))
+	copy(events, r.events)
+	return events
+}
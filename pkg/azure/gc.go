@@ -0,0 +1,238 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/privatedns/mgmt/2018-09-01/privatedns"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/to"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog"
+)
+
+const (
+	//PrivateLinkServiceResource is the type of private link services, owned by kubernetes services
+	PrivateLinkServiceResource = "Microsoft.Network/privateLinkServices"
+
+	//PrivateEndpointResource is the type of private endpoints, owned by service connections
+	PrivateEndpointResource = "Microsoft.Network/privateEndpoints"
+
+	//PrivateDNSRecordResource is the type of private DNS A records, owned by service connections
+	PrivateDNSRecordResource = "Microsoft.Network/privateDnsZones/A"
+)
+
+//OwnedResource is an Azure resource tagged as created by this cluster
+type OwnedResource struct {
+	ID string
+	Type string
+	ResourceGroup string
+	Name string
+	Namespace string
+	OwnerName string
+	OwnerUID string
+}
+
+//ListOwnedResources lists the private link services, private endpoints and private DNS A records in the garbage collection
+//resource groups whose tags say they were created by this cluster. Resource groups of other subscriptions
+//are written as <subscription id>/<resource group> and only searched for private endpoints and DNS records.
+//A resource group that cannot be listed does not stop the others: the resources that were found are returned
+//with an error naming the resource groups that failed.
+func (azCtx armContext) ListOwnedResources() ([]OwnedResource, error) {
+
+	var owned []OwnedResource
+	var errs []error
+
+	for _, entry := range azCtx.cfg.GarbageCollectionResourceGroups {
+
+		subscriptionID, rg := azCtx.SubscriptionID, entry
+		if parts := strings.SplitN(entry, "/", 2); len(parts) == 2 {
+			subscriptionID, rg = parts[0], parts[1]
+		}
+
+		resources, err := azCtx.listOwnedResources(subscriptionID, rg)
+		owned = append(owned, resources...)
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Could not list the resources of resource group %v: %v", entry, err))
+		}
+	}
+
+	return owned, utilerrors.NewAggregate(errs)
+}
+
+//listOwnedResources lists the owned resources of one resource group. Private DNS records are best effort,
+//as the resource group may hold no zones or the controller may not be allowed to read them
+func (azCtx armContext) listOwnedResources(subscriptionID string, rg string) ([]OwnedResource, error) {
+
+	ctx := context.TODO()
+	var owned []OwnedResource
+	var errs []error
+
+	endpoints, err := azCtx.clientsFor(subscriptionID).PrivateEndpointsClient.ListComplete(ctx, rg)
+
+	for err == nil && endpoints.NotDone() {
+		ep := endpoints.Value()
+
+		if resource, ok := NewOwnedResource(azCtx.cfg.ClusterName, rg, PrivateEndpointResource, to.String(ep.ID), to.String(ep.Name), ep.Tags); ok {
+			owned = append(owned, resource)
+		}
+
+		err = endpoints.NextWithContext(ctx)
+	}
+
+	if err != nil {
+		errs = append(errs, fmt.Errorf("private endpoints: %v", err))
+	}
+
+	records, err := azCtx.listOwnedDNSRecords(subscriptionID, rg)
+	owned = append(owned, records...)
+
+	if err != nil {
+		klog.Warningf("Garbage collection could not list the private DNS records of resource group %v: %v", rg, err)
+	}
+
+	//Private link services are only created in the controller's subscription
+	if !strings.EqualFold(subscriptionID, azCtx.SubscriptionID) {
+		return owned, utilerrors.NewAggregate(errs)
+	}
+
+	services, err := azCtx.PrivateLinkServicesClient.ListComplete(ctx, rg)
+
+	for err == nil && services.NotDone() {
+		pls := services.Value()
+
+		if resource, ok := NewOwnedResource(azCtx.cfg.ClusterName, rg, PrivateLinkServiceResource, to.String(pls.ID), to.String(pls.Name), pls.Tags); ok {
+			owned = append(owned, resource)
+		}
+
+		err = services.NextWithContext(ctx)
+	}
+
+	if err != nil {
+		errs = append(errs, fmt.Errorf("private link services: %v", err))
+	}
+
+	return owned, utilerrors.NewAggregate(errs)
+}
+
+//RemoveOwnedResource deletes a resource found by ListOwnedResources
+func (azCtx armContext) RemoveOwnedResource(resource OwnedResource) error {
+
+	ctx := context.TODO()
+
+	switch resource.Type {
+	case PrivateLinkServiceResource:
+		pls, err := azCtx.PrivateLinkServicesClient.Get(ctx, resource.ResourceGroup, resource.Name, "")
+
+		if err != nil {
+			if pls.Response.Response != nil && pls.Response.Response.StatusCode == 404 {
+				return nil
+			}
+			return err
+		}
+
+		return azCtx.deletePrivateLinkService(resource.ResourceGroup, pls)
+
+	case PrivateEndpointResource:
+		id, err := azure.ParseResourceID(resource.ID)
+
+		if err != nil {
+			return err
+		}
+
+		client := azCtx.clientsFor(id.SubscriptionID).PrivateEndpointsClient
+		future, err := client.Delete(ctx, resource.ResourceGroup, resource.Name)
+
+		if err != nil {
+			return err
+		}
+
+		return future.WaitForCompletionRef(ctx, client.Client)
+
+	case PrivateDNSRecordResource:
+		record, err := ParseDNSRecordID(resource.ID)
+
+		if err != nil {
+			return err
+		}
+
+		response, err := azCtx.clientsFor(record.SubscriptionID).RecordSetsClient.Delete(ctx, record.ResourceGroup, record.Zone, privatedns.A, record.Name, "")
+
+		if err != nil && !isNotFound(response.Response) {
+			return err
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("Cannot remove resource %v of unknown type %v", resource.ID, resource.Type)
+}
+
+//listOwnedDNSRecords lists the A records of the private DNS zones in a resource group whose metadata says they were created by this cluster
+func (azCtx armContext) listOwnedDNSRecords(subscriptionID string, rg string) ([]OwnedResource, error) {
+
+	ctx := context.TODO()
+	clients := azCtx.clientsFor(subscriptionID)
+	var owned []OwnedResource
+
+	zones, err := clients.PrivateZonesClient.ListByResourceGroupComplete(ctx, rg, nil)
+
+	if err != nil {
+		return owned, err
+	}
+
+	for zones.NotDone() {
+		zone := to.String(zones.Value().Name)
+
+		records, err := clients.RecordSetsClient.ListByTypeComplete(ctx, rg, zone, privatedns.A, nil, "")
+
+		if err != nil {
+			return owned, err
+		}
+
+		for records.NotDone() {
+			record := records.Value()
+
+			if record.RecordSetProperties != nil {
+				if resource, ok := NewOwnedResource(azCtx.cfg.ClusterName, rg, PrivateDNSRecordResource, to.String(record.ID), to.String(record.Name), DNSMetadataTags(record.Metadata)); ok {
+					owned = append(owned, resource)
+				}
+			}
+
+			if err := records.NextWithContext(ctx); err != nil {
+				return owned, err
+			}
+		}
+
+		if err := zones.NextWithContext(ctx); err != nil {
+			return owned, err
+		}
+	}
+
+	return owned, nil
+}
+
+//NewOwnedResource builds an OwnedResource from the tags of a resource, returning false
+//when the resource is not tagged as created by the given cluster
+func NewOwnedResource(cluster string, resourceGroup string, resourceType string, id string, name string, tags map[string]*string) (OwnedResource, bool) {
+
+	resource := OwnedResource{
+		ID: id,
+		Type: resourceType,
+		ResourceGroup: resourceGroup,
+		Name: name,
+	}
+
+	if owner, ok := tagValue(tags, ClusterTag); !ok || !strings.EqualFold(owner, cluster) {
+		return resource, false
+	}
+
+	var hasNamespace, hasName bool
+	resource.Namespace, hasNamespace = tagValue(tags, NamespaceTag)
+	resource.OwnerName, hasName = tagValue(tags, NameTag)
+	resource.OwnerUID, _ = tagValue(tags, UIDTag)
+
+	return resource, hasNamespace && hasName
+}
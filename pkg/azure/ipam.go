@@ -0,0 +1,354 @@
+package azure
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+
+	n "github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-05-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/garvinmsft/auto-private-link/pkg/metrics"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	//NatSubnetFull is the reason reported when the NAT subnet has too few free addresses for the NAT ip configurations of a private link service
+	NatSubnetFull = "NatSubnetFull"
+
+	//NatSubnetPrefixUnavailable is the reason reported when the NAT subnet can't be created because its prefix is taken or none is free
+	NatSubnetPrefixUnavailable = "NatSubnetPrefixUnavailable"
+
+	natSubnetCapacityLow = "NatSubnetCapacityLow"
+
+	//azureReservedAddresses are the addresses Azure keeps in every subnet: the network, the gateway, 2 for DNS and the broadcast
+	azureReservedAddresses = 5
+)
+
+//PrivateLinkServiceError is a failed reconcile with the reason the service reports in its condition
+type PrivateLinkServiceError struct {
+	Reason string
+	Err    error
+}
+
+func (e *PrivateLinkServiceError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PrivateLinkServiceError) Unwrap() error {
+	return e.Err
+}
+
+//SubnetCapacity counts the addresses of a subnet
+type SubnetCapacity struct {
+	//Usable is the number of addresses left once Azure took the ones it reserves
+	Usable int
+
+	//Used is the number of addresses held by ip configurations
+	Used int
+}
+
+//NewSubnetCapacity counts the usable addresses of the prefixes of a subnet of which used are taken.
+//IPv6 prefixes are too large to run out and count as the largest int32
+func NewSubnetCapacity(prefixes []string, used int) SubnetCapacity {
+
+	capacity := SubnetCapacity{Used: used}
+
+	for _, prefix := range prefixes {
+		_, cidr, err := net.ParseCIDR(prefix)
+
+		if err != nil {
+			continue
+		}
+
+		ones, bits := cidr.Mask.Size()
+
+		if bits-ones >= 31 {
+			capacity.Usable = math.MaxInt32
+			return capacity
+		}
+
+		if size := 1<<uint(bits-ones) - azureReservedAddresses; size > 0 {
+			capacity.Usable += size
+		}
+	}
+
+	return capacity
+}
+
+//Free is the number of usable addresses no ip configuration holds
+func (c SubnetCapacity) Free() int {
+	if c.Used > c.Usable {
+		return 0
+	}
+	return c.Usable - c.Used
+}
+
+//Low reports whether at least percent of the usable addresses are used
+func (c SubnetCapacity) Low(percent int) bool {
+	return c.Usable > 0 && int64(c.Used)*100 >= int64(c.Usable)*int64(percent)
+}
+
+//CheckNatCapacity fails when the NAT subnet has fewer free addresses than needed
+func CheckNatCapacity(subnetName string, capacity SubnetCapacity, needed int) error {
+
+	if needed <= capacity.Free() {
+		return nil
+	}
+
+	return &PrivateLinkServiceError{
+		Reason: NatSubnetFull,
+		Err: fmt.Errorf("NAT subnet %v has %v free addresses (%v of %v used), the private link service needs %v more",
+			subnetName, capacity.Free(), capacity.Used, capacity.Usable, needed),
+	}
+}
+
+//NatCapacityCrossesWarning reports whether taking addresses moves a subnet from below to at or above percent used,
+//so the warning is given once instead of on every resync of a service that already holds its addresses
+func NatCapacityCrossesWarning(before SubnetCapacity, after SubnetCapacity, percent int) bool {
+	return after.Used > before.Used && !before.Low(percent) && after.Low(percent)
+}
+
+//NatIPsNeeded is the number of NAT ip configurations of desired that actual does not have yet, and will take a new address
+func NatIPsNeeded(desired n.PrivateLinkService, actual *n.PrivateLinkService) int {
+
+	needed := 0
+
+	for _, config := range natIPConfigurations(desired) {
+		if actual == nil || !hasIPConfiguration(*actual, config) {
+			needed++
+		}
+	}
+
+	return needed
+}
+
+func natIPConfigurations(pls n.PrivateLinkService) []n.PrivateLinkServiceIPConfiguration {
+	if pls.PrivateLinkServiceProperties == nil || pls.IPConfigurations == nil {
+		return nil
+	}
+	return *pls.IPConfigurations
+}
+
+//hasIPConfiguration reports whether pls keeps the address of the configuration: same name, same subnet and,
+//for static configurations, the same ip
+func hasIPConfiguration(pls n.PrivateLinkService, config n.PrivateLinkServiceIPConfiguration) bool {
+
+	for _, item := range natIPConfigurations(pls) {
+		if to.String(item.Name) != to.String(config.Name) ||
+			item.PrivateLinkServiceIPConfigurationProperties == nil ||
+			config.PrivateLinkServiceIPConfigurationProperties == nil ||
+			item.Subnet == nil || config.Subnet == nil ||
+			!strings.EqualFold(to.String(item.Subnet.ID), to.String(config.Subnet.ID)) {
+			continue
+		}
+
+		if config.PrivateIPAllocationMethod != n.IPAllocationMethodStatic {
+			return true
+		}
+
+		return sameIP(to.String(item.PrivateIPAddress), to.String(config.PrivateIPAddress))
+	}
+
+	return false
+}
+
+//FreePrefix picks the first prefix of the given length in the address space of a vnet that overlaps none of the used prefixes
+func FreePrefix(addressSpace []string, used []string, length int) (string, error) {
+
+	if length < 1 || length > 32 {
+		return "", fmt.Errorf("%v is not an IPv4 prefix length", length)
+	}
+
+	size := uint64(1) << uint(32-length)
+
+	for _, space := range addressSpace {
+		start, end, ok := ipv4Range(space)
+
+		if !ok || end-start < size {
+			continue
+		}
+
+		for candidate := alignUp(start, size); candidate+size <= end; {
+			blockerEnd, overlaps := overlapping(used, candidate, candidate+size)
+
+			if !overlaps {
+				return fmt.Sprintf("%v/%v", ipv4(candidate), length), nil
+			}
+
+			//Skip past the prefix in the way, staying aligned to the requested size
+			candidate = alignUp(blockerEnd, size)
+		}
+	}
+
+	return "", &PrivateLinkServiceError{
+		Reason: NatSubnetPrefixUnavailable,
+		Err:    fmt.Errorf("No free /%v prefix is left in address space %v", length, strings.Join(addressSpace, ", ")),
+	}
+}
+
+//CheckPrefix validates that a prefix is a network address inside the address space of a vnet and overlaps none of the used prefixes.
+//IPv6 prefixes are left for ARM to check
+func CheckPrefix(addressSpace []string, used []string, prefix string) error {
+
+	ip, cidr, err := net.ParseCIDR(prefix)
+
+	if err != nil {
+		return err
+	}
+
+	if cidr.IP.To4() == nil {
+		return nil
+	}
+
+	if !ip.Equal(cidr.IP) {
+		return &PrivateLinkServiceError{
+			Reason: NatSubnetPrefixUnavailable,
+			Err:    fmt.Errorf("Prefix %v is not a network address, use %v", prefix, cidr),
+		}
+	}
+
+	start, end, _ := ipv4Range(prefix)
+
+	if _, overlaps := overlapping(used, start, end); overlaps {
+		return &PrivateLinkServiceError{
+			Reason: NatSubnetPrefixUnavailable,
+			Err:    fmt.Errorf("Prefix %v overlaps a subnet of the vnet", prefix),
+		}
+	}
+
+	for _, space := range addressSpace {
+		if spaceStart, spaceEnd, ok := ipv4Range(space); ok && spaceStart <= start && end <= spaceEnd {
+			return nil
+		}
+	}
+
+	return &PrivateLinkServiceError{
+		Reason: NatSubnetPrefixUnavailable,
+		Err:    fmt.Errorf("Prefix %v is outside address space %v", prefix, strings.Join(addressSpace, ", ")),
+	}
+}
+
+//overlapping finds a used IPv4 prefix overlapping [start, end) and returns where it ends
+func overlapping(used []string, start uint64, end uint64) (uint64, bool) {
+
+	for _, prefix := range used {
+		usedStart, usedEnd, ok := ipv4Range(prefix)
+
+		if ok && usedStart < end && start < usedEnd {
+			return usedEnd, true
+		}
+	}
+
+	return 0, false
+}
+
+//ipv4Range is the first address of an IPv4 prefix and the one after its last
+func ipv4Range(prefix string) (uint64, uint64, bool) {
+
+	_, cidr, err := net.ParseCIDR(prefix)
+
+	if err != nil || cidr.IP.To4() == nil {
+		return 0, 0, false
+	}
+
+	ones, bits := cidr.Mask.Size()
+	start := uint64(binary.BigEndian.Uint32(cidr.IP.To4()))
+
+	return start, start + uint64(1)<<uint(bits-ones), true
+}
+
+func alignUp(address uint64, size uint64) uint64 {
+	return (address + size - 1) / size * size
+}
+
+func ipv4(address uint64) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, uint32(address))
+	return ip
+}
+
+//vnetPrefixes reads the address space of the vnet of a NAT subnet and the prefixes of its subnets
+func (azCtx armContext) vnetPrefixes(natSubnet NatSubnet) ([]string, []string, error) {
+
+	vnet, err := azCtx.VnetClient.Get(context.TODO(), natSubnet.ResourceGroup, natSubnet.VnetName, "")
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var addressSpace, used []string
+
+	if vnet.VirtualNetworkPropertiesFormat == nil {
+		return addressSpace, used, nil
+	}
+
+	if vnet.AddressSpace != nil {
+		addressSpace = stringValues(vnet.AddressSpace.AddressPrefixes)
+	}
+
+	if vnet.Subnets != nil {
+		for _, subnet := range *vnet.Subnets {
+			used = append(used, subnetPrefixes(subnet)...)
+		}
+	}
+
+	return addressSpace, used, nil
+}
+
+//natSubnetPrefix is the prefix a missing NAT subnet is created with: the one given, once checked against the vnet,
+//or the first free one of the requested length
+func (azCtx armContext) natSubnetPrefix(natSubnet NatSubnet) (string, error) {
+
+	if natSubnet.Prefix == "" && natSubnet.PrefixLength == 0 {
+		return "", fmt.Errorf("NAT subnet %v does not exist in vnet %v/%v and no prefix was given to create it", natSubnet.Name, natSubnet.ResourceGroup, natSubnet.VnetName)
+	}
+
+	addressSpace, used, err := azCtx.vnetPrefixes(natSubnet)
+
+	if err != nil {
+		return "", err
+	}
+
+	if natSubnet.Prefix != "" {
+		return natSubnet.Prefix, CheckPrefix(addressSpace, used, natSubnet.Prefix)
+	}
+
+	return FreePrefix(addressSpace, used, natSubnet.PrefixLength)
+}
+
+//natSubnetCapacity counts the addresses of the NAT subnet. Every NIC and private link service ip configuration holds one
+func natSubnetCapacity(subnet n.Subnet) SubnetCapacity {
+
+	used := 0
+
+	if subnet.SubnetPropertiesFormat != nil && subnet.IPConfigurations != nil {
+		used = len(*subnet.IPConfigurations)
+	}
+
+	return NewSubnetCapacity(subnetPrefixes(subnet), used)
+}
+
+//checkNatCapacity refuses private link services the NAT subnet has no room for and warns when this one makes it run out.
+//The gauges follow the subnet as read, so a failed update does not count addresses that were never taken
+func (azCtx armContext) checkNatCapacity(service *v1.Service, subnet n.Subnet, needed int) error {
+
+	name := to.String(subnet.Name)
+	capacity := natSubnetCapacity(subnet)
+	metrics.SetNatSubnetCapacity(to.String(subnet.ID), capacity.Usable, capacity.Used)
+
+	if err := CheckNatCapacity(name, capacity, needed); err != nil {
+		azCtx.warningEvent(service, NatSubnetFull, err.Error())
+		return err
+	}
+
+	after := SubnetCapacity{Usable: capacity.Usable, Used: capacity.Used + needed}
+
+	if NatCapacityCrossesWarning(capacity, after, azCtx.cfg.NatSubnetWarningPercent) {
+		azCtx.warningEvent(service, natSubnetCapacityLow, fmt.Sprintf("NAT subnet %v has %v of %v addresses in use", name, after.Used, after.Usable))
+	}
+
+	return nil
+}
@@ -0,0 +1,319 @@
+package azure
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestFreePrefix(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		addressSpace []string
+		used         []string
+		length       int
+		want         string
+		reason       string
+	}{
+		{
+			name:         "first free prefix after a used one",
+			addressSpace: []string{"10.0.0.0/16"},
+			used:         []string{"10.0.0.0/24"},
+			length:       24,
+			want:         "10.0.1.0/24",
+		},
+		{
+			name:         "gap left by a smaller used prefix is skipped to the next aligned one",
+			addressSpace: []string{"10.0.0.0/24"},
+			used:         []string{"10.0.0.0/28"},
+			length:       26,
+			want:         "10.0.0.64/26",
+		},
+		{
+			name:         "address space given as a host address",
+			addressSpace: []string{"10.0.1.7/24"},
+			length:       25,
+			want:         "10.0.1.0/25",
+		},
+		{
+			name:         "used prefix inside the candidate",
+			addressSpace: []string{"10.0.0.0/16"},
+			used:         []string{"10.0.0.240/28"},
+			length:       24,
+			want:         "10.0.1.0/24",
+		},
+		{
+			name:         "used prefix straddling several candidates",
+			addressSpace: []string{"10.0.0.0/16"},
+			used:         []string{"10.0.0.0/23"},
+			length:       24,
+			want:         "10.0.2.0/24",
+		},
+		{
+			name:         "used prefix larger than the address space",
+			addressSpace: []string{"10.0.0.0/24"},
+			used:         []string{"10.0.0.0/8"},
+			length:       28,
+			reason:       NatSubnetPrefixUnavailable,
+		},
+		{
+			name:         "exhausted address space",
+			addressSpace: []string{"10.0.0.0/24"},
+			used:         []string{"10.0.0.0/25", "10.0.0.128/25"},
+			length:       28,
+			reason:       NatSubnetPrefixUnavailable,
+		},
+		{
+			name:         "address space smaller than the prefix",
+			addressSpace: []string{"10.0.0.0/28"},
+			length:       24,
+			reason:       NatSubnetPrefixUnavailable,
+		},
+		{
+			name:         "next address space once the first is full",
+			addressSpace: []string{"10.0.0.0/24", "10.1.0.0/24"},
+			used:         []string{"10.0.0.0/24"},
+			length:       26,
+			want:         "10.1.0.0/26",
+		},
+		{
+			name:         "/29",
+			addressSpace: []string{"10.0.0.0/24"},
+			used:         []string{"10.0.0.0/29"},
+			length:       29,
+			want:         "10.0.0.8/29",
+		},
+		{
+			name:         "/32",
+			addressSpace: []string{"10.0.0.0/30"},
+			used:         []string{"10.0.0.0/31"},
+			length:       32,
+			want:         "10.0.0.2/32",
+		},
+		{
+			name:         "end of the IPv4 range",
+			addressSpace: []string{"255.255.255.0/24"},
+			used:         []string{"255.255.255.0/25"},
+			length:       32,
+			want:         "255.255.255.128/32",
+		},
+		{
+			name:         "IPv6 address spaces are skipped",
+			addressSpace: []string{"fd00::/48", "10.1.0.0/16"},
+			length:       24,
+			want:         "10.1.0.0/24",
+		},
+		{
+			name:         "only IPv6 address spaces",
+			addressSpace: []string{"fd00::/48"},
+			length:       24,
+			reason:       NatSubnetPrefixUnavailable,
+		},
+		{
+			name:         "length too long",
+			addressSpace: []string{"10.0.0.0/16"},
+			length:       33,
+		},
+		{
+			name:         "length too short",
+			addressSpace: []string{"10.0.0.0/16"},
+			length:       0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := FreePrefix(test.addressSpace, test.used, test.length)
+
+			if test.want != "" {
+				if err != nil || got != test.want {
+					t.Fatalf("FreePrefix() = %q, %v, want %q", got, err, test.want)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("FreePrefix() = %q, want an error", got)
+			}
+			checkReason(t, err, test.reason)
+		})
+	}
+}
+
+func TestCheckPrefix(t *testing.T) {
+
+	addressSpace := []string{"10.0.0.0/16", "10.1.0.0/24"}
+	used := []string{"10.0.0.0/24", "10.0.4.0/22"}
+
+	tests := []struct {
+		name   string
+		prefix string
+		valid  bool
+		reason string
+	}{
+		{name: "free prefix", prefix: "10.0.1.0/24", valid: true},
+		{name: "free prefix in the second address space", prefix: "10.1.0.64/26", valid: true},
+		{name: "/29", prefix: "10.0.1.8/29", valid: true},
+		{name: "/32", prefix: "10.0.1.1/32", valid: true},
+		{name: "not a network address", prefix: "10.0.1.5/24", reason: NatSubnetPrefixUnavailable},
+		{name: "/29 not on a network address", prefix: "10.0.1.4/29", reason: NatSubnetPrefixUnavailable},
+		{name: "inside a used prefix", prefix: "10.0.0.128/25", reason: NatSubnetPrefixUnavailable},
+		{name: "straddling a used prefix", prefix: "10.0.0.0/23", reason: NatSubnetPrefixUnavailable},
+		{name: "containing a used prefix", prefix: "10.0.0.0/20", reason: NatSubnetPrefixUnavailable},
+		{name: "outside the address space", prefix: "10.2.0.0/24", reason: NatSubnetPrefixUnavailable},
+		{name: "partly outside the address space", prefix: "10.1.0.0/23", reason: NatSubnetPrefixUnavailable},
+		{name: "IPv6 is left to ARM", prefix: "fd00::/64", valid: true},
+		{name: "not a prefix", prefix: "10.0.1.0"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := CheckPrefix(addressSpace, used, test.prefix)
+
+			if test.valid {
+				if err != nil {
+					t.Fatalf("CheckPrefix(%q) = %v, want nil", test.prefix, err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("CheckPrefix(%q) = nil, want an error", test.prefix)
+			}
+			checkReason(t, err, test.reason)
+		})
+	}
+}
+
+func TestNewSubnetCapacity(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		prefixes []string
+		used     int
+		usable   int
+	}{
+		{name: "/24", prefixes: []string{"10.0.0.0/24"}, used: 3, usable: 251},
+		{name: "/29", prefixes: []string{"10.0.0.0/29"}, usable: 3},
+		{name: "/30 is smaller than the reserved addresses", prefixes: []string{"10.0.0.0/30"}, usable: 0},
+		{name: "/32", prefixes: []string{"10.0.0.1/32"}, usable: 0},
+		{name: "host address", prefixes: []string{"10.0.0.7/24"}, usable: 251},
+		{name: "several prefixes", prefixes: []string{"10.0.0.0/24", "10.0.1.0/28"}, usable: 262},
+		{name: "IPv6", prefixes: []string{"10.0.0.0/24", "fd00::/64"}, usable: math.MaxInt32},
+		{name: "invalid prefixes are skipped", prefixes: []string{"10.0.0.0", "10.0.0.0/28"}, usable: 11},
+		{name: "no prefixes", usable: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := NewSubnetCapacity(test.prefixes, test.used)
+			want := SubnetCapacity{Usable: test.usable, Used: test.used}
+
+			if got != want {
+				t.Fatalf("NewSubnetCapacity(%v, %v) = %+v, want %+v", test.prefixes, test.used, got, want)
+			}
+		})
+	}
+}
+
+func TestSubnetCapacity(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		capacity SubnetCapacity
+		free     int
+		low      bool
+	}{
+		{name: "empty", capacity: SubnetCapacity{Usable: 11}, free: 11},
+		{name: "below the threshold", capacity: SubnetCapacity{Usable: 10, Used: 7}, free: 3},
+		{name: "at the threshold", capacity: SubnetCapacity{Usable: 10, Used: 8}, free: 2, low: true},
+		{name: "overcommitted", capacity: SubnetCapacity{Usable: 3, Used: 5}, free: 0, low: true},
+		{name: "no usable addresses", capacity: SubnetCapacity{}, free: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if free := test.capacity.Free(); free != test.free {
+				t.Errorf("Free() = %v, want %v", free, test.free)
+			}
+			if low := test.capacity.Low(80); low != test.low {
+				t.Errorf("Low(80) = %v, want %v", low, test.low)
+			}
+		})
+	}
+}
+
+func TestCheckNatCapacity(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		capacity SubnetCapacity
+		needed   int
+		full     bool
+	}{
+		{name: "room left", capacity: SubnetCapacity{Usable: 11, Used: 5}, needed: 6},
+		{name: "nothing needed from a full subnet", capacity: SubnetCapacity{Usable: 3, Used: 3}},
+		{name: "one too many", capacity: SubnetCapacity{Usable: 11, Used: 5}, needed: 7, full: true},
+		{name: "no usable addresses", capacity: SubnetCapacity{}, needed: 1, full: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := CheckNatCapacity("nat", test.capacity, test.needed)
+
+			if !test.full {
+				if err != nil {
+					t.Fatalf("CheckNatCapacity() = %v, want nil", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("CheckNatCapacity() = nil, want an error")
+			}
+			checkReason(t, err, NatSubnetFull)
+		})
+	}
+}
+
+func TestNatCapacityCrossesWarning(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		before SubnetCapacity
+		needed int
+		want   bool
+	}{
+		{name: "stays below", before: SubnetCapacity{Usable: 10, Used: 5}, needed: 2},
+		{name: "reaches the threshold", before: SubnetCapacity{Usable: 10, Used: 7}, needed: 1, want: true},
+		{name: "jumps over the threshold", before: SubnetCapacity{Usable: 10, Used: 2}, needed: 8, want: true},
+		{name: "already low", before: SubnetCapacity{Usable: 10, Used: 8}, needed: 1},
+		{name: "resync of a low subnet", before: SubnetCapacity{Usable: 10, Used: 9}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			after := SubnetCapacity{Usable: test.before.Usable, Used: test.before.Used + test.needed}
+
+			if got := NatCapacityCrossesWarning(test.before, after, 80); got != test.want {
+				t.Fatalf("NatCapacityCrossesWarning(%+v, %+v) = %v, want %v", test.before, after, got, test.want)
+			}
+		})
+	}
+}
+
+//checkReason fails the test unless err is a PrivateLinkServiceError with the given reason. An empty reason accepts any error
+func checkReason(t *testing.T, err error, reason string) {
+	t.Helper()
+
+	if reason == "" {
+		return
+	}
+
+	var plsErr *PrivateLinkServiceError
+
+	if !errors.As(err, &plsErr) || plsErr.Reason != reason {
+		t.Fatalf("error %v does not have reason %v", err, reason)
+	}
+}
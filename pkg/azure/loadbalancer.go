@@ -0,0 +1,265 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/garvinmsft/auto-private-link/pkg/config"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+const (
+	ipv4Family = "IPv4"
+	ipv6Family = "IPv6"
+
+	//maxFrontendIPConfigurations is the most load balancer frontends Azure attaches to one private link service
+	maxFrontendIPConfigurations = 8
+
+	//LoadBalancerResourceGroupAnnotation is the cloud provider annotation placing the load balancer of a service in another resource group
+	LoadBalancerResourceGroupAnnotation = "service.beta.kubernetes.io/azure-load-balancer-resource-group"
+)
+
+//frontendCache remembers which load balancer frontend holds a service ip, so the load balancers are only listed again when it moves
+type frontendCache struct {
+	mu        sync.Mutex
+	frontends map[string]string
+}
+
+func newFrontendCache() *frontendCache {
+	return &frontendCache{
+		frontends: map[string]string{},
+	}
+}
+
+func (c *frontendCache) get(ip string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id, ok := c.frontends[ip]
+	return id, ok
+}
+
+func (c *frontendCache) set(ip string, id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.frontends[ip] = id
+}
+
+func (c *frontendCache) forget(ip string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.frontends, ip)
+}
+
+//LoadBalancerResourceGroups are the resource groups searched for the load balancer of a service:
+//the one named by LoadBalancerResourceGroupAnnotation first, then the node resource group
+func LoadBalancerResourceGroups(cfg config.Config, service *v1.Service) []string {
+
+	var groups []string
+
+	if rg := strings.TrimSpace(service.Annotations[LoadBalancerResourceGroupAnnotation]); rg != "" {
+		groups = append(groups, rg)
+	}
+
+	if len(groups) == 0 || !strings.EqualFold(groups[0], cfg.LoadBalancerResourceGroup) {
+		groups = append(groups, cfg.LoadBalancerResourceGroup)
+	}
+
+	return groups
+}
+
+//ServiceIPs are the load balancer ingress ips of a service selected by IngressIPsAnnotation
+func ServiceIPs(service *v1.Service) ([]string, error) {
+
+	var ingress []net.IP
+
+	for _, item := range service.Status.LoadBalancer.Ingress {
+		if ip := net.ParseIP(item.IP); ip != nil {
+			ingress = append(ingress, ip)
+		}
+	}
+
+	if len(ingress) == 0 {
+		return nil, fmt.Errorf("Service %v/%v has no load balancer ip yet", service.Namespace, service.Name)
+	}
+
+	selectors := listAnnotation(service, IngressIPsAnnotation)
+
+	if len(selectors) == 0 {
+		selectors = []string{ipv4Family, ipv6Family}
+	}
+
+	var ips []string
+
+	for _, selector := range selectors {
+		var matched []string
+
+		for _, ip := range ingress {
+			if selectsIP(selector, ip) {
+				matched = append(matched, ip.String())
+			}
+		}
+
+		if len(matched) == 0 && net.ParseIP(selector) != nil {
+			return nil, fmt.Errorf("Annotation %v: %v is not a load balancer ip of the service", IngressIPsAnnotation, selector)
+		}
+
+		if len(matched) == 0 && !strings.EqualFold(selector, ipv4Family) && !strings.EqualFold(selector, ipv6Family) {
+			return nil, fmt.Errorf("Annotation %v: %v is neither an ip, %v nor %v", IngressIPsAnnotation, selector, ipv4Family, ipv6Family)
+		}
+
+		for _, ip := range matched {
+			if !containsFold(ips, ip) {
+				ips = append(ips, ip)
+			}
+		}
+	}
+
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("Annotation %v selects none of the load balancer ips of the service", IngressIPsAnnotation)
+	}
+
+	if len(ips) > maxFrontendIPConfigurations {
+		return nil, fmt.Errorf("A private link service can have at most %v frontend ip configurations, %v ips are selected", maxFrontendIPConfigurations, len(ips))
+	}
+
+	return ips, nil
+}
+
+func selectsIP(selector string, ip net.IP) bool {
+	switch {
+	case strings.EqualFold(selector, ipv4Family):
+		return ip.To4() != nil
+	case strings.EqualFold(selector, ipv6Family):
+		return ip.To4() == nil
+	default:
+		return ip.Equal(net.ParseIP(selector))
+	}
+}
+
+//sameIP compares ips by value, as IPv6 addresses have several spellings
+func sameIP(a string, b string) bool {
+	ip := net.ParseIP(a)
+	return ip != nil && ip.Equal(net.ParseIP(b))
+}
+
+//getLoadBalancerFrontendIDs finds the frontends holding the ips among the load balancers of LoadBalancerResourceGroups
+func (azCtx armContext) getLoadBalancerFrontendIDs(service *v1.Service, ips []string) ([]string, error) {
+
+	var ids []string
+
+	for _, ip := range ips {
+		id, err := azCtx.getLoadBalancerFrontendIDForIP(service, ip)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+//getLoadBalancerFrontendIDForIP finds the frontend holding an ip among the load balancers of LoadBalancerResourceGroups,
+//falling back to the configured load balancer when none of them has it
+func (azCtx armContext) getLoadBalancerFrontendIDForIP(service *v1.Service, ip string) (string, error) {
+
+	if id, ok := azCtx.frontends.get(ip); ok {
+		if azCtx.frontendHasIP(id, ip) {
+			return id, nil
+		}
+		azCtx.frontends.forget(ip)
+	}
+
+	groups := LoadBalancerResourceGroups(azCtx.cfg, service)
+	frontEndID, err := azCtx.discoverFrontend(groups, ip)
+
+	if frontEndID == "" && azCtx.cfg.LoadBalancerName != "" {
+		if err != nil {
+			klog.Warningf("Load balancer discovery for %v/%v failed, searching %v: %v", service.Namespace, service.Name, azCtx.cfg.LoadBalancerName, err)
+		}
+		frontEndID, err = azCtx.configuredFrontend(ip)
+	}
+
+	if frontEndID == "" {
+		if err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("Could not find service ip %v in the load balancers of resource groups %v", ip, strings.Join(groups, ", "))
+	}
+
+	azCtx.frontends.set(ip, frontEndID)
+	return frontEndID, nil
+}
+
+//discoverFrontend lists the load balancers of each resource group for a frontend with the private ip.
+//A resource group that cannot be listed does not stop the search
+func (azCtx armContext) discoverFrontend(groups []string, ip string) (string, error) {
+
+	ctx := context.TODO()
+	var firstErr error
+
+	for _, rg := range groups {
+		lbs, err := azCtx.LoadBalancersClient.ListComplete(ctx, rg)
+
+		for ; err == nil && lbs.NotDone(); err = lbs.NextWithContext(ctx) {
+			lb := lbs.Value()
+
+			if lb.LoadBalancerPropertiesFormat == nil || lb.FrontendIPConfigurations == nil {
+				continue
+			}
+
+			for _, frontend := range *lb.FrontendIPConfigurations {
+				if frontend.FrontendIPConfigurationPropertiesFormat != nil && sameIP(to.String(frontend.PrivateIPAddress), ip) {
+					return to.String(frontend.ID), nil
+				}
+			}
+		}
+
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("Could not list the load balancers of resource group %v: %v", rg, err)
+		}
+	}
+
+	return "", firstErr
+}
+
+//configuredFrontend searches the frontends of the configured load balancer
+func (azCtx armContext) configuredFrontend(ip string) (string, error) {
+
+	lfcList, err := azCtx.LbFrontEndConfigClient.ListComplete(context.TODO(),
+		azCtx.cfg.LoadBalancerResourceGroup,
+		azCtx.cfg.LoadBalancerName)
+
+	for ; err == nil && lfcList.NotDone(); err = lfcList.NextWithContext(context.TODO()) {
+		frontend := lfcList.Value()
+
+		if frontend.FrontendIPConfigurationPropertiesFormat != nil && sameIP(to.String(frontend.PrivateIPAddress), ip) {
+			return to.String(frontend.ID), nil
+		}
+	}
+
+	return "", err
+}
+
+//frontendHasIP checks a cached frontend still holds the ip. Services that are recreated may get their ip from another load balancer
+func (azCtx armContext) frontendHasIP(id string, ip string) bool {
+
+	segments := strings.Split(strings.Trim(id, "/"), "/")
+
+	if len(segments) != 10 {
+		return false
+	}
+
+	frontend, err := azCtx.LbFrontEndConfigClient.Get(context.TODO(), segments[3], segments[7], segments[9])
+
+	return err == nil && frontend.FrontendIPConfigurationPropertiesFormat != nil && sameIP(to.String(frontend.PrivateIPAddress), ip)
+}
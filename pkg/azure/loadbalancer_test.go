@@ -0,0 +1,90 @@
+package azure
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/garvinmsft/auto-private-link/pkg/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestServiceIPs(t *testing.T) {
+
+	var many []string
+	for i := 1; i <= maxFrontendIPConfigurations+1; i++ {
+		many = append(many, fmt.Sprintf("10.0.0.%v", i))
+	}
+
+	tests := []struct {
+		name       string
+		ingress    []string
+		annotation string
+		want       []string
+	}{
+		{name: "no ingress ip yet"},
+		{name: "unparsable ingress ips are skipped", ingress: []string{"pending", "10.0.0.4"}, want: []string{"10.0.0.4"}},
+		{name: "only unparsable ingress ips", ingress: []string{"pending"}},
+		{name: "both families by default, IPv4 first", ingress: []string{"fd00::1", "10.0.0.4"}, want: []string{"10.0.0.4", "fd00::1"}},
+		{name: "IPv4", ingress: []string{"fd00::1", "10.0.0.4", "10.0.0.5"}, annotation: "IPv4", want: []string{"10.0.0.4", "10.0.0.5"}},
+		{name: "family ignores case", ingress: []string{"fd00::1", "10.0.0.4"}, annotation: "ipv6", want: []string{"fd00::1"}},
+		{name: "single ip", ingress: []string{"10.0.0.4", "10.0.0.5"}, annotation: " 10.0.0.5 , ", want: []string{"10.0.0.5"}},
+		{name: "IPv6 in another spelling", ingress: []string{"fd00::1"}, annotation: "fd00:0:0::1", want: []string{"fd00::1"}},
+		{name: "ip and family overlap", ingress: []string{"10.0.0.4", "10.0.0.5"}, annotation: "10.0.0.5,IPv4", want: []string{"10.0.0.5", "10.0.0.4"}},
+		{name: "ip the service does not have", ingress: []string{"10.0.0.4"}, annotation: "10.0.0.5"},
+		{name: "unknown selector", ingress: []string{"10.0.0.4"}, annotation: "internal"},
+		{name: "family the service does not have", ingress: []string{"10.0.0.4"}, annotation: "IPv6"},
+		{name: "too many frontends", ingress: many},
+		{name: "selection within the frontend limit", ingress: many, annotation: "10.0.0.1,10.0.0.2", want: []string{"10.0.0.1", "10.0.0.2"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: "frontend"}}
+
+			if test.annotation != "" {
+				service.Annotations = map[string]string{IngressIPsAnnotation: test.annotation}
+			}
+			for _, ip := range test.ingress {
+				service.Status.LoadBalancer.Ingress = append(service.Status.LoadBalancer.Ingress, v1.LoadBalancerIngress{IP: ip})
+			}
+
+			got, err := ServiceIPs(service)
+
+			if test.want == nil {
+				if err == nil {
+					t.Fatalf("ServiceIPs() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("ServiceIPs() = %v, %v, want %v", got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadBalancerResourceGroups(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		annotation string
+		want       []string
+	}{
+		{name: "node resource group", want: []string{"mc_rg"}},
+		{name: "annotated resource group first", annotation: " lb-rg ", want: []string{"lb-rg", "mc_rg"}},
+		{name: "annotation naming the node resource group", annotation: "MC_RG", want: []string{"MC_RG"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{LoadBalancerResourceGroupAnnotation: test.annotation}}}
+			cfg := config.Config{LoadBalancerResourceGroup: "mc_rg"}
+
+			if got := LoadBalancerResourceGroups(cfg, service); !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("LoadBalancerResourceGroups() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package azure
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/garvinmsft/auto-private-link/pkg/metrics"
+)
+
+//instrumentedSender records the resource type, operation, status code and latency of every ARM request,
+//including the polls of long running operations. It also keeps the time of the last request ARM accepted.
+type instrumentedSender struct {
+	sender autorest.Sender
+	lastSuccess *int64
+}
+
+func instrument(client *autorest.Client, lastSuccess *int64) {
+	client.Sender = instrumentedSender{sender: client.Sender, lastSuccess: lastSuccess}
+}
+
+func (s instrumentedSender) Do(r *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := s.sender.Do(r)
+
+	statusCode := 0
+	if resp != nil {
+		statusCode = resp.StatusCode
+	}
+
+	//Client errors other than authentication failures still prove ARM is reachable
+	if statusCode != 0 && statusCode < http.StatusInternalServerError &&
+		statusCode != http.StatusUnauthorized && statusCode != http.StatusForbidden {
+		atomic.StoreInt64(s.lastSuccess, time.Now().UnixNano())
+	}
+
+	resource, operation := armOperation(r)
+	metrics.ObserveARMRequest(resource, operation, statusCode, time.Since(start))
+
+	return resp, err
+}
+
+//armOperation names a request after the SDK operation that sent it. Resource IDs alternate
+//type and name segments after the provider, so an odd number of segments is a collection.
+func armOperation(r *http.Request) (string, string) {
+
+	path := strings.Trim(r.URL.Path, "/")
+	index := strings.LastIndex(strings.ToLower(path), "/providers/")
+
+	if index < 0 {
+		return "unknown", r.Method
+	}
+
+	//skip the provider namespace, e.g. Microsoft.Network
+	segments := strings.Split(path[index+len("/providers/"):], "/")[1:]
+
+	if len(segments) == 0 {
+		return "unknown", r.Method
+	}
+
+	collection := len(segments)%2 == 1
+	resource := segments[len(segments)-1]
+	if !collection {
+		resource = segments[len(segments)-2]
+	}
+
+	//Long running operations are polled on locations/{location}/operations or operationResults
+	if len(segments) >= 3 && strings.EqualFold(segments[0], "locations") {
+		return resource, "Poll"
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if collection {
+			return resource, "List"
+		}
+		return resource, "Get"
+	case http.MethodPut:
+		return resource, "CreateOrUpdate"
+	case http.MethodDelete:
+		return resource, "Delete"
+	case http.MethodPost:
+		return resource, "Action"
+	case http.MethodPatch:
+		return resource, "Update"
+	}
+
+	return resource, r.Method
+}
@@ -0,0 +1,46 @@
+package azure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestArmOperation(t *testing.T) {
+
+	const group = "https://management.azure.com/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network"
+
+	tests := []struct {
+		name      string
+		method    string
+		url       string
+		resource  string
+		operation string
+	}{
+		{name: "get", method: http.MethodGet, url: group + "/privateLinkServices/pls?api-version=2021-05-01", resource: "privateLinkServices", operation: "Get"},
+		{name: "list", method: http.MethodGet, url: group + "/privateLinkServices", resource: "privateLinkServices", operation: "List"},
+		{name: "list child resources", method: http.MethodGet, url: group + "/privateLinkServices/pls/privateEndpointConnections", resource: "privateEndpointConnections", operation: "List"},
+		{name: "put child resource", method: http.MethodPut, url: group + "/privateLinkServices/pls/privateEndpointConnections/conn", resource: "privateEndpointConnections", operation: "CreateOrUpdate"},
+		{name: "delete", method: http.MethodDelete, url: group + "/privateEndpoints/ep", resource: "privateEndpoints", operation: "Delete"},
+		{name: "patch", method: http.MethodPatch, url: group + "/privateEndpoints/ep", resource: "privateEndpoints", operation: "Update"},
+		{name: "action", method: http.MethodPost, url: group + "/privateEndpoints/ep/restart", resource: "restart", operation: "Action"},
+		{name: "other methods", method: http.MethodHead, url: group + "/privateEndpoints/ep", resource: "privateEndpoints", operation: http.MethodHead},
+		{name: "record set", method: http.MethodPut, url: group + "/privateDnsZones/contoso.com/A/db", resource: "A", operation: "CreateOrUpdate"},
+		{name: "operation poll", method: http.MethodGet, url: "https://management.azure.com/subscriptions/sub/providers/Microsoft.Network/locations/eastus/operations/123", resource: "operations", operation: "Poll"},
+		{name: "operation result poll", method: http.MethodGet, url: "https://management.azure.com/subscriptions/sub/providers/Microsoft.Network/locations/eastus/operationResults/123", resource: "operationResults", operation: "Poll"},
+		{name: "provider in another case", method: http.MethodGet, url: "https://management.azure.com/subscriptions/sub/resourceGroups/rg/PROVIDERS/Microsoft.Network/virtualNetworks/vnet", resource: "virtualNetworks", operation: "Get"},
+		{name: "nested provider", method: http.MethodGet, url: group + "/virtualNetworks/vnet/providers/Microsoft.Authorization/roleAssignments/id", resource: "roleAssignments", operation: "Get"},
+		{name: "no provider", method: http.MethodGet, url: "https://management.azure.com/subscriptions/sub/resourcegroups", resource: "unknown", operation: http.MethodGet},
+		{name: "provider namespace only", method: http.MethodGet, url: "https://management.azure.com/subscriptions/sub/providers/Microsoft.Network", resource: "unknown", operation: http.MethodGet},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resource, operation := armOperation(httptest.NewRequest(test.method, test.url, nil))
+
+			if resource != test.resource || operation != test.operation {
+				t.Fatalf("armOperation(%v %v) = %v, %v, want %v, %v", test.method, test.url, resource, operation, test.resource, test.operation)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package azure
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest/to"
+	apl "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
+	"github.com/garvinmsft/auto-private-link/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	//ClusterTag is the tag holding the name of the cluster that owns a resource
+	ClusterTag = "apl-cluster"
+
+	//NamespaceTag is the tag holding the namespace of the kubernetes object that owns a resource
+	NamespaceTag = "apl-namespace"
+
+	//NameTag is the tag holding the name of the kubernetes object that owns a resource
+	NameTag = "apl-name"
+
+	//UIDTag is the tag holding the UID of the kubernetes object that owns a resource
+	UIDTag = "apl-uid"
+
+	//Private link services, their ip configurations and private endpoints share the same character rules
+	maxPrivateLinkServiceNameLength = 80
+	maxPrivateEndpointNameLength = 64
+
+	resourceOwnershipConflict = "ResourceOwnershipConflict"
+)
+
+var (
+	invalidNameCharacters = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+)
+
+//PrivateLinkServiceName is the name of the private link service of a kubernetes service
+func PrivateLinkServiceName(cfg config.Config, namespace string, name string) string {
+	return resourceName(cfg.PrivateLinkServiceNameTemplate, cfg.ClusterName, namespace, name, maxPrivateLinkServiceNameLength)
+}
+
+//PrivateEndpointName is the name of the private endpoint of a service connection
+func PrivateEndpointName(cfg config.Config, namespace string, name string) string {
+	return resourceName(cfg.PrivateEndpointNameTemplate, cfg.ClusterName, namespace, name, maxPrivateEndpointNameLength)
+}
+
+//PrivateEndpointID is the resource ID of the private endpoint of a service connection, created in the given subscription
+func PrivateEndpointID(cfg config.Config, subscriptionID string, conn *apl.ServiceConnection) string {
+	return fmt.Sprintf("/subscriptions/%v/resourceGroups/%v/providers/%v/%v",
+		subscriptionID, conn.Spec.ResourceGroup, PrivateEndpointResource, PrivateEndpointName(cfg, conn.Namespace, conn.Name))
+}
+
+//resourceName fills a name template and makes the result follow the Azure naming rules:
+//alphanumerics, underscores, periods and hyphens, starting with an alphanumeric and ending
+//with an alphanumeric or underscore. Names that are too long are shortened with a hash suffix
+//so they stay unique.
+func resourceName(template string, cluster string, namespace string, name string, maxLength int) string {
+
+	full := strings.NewReplacer(
+		"{cluster}", cluster,
+		"{namespace}", namespace,
+		"{name}", name,
+	).Replace(template)
+
+	sanitized := invalidNameCharacters.ReplaceAllString(full, "-")
+	sanitized = strings.TrimLeft(sanitized, "_.-")
+
+	if len(sanitized) > maxLength {
+		hash := fmt.Sprintf("%x", sha256.Sum256([]byte(full)))[:8]
+		sanitized = strings.TrimRight(sanitized[:maxLength-len(hash)-1], ".-") + "-" + hash
+	}
+
+	sanitized = strings.TrimRight(sanitized, ".-")
+
+	if sanitized == "" {
+		return "apl"
+	}
+
+	return sanitized
+}
+
+//OwnerTags are the tags marking a resource as owned by a kubernetes object of this cluster
+func OwnerTags(cfg config.Config, owner metav1.Object) map[string]*string {
+	return map[string]*string{
+		ClusterTag:   to.StringPtr(cfg.ClusterName),
+		NamespaceTag: to.StringPtr(owner.GetNamespace()),
+		NameTag:      to.StringPtr(owner.GetName()),
+		UIDTag:       to.StringPtr(string(owner.GetUID())),
+	}
+}
+
+//CheckOwner returns an error when the tags of a resource say it belongs to another kubernetes object.
+//Resources without ownership tags predate them and are adopted. The UID is not compared so an object
+//recreated with the same name takes over the resources left by the old one; the garbage collector uses it
+//to find the resources of the old object that the new one does not take over.
+func CheckOwner(cfg config.Config, resourceName string, tags map[string]*string, owner metav1.Object) error {
+
+	expected := OwnerTags(cfg, owner)
+	delete(expected, UIDTag)
+
+	for k, v := range expected {
+		actual, ok := tagValue(tags, k)
+
+		if ok && actual != *v {
+			cluster, _ := tagValue(tags, ClusterTag)
+			namespace, _ := tagValue(tags, NamespaceTag)
+			name, _ := tagValue(tags, NameTag)
+
+			return fmt.Errorf("Azure resource %v belongs to %v/%v in cluster %v", resourceName, namespace, name, cluster)
+		}
+	}
+
+	return nil
+}
+
+//tagValue looks up a tag ignoring case, like Azure does
+func tagValue(tags map[string]*string, key string) (string, bool) {
+	for k, v := range tags {
+		if strings.EqualFold(k, key) {
+			return to.String(v), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,124 @@
+package azure
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/to"
+	apl "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
+	"github.com/garvinmsft/auto-private-link/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResourceName(t *testing.T) {
+
+	long := strings.Repeat("a", 70)
+
+	tests := []struct {
+		name      string
+		template  string
+		namespace string
+		object    string
+		maxLength int
+		want      string
+	}{
+		{name: "name only", template: "{name}", namespace: "web", object: "frontend", maxLength: 80, want: "frontend"},
+		{name: "all placeholders", template: "{cluster}-{namespace}-{name}", namespace: "web", object: "frontend", maxLength: 80, want: "aks-web-frontend"},
+		{name: "invalid characters", template: "{namespace}/{name}", namespace: "web", object: "front end", maxLength: 80, want: "web-front-end"},
+		{name: "leading and trailing separators", template: "-{name}.", namespace: "web", object: "frontend", maxLength: 80, want: "frontend"},
+		{name: "trailing underscore is kept", template: "{name}_", namespace: "web", object: "frontend", maxLength: 80, want: "frontend_"},
+		{name: "nothing left", template: "{name}", namespace: "web", object: "..", maxLength: 80, want: "apl"},
+		{name: "exactly the maximum length", template: "{name}", namespace: "web", object: long[:64], maxLength: 64, want: long[:64]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := resourceName(test.template, "aks", test.namespace, test.object, test.maxLength); got != test.want {
+				t.Fatalf("resourceName(%q) = %q, want %q", test.template, got, test.want)
+			}
+		})
+	}
+}
+
+func TestResourceNameShortened(t *testing.T) {
+
+	long := strings.Repeat("a", 70)
+
+	first := resourceName("{namespace}-{name}", "aks", "web", long, maxPrivateEndpointNameLength)
+	second := resourceName("{namespace}-{name}", "aks", "api", long, maxPrivateEndpointNameLength)
+
+	if len(first) != maxPrivateEndpointNameLength {
+		t.Errorf("shortened name %q has length %v, want %v", first, len(first), maxPrivateEndpointNameLength)
+	}
+	if first == second {
+		t.Errorf("names that only differ past the maximum length collide: %q", first)
+	}
+	if first != resourceName("{namespace}-{name}", "aks", "web", long, maxPrivateEndpointNameLength) {
+		t.Errorf("shortened names are not stable")
+	}
+	if !strings.HasPrefix(first, "web-aaa") {
+		t.Errorf("shortened name %q does not keep the start of the name", first)
+	}
+}
+
+func TestPrivateEndpointID(t *testing.T) {
+
+	cfg := config.Config{ClusterName: "aks", PrivateEndpointNameTemplate: "{namespace}-{name}"}
+	conn := &apl.ServiceConnection{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: "db"},
+		Spec:       apl.ServiceConnectionSpec{ResourceGroup: "endpoints"},
+	}
+
+	want := "/subscriptions/sub/resourceGroups/endpoints/providers/Microsoft.Network/privateEndpoints/web-db"
+
+	if got := PrivateEndpointID(cfg, "sub", conn); got != want {
+		t.Fatalf("PrivateEndpointID() = %q, want %q", got, want)
+	}
+}
+
+func TestCheckOwner(t *testing.T) {
+
+	cfg := config.Config{ClusterName: "aks"}
+	owner := &metav1.ObjectMeta{Namespace: "web", Name: "frontend", UID: "uid-1"}
+
+	tests := []struct {
+		name  string
+		tags  map[string]*string
+		valid bool
+	}{
+		{name: "untagged resources are adopted", valid: true},
+		{name: "tags of other tools", tags: map[string]*string{"team": to.StringPtr("web")}, valid: true},
+		{name: "owned", tags: OwnerTags(cfg, owner), valid: true},
+		{
+			name: "tag names in another case",
+			tags: map[string]*string{
+				"APL-Cluster":   to.StringPtr("aks"),
+				"APL-Namespace": to.StringPtr("web"),
+				"APL-Name":      to.StringPtr("frontend"),
+			},
+			valid: true,
+		},
+		{
+			name:  "recreated object",
+			tags:  OwnerTags(cfg, &metav1.ObjectMeta{Namespace: "web", Name: "frontend", UID: "uid-2"}),
+			valid: true,
+		},
+		{name: "other namespace", tags: OwnerTags(cfg, &metav1.ObjectMeta{Namespace: "api", Name: "frontend"})},
+		{name: "other name", tags: OwnerTags(cfg, &metav1.ObjectMeta{Namespace: "web", Name: "backend"})},
+		{name: "other cluster", tags: OwnerTags(config.Config{ClusterName: "staging"}, owner)},
+		{name: "only the cluster tag", tags: map[string]*string{ClusterTag: to.StringPtr("staging")}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := CheckOwner(cfg, "frontend", test.tags, owner)
+
+			if test.valid && err != nil {
+				t.Fatalf("CheckOwner() = %v, want nil", err)
+			}
+			if !test.valid && err == nil {
+				t.Fatal("CheckOwner() = nil, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package azure
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	n "github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-05-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/garvinmsft/auto-private-link/pkg/config"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	//NatIPCountAnnotation is the number of NAT ip configurations of the private link service, from 1 (default) to 8
+	NatIPCountAnnotation = "garvinmsft.github.com/apl-nat-ip-count"
+
+	//NatIPsAnnotation is a comma separated list of static NAT ips in the NAT subnet. The first one is the primary configuration.
+	//Configurations beyond the listed ips get dynamic addresses
+	NatIPsAnnotation = "garvinmsft.github.com/apl-nat-ips"
+
+	//NatSubnetAnnotation is the name of the subnet the NAT ips of the private link service are taken from, instead of the configured NAT subnet
+	NatSubnetAnnotation = "garvinmsft.github.com/apl-nat-subnet"
+
+	//NatVnetAnnotation is the vnet of the subnet named by NatSubnetAnnotation. Defaults to the configured vnet
+	NatVnetAnnotation = "garvinmsft.github.com/apl-nat-vnet"
+
+	//NatVnetResourceGroupAnnotation is the resource group of the vnet named by NatVnetAnnotation. Defaults to the configured vnet resource group
+	NatVnetResourceGroupAnnotation = "garvinmsft.github.com/apl-nat-vnet-resource-group"
+
+	//NatSubnetPrefixAnnotation is the cidr the subnet named by NatSubnetAnnotation is created with when it does not exist
+	NatSubnetPrefixAnnotation = "garvinmsft.github.com/apl-nat-subnet-prefix"
+
+	//NatSubnetPrefixLengthAnnotation is the size of the free prefix picked in the vnet for the subnet named by NatSubnetAnnotation
+	//when it does not exist and has no prefix. Defaults to the configured prefix length
+	NatSubnetPrefixLengthAnnotation = "garvinmsft.github.com/apl-nat-subnet-prefix-length"
+
+	//maxNatSubnetPrefixLength is the smallest subnet Azure allows
+	maxNatSubnetPrefixLength = 29
+
+	//maxNatIPConfigurations is the most NAT ip configurations Azure allows on one private link service
+	maxNatIPConfigurations = 8
+)
+
+//NatIPConfigurations builds the NAT ip configurations the annotations of a service ask for in the NAT subnet.
+//The first configuration keeps the name of the private link service and is the primary one.
+func NatIPConfigurations(service *v1.Service, name string, subnet n.Subnet) ([]n.PrivateLinkServiceIPConfiguration, error) {
+
+	staticIPs := listAnnotation(service, NatIPsAnnotation)
+	count := len(staticIPs)
+
+	if value, ok := service.Annotations[NatIPCountAnnotation]; ok {
+		parsed, err := strconv.Atoi(strings.TrimSpace(value))
+
+		if err != nil || parsed < 1 || parsed > maxNatIPConfigurations {
+			return nil, fmt.Errorf("Annotation %v must be a number from 1 to %v", NatIPCountAnnotation, maxNatIPConfigurations)
+		}
+
+		if parsed < len(staticIPs) {
+			return nil, fmt.Errorf("Annotation %v lists %v ips but %v is %v", NatIPsAnnotation, len(staticIPs), NatIPCountAnnotation, parsed)
+		}
+
+		count = parsed
+	}
+
+	if count == 0 {
+		count = 1
+	}
+
+	if count > maxNatIPConfigurations {
+		return nil, fmt.Errorf("Annotation %v lists %v ips, a private link service can have at most %v", NatIPsAnnotation, len(staticIPs), maxNatIPConfigurations)
+	}
+
+	for i, ip := range staticIPs {
+		if err := validateSubnetIP(NatIPsAnnotation, ip, to.String(subnet.Name), subnet); err != nil {
+			return nil, err
+		}
+
+		for _, other := range staticIPs[:i] {
+			if net.ParseIP(other).Equal(net.ParseIP(ip)) {
+				return nil, fmt.Errorf("Annotation %v lists %v twice", NatIPsAnnotation, ip)
+			}
+		}
+	}
+
+	configs := []n.PrivateLinkServiceIPConfiguration{}
+
+	for i := 0; i < count; i++ {
+		properties := &n.PrivateLinkServiceIPConfigurationProperties{
+			Subnet: &n.Subnet{
+				ID: subnet.ID,
+			},
+			Primary:                   to.BoolPtr(i == 0),
+			PrivateIPAllocationMethod: n.IPAllocationMethodDynamic,
+		}
+
+		if i < len(staticIPs) {
+			properties.PrivateIPAddress = to.StringPtr(net.ParseIP(staticIPs[i]).String())
+			properties.PrivateIPAllocationMethod = n.IPAllocationMethodStatic
+		}
+
+		configName := name
+		if i > 0 {
+			configName = fmt.Sprintf("%v-%v", name, i+1)
+		}
+
+		configs = append(configs, n.PrivateLinkServiceIPConfiguration{
+			Name: to.StringPtr(configName),
+			PrivateLinkServiceIPConfigurationProperties: properties,
+		})
+	}
+
+	return configs, nil
+}
+
+//NatSubnet identifies the subnet a private link service takes its NAT ips from
+type NatSubnet struct {
+	ResourceGroup string
+	VnetName string
+	Name string
+
+	//Prefix is the cidr the subnet is created with when it does not exist
+	Prefix string
+
+	//PrefixLength is the size of the free prefix picked in the vnet when the subnet does not exist and Prefix is empty.
+	//The subnet must exist when both are empty
+	PrefixLength int
+}
+
+//NatSubnetFor is the NAT subnet the annotations of a service select, or the configured one
+func NatSubnetFor(cfg config.Config, service *v1.Service) (NatSubnet, error) {
+
+	name := strings.TrimSpace(service.Annotations[NatSubnetAnnotation])
+	vnet := strings.TrimSpace(service.Annotations[NatVnetAnnotation])
+	resourceGroup := strings.TrimSpace(service.Annotations[NatVnetResourceGroupAnnotation])
+	prefix := strings.TrimSpace(service.Annotations[NatSubnetPrefixAnnotation])
+	length := strings.TrimSpace(service.Annotations[NatSubnetPrefixLengthAnnotation])
+
+	if name == "" {
+		if vnet != "" || resourceGroup != "" || prefix != "" || length != "" {
+			return NatSubnet{}, fmt.Errorf("Annotations %v, %v, %v and %v need %v", NatVnetAnnotation, NatVnetResourceGroupAnnotation,
+				NatSubnetPrefixAnnotation, NatSubnetPrefixLengthAnnotation, NatSubnetAnnotation)
+		}
+
+		return NatSubnet{
+			ResourceGroup: cfg.VnetResourceGroupName,
+			VnetName: cfg.VnetName,
+			Name: cfg.NatSubnetName,
+			Prefix: cfg.NatSubnetPrefix,
+			PrefixLength: cfg.NatSubnetPrefixLength,
+		}, nil
+	}
+
+	prefixLength := cfg.NatSubnetPrefixLength
+
+	if length != "" {
+		parsed, err := strconv.Atoi(length)
+
+		if err != nil || parsed < 1 || parsed > maxNatSubnetPrefixLength {
+			return NatSubnet{}, fmt.Errorf("Annotation %v must be a number from 1 to %v", NatSubnetPrefixLengthAnnotation, maxNatSubnetPrefixLength)
+		}
+
+		prefixLength = parsed
+	}
+
+	if _, _, err := net.ParseCIDR(prefix); prefix != "" && err != nil {
+		return NatSubnet{}, fmt.Errorf("Annotation %v must be in cidr notation: %v", NatSubnetPrefixAnnotation, err)
+	}
+
+	subnet := NatSubnet{
+		ResourceGroup: resourceGroup,
+		VnetName: vnet,
+		Name: name,
+		Prefix: prefix,
+		PrefixLength: prefixLength,
+	}
+
+	if subnet.VnetName == "" {
+		subnet.VnetName = cfg.VnetName
+	}
+
+	if subnet.ResourceGroup == "" {
+		subnet.ResourceGroup = cfg.VnetResourceGroupName
+	}
+
+	return subnet, nil
+}
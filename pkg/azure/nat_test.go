@@ -0,0 +1,90 @@
+package azure
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	n "github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-05-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNatIPConfigurations(t *testing.T) {
+
+	subnet := n.Subnet{
+		ID:   to.StringPtr(testSubnetID),
+		Name: to.StringPtr("nat"),
+		SubnetPropertiesFormat: &n.SubnetPropertiesFormat{
+			AddressPrefix: to.StringPtr("10.0.2.0/24"),
+		},
+	}
+
+	var nine []string
+	for i := 10; i < 10+maxNatIPConfigurations+1; i++ {
+		nine = append(nine, fmt.Sprintf("10.0.2.%v", i))
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        []string
+	}{
+		{name: "one dynamic configuration by default", want: []string{"pls|true|Dynamic|"}},
+		{
+			name:        "count",
+			annotations: map[string]string{NatIPCountAnnotation: " 3 "},
+			want:        []string{"pls|true|Dynamic|", "pls-2|false|Dynamic|", "pls-3|false|Dynamic|"},
+		},
+		{
+			name:        "static ips",
+			annotations: map[string]string{NatIPsAnnotation: "10.0.2.10, 10.0.2.11"},
+			want:        []string{"pls|true|Static|10.0.2.10", "pls-2|false|Static|10.0.2.11"},
+		},
+		{
+			name:        "static ips and dynamic ones beyond them",
+			annotations: map[string]string{NatIPsAnnotation: "10.0.2.10", NatIPCountAnnotation: "3"},
+			want:        []string{"pls|true|Static|10.0.2.10", "pls-2|false|Dynamic|", "pls-3|false|Dynamic|"},
+		},
+		{name: "count of zero", annotations: map[string]string{NatIPCountAnnotation: "0"}},
+		{name: "count above the limit", annotations: map[string]string{NatIPCountAnnotation: "9"}},
+		{name: "count that is not a number", annotations: map[string]string{NatIPCountAnnotation: "two"}},
+		{name: "count below the static ips", annotations: map[string]string{NatIPsAnnotation: "10.0.2.10,10.0.2.11", NatIPCountAnnotation: "1"}},
+		{name: "too many static ips", annotations: map[string]string{NatIPsAnnotation: strings.Join(nine, ",")}},
+		{name: "static ip outside the subnet", annotations: map[string]string{NatIPsAnnotation: "10.0.3.10"}},
+		{name: "static ip reserved by Azure", annotations: map[string]string{NatIPsAnnotation: "10.0.2.1"}},
+		{name: "static ip listed twice", annotations: map[string]string{NatIPsAnnotation: "10.0.2.10, 10.0.2.10"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: "frontend", Annotations: test.annotations}}
+
+			configs, err := NatIPConfigurations(service, "pls", subnet)
+
+			if test.want == nil {
+				if err == nil {
+					t.Fatalf("NatIPConfigurations() = %v configurations, want an error", len(configs))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NatIPConfigurations() = %v, want nil", err)
+			}
+
+			var got []string
+			for _, config := range configs {
+				if !strings.EqualFold(to.String(config.Subnet.ID), testSubnetID) {
+					t.Errorf("configuration %v is in subnet %v, want %v", to.String(config.Name), to.String(config.Subnet.ID), testSubnetID)
+				}
+				got = append(got, fmt.Sprintf("%v|%v|%v|%v", to.String(config.Name), to.Bool(config.Primary), config.PrivateIPAllocationMethod, to.String(config.PrivateIPAddress)))
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("NatIPConfigurations() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	n "github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-05-01/network"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/to"
+	apl "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
+	"github.com/garvinmsft/auto-private-link/pkg/config"
+)
+
+const (
+	//PolicyApprove approves a pending connection
+	PolicyApprove = "Approve"
+
+	//PolicyReject rejects a connection
+	PolicyReject = "Reject"
+
+	//PolicyRemove deletes a connection from the private link service
+	PolicyRemove = "Remove"
+
+	connectionPolicyError      = "ConnectionPolicyError"
+	connectionApprovedByPolicy = "ConnectionApprovedByPolicy"
+	connectionRejectedByPolicy = "ConnectionRejectedByPolicy"
+	connectionRemovedByPolicy  = "ConnectionRemovedByPolicy"
+)
+
+//ConnectionPolicyStatus counts the connections from outside the cluster once a policy was applied
+type ConnectionPolicyStatus struct {
+	Approved int32
+	Pending  int32
+	Rejected int32
+}
+
+//TenantLookup finds the Azure AD tenant of a subscription
+type TenantLookup func(subscriptionID string) (string, error)
+
+//PolicyAllows reports whether a policy allows the private endpoint with the given resource ID.
+//The tenant is only looked up when the subscription and endpoint patterns do not already allow it.
+func PolicyAllows(policy *apl.PrivateLinkConnectionPolicy, endpointID string, tenant TenantLookup) (bool, error) {
+
+	resource, err := azure.ParseResourceID(endpointID)
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, item := range policy.Spec.AllowedSubscriptions {
+		if strings.EqualFold(item, resource.SubscriptionID) {
+			return true, nil
+		}
+	}
+
+	for _, pattern := range policy.Spec.AllowedEndpoints {
+		if matchesPattern(pattern, endpointID) {
+			return true, nil
+		}
+	}
+
+	if len(policy.Spec.AllowedTenants) == 0 {
+		return false, nil
+	}
+
+	tenantID, err := tenant(resource.SubscriptionID)
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, item := range policy.Spec.AllowedTenants {
+		if strings.EqualFold(item, tenantID) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+//PolicyAction is what a policy does with a connection in the given state, or "" to leave it as it is.
+//Allowed pending connections are approved. Connections that are not allowed get the denied action of the policy.
+//Reject only applies to pending connections: approved ones were approved by someone, e.g. through the auto approval
+//list of the private link service, and are only revoked by Remove.
+func PolicyAction(policy *apl.PrivateLinkConnectionPolicy, state string, allowed bool) string {
+
+	if allowed {
+		if state == pending {
+			return PolicyApprove
+		}
+		return ""
+	}
+
+	switch policy.Spec.DeniedAction {
+	case apl.DeniedActionReject:
+		if state == pending {
+			return PolicyReject
+		}
+	case apl.DeniedActionRemove:
+		return PolicyRemove
+	}
+
+	return ""
+}
+
+//ManagedEndpointIDs are the IDs the private endpoint of a ServiceConnection is known by. The one built from the spec
+//is known before the endpoint exists, so a pending connection is never mistaken for one from outside the cluster
+func ManagedEndpointIDs(cfg config.Config, subscriptionID string, conn *apl.ServiceConnection) []string {
+
+	ids := []string{PrivateEndpointID(cfg, subscriptionID, conn)}
+
+	//The endpoint keeps its ID when the name template changes after it was created
+	if conn.Status.PrivateEndpointID != "" && !strings.EqualFold(conn.Status.PrivateEndpointID, ids[0]) {
+		ids = append(ids, conn.Status.PrivateEndpointID)
+	}
+
+	return ids
+}
+
+//matchesPattern matches a resource ID against a pattern where * stands for any characters, ignoring case
+func matchesPattern(pattern string, value string) bool {
+	parts := strings.Split(pattern, "*")
+
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+
+	expression, err := regexp.Compile("(?i)^" + strings.Join(parts, ".*") + "$")
+	return err == nil && expression.MatchString(value)
+}
+
+//ApplyConnectionPolicy approves, rejects or removes the connections to the private link service of the policy's service.
+//Connections of the endpoints of the managed ServiceConnections are left to the connection controller.
+func (azCtx armContext) ApplyConnectionPolicy(policy *apl.PrivateLinkConnectionPolicy, managed []*apl.ServiceConnection) (ConnectionPolicyStatus, error) {
+
+	ctx := context.TODO()
+	var status ConnectionPolicyStatus
+	plsName := PrivateLinkServiceName(azCtx.cfg, policy.Namespace, policy.Spec.ServiceName)
+
+	var managedIDs []string
+	for _, conn := range managed {
+		managedIDs = append(managedIDs, ManagedEndpointIDs(azCtx.cfg, azCtx.connectionSubscription(conn), conn)...)
+	}
+
+	cons, err := azCtx.PrivateLinkServicesClient.ListPrivateEndpointConnectionsComplete(ctx,
+		azCtx.cfg.LoadBalancerResourceGroup,
+		plsName)
+
+	if err != nil {
+		azCtx.warningEvent(policy, connectionPolicyError, err.Error())
+		return status, err
+	}
+
+	for ; cons.NotDone(); err = cons.NextWithContext(ctx) {
+		if err != nil {
+			return status, err
+		}
+
+		item := cons.Value()
+
+		if item.PrivateEndpointConnectionProperties == nil || item.PrivateEndpoint == nil || item.PrivateLinkServiceConnectionState == nil {
+			continue
+		}
+
+		endpointID := to.String(item.PrivateEndpoint.ID)
+
+		if containsFold(managedIDs, endpointID) {
+			continue
+		}
+
+		state := to.String(item.PrivateLinkServiceConnectionState.Status)
+		allowed, err := PolicyAllows(policy, endpointID, azCtx.tenants.get)
+
+		if err != nil {
+			//Without the tenant nothing can be decided about this connection; the others still are
+			azCtx.warningEvent(policy, connectionPolicyError, fmt.Sprintf("Endpoint %v: %v", endpointID, err))
+			countConnection(&status, state)
+			continue
+		}
+
+		action := PolicyAction(policy, state, allowed)
+
+		switch action {
+		case PolicyApprove:
+			err = azCtx.setPolicyConnectionState(plsName, item, approved, fmt.Sprintf("Approved by policy %v/%v", policy.Namespace, policy.Name))
+			state = approved
+		case PolicyReject:
+			err = azCtx.setPolicyConnectionState(plsName, item, ConnectionRejected, fmt.Sprintf("Rejected by policy %v/%v", policy.Namespace, policy.Name))
+			state = ConnectionRejected
+		case PolicyRemove:
+			err = azCtx.removePolicyConnection(plsName, item)
+			state = ""
+		}
+
+		if err != nil {
+			azCtx.warningEvent(policy, connectionPolicyError, fmt.Sprintf("Could not %v the connection of endpoint %v: %v", strings.ToLower(action), endpointID, err))
+			return status, err
+		}
+
+		switch action {
+		case PolicyApprove:
+			azCtx.successEvent(policy, connectionApprovedByPolicy, endpointID)
+		case PolicyReject:
+			azCtx.successEvent(policy, connectionRejectedByPolicy, endpointID)
+		case PolicyRemove:
+			azCtx.successEvent(policy, connectionRemovedByPolicy, endpointID)
+		}
+
+		countConnection(&status, state)
+	}
+
+	return status, nil
+}
+
+func (azCtx armContext) setPolicyConnectionState(plsName string, item n.PrivateEndpointConnection, state string, description string) error {
+
+	_, err := azCtx.PrivateLinkServicesClient.UpdatePrivateEndpointConnection(context.TODO(),
+		azCtx.cfg.LoadBalancerResourceGroup,
+		plsName,
+		*item.Name,
+		n.PrivateEndpointConnection{
+			Name: item.Name,
+			PrivateEndpointConnectionProperties: &n.PrivateEndpointConnectionProperties{
+				PrivateLinkServiceConnectionState: &n.PrivateLinkServiceConnectionState{
+					Status:      to.StringPtr(state),
+					Description: to.StringPtr(description),
+				},
+			},
+		},
+	)
+
+	return err
+}
+
+func (azCtx armContext) removePolicyConnection(plsName string, item n.PrivateEndpointConnection) error {
+
+	ctx := context.TODO()
+
+	future, err := azCtx.PrivateLinkServicesClient.DeletePrivateEndpointConnection(ctx,
+		azCtx.cfg.LoadBalancerResourceGroup,
+		plsName,
+		*item.Name,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return future.WaitForCompletionRef(ctx, azCtx.PrivateLinkServicesClient.Client)
+}
+
+//countConnection adds a connection in the given state to the policy status
+func countConnection(status *ConnectionPolicyStatus, state string) {
+	switch state {
+	case approved:
+		status.Approved++
+	case pending:
+		status.Pending++
+	case ConnectionRejected:
+		status.Rejected++
+	}
+}
+
+func containsFold(values []string, value string) bool {
+	for _, item := range values {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,193 @@
+package azure
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	apl "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
+	"github.com/garvinmsft/auto-private-link/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testEndpointID = "/subscriptions/partner-sub/resourceGroups/partner-rg/providers/Microsoft.Network/privateEndpoints/orders"
+
+func TestMatchesPattern(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		pattern string
+		value   string
+		want    bool
+	}{
+		{name: "exact", pattern: testEndpointID, value: testEndpointID, want: true},
+		{name: "case", pattern: "/SUBSCRIPTIONS/partner-sub/resourcegroups/partner-rg/providers/microsoft.network/privateendpoints/ORDERS", value: testEndpointID, want: true},
+		{name: "anything", pattern: "*", value: testEndpointID, want: true},
+		{name: "prefix", pattern: "/subscriptions/partner-sub/*", value: testEndpointID, want: true},
+		{name: "middle", pattern: "/subscriptions/*/resourceGroups/partner-rg/*", value: testEndpointID, want: true},
+		{name: "other resource group", pattern: "/subscriptions/*/resourceGroups/other-rg/*", value: testEndpointID},
+		{name: "anchored at the end", pattern: "/subscriptions/partner-sub", value: testEndpointID},
+		{name: "anchored at the start", pattern: "orders", value: testEndpointID},
+		{name: "regular expression characters are literal", pattern: "/subscriptions/partner.sub/*", value: testEndpointID},
+		{name: "empty pattern", pattern: "", value: testEndpointID},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := matchesPattern(test.pattern, test.value); got != test.want {
+				t.Fatalf("matchesPattern(%q, %q) = %v, want %v", test.pattern, test.value, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPolicyAllows(t *testing.T) {
+
+	tenants := map[string]string{"partner-sub": "partner-tenant"}
+
+	tests := []struct {
+		name       string
+		spec       apl.PrivateLinkConnectionPolicySpec
+		endpointID string
+		lookupErr  error
+		want       bool
+		lookups    int
+		valid      bool
+	}{
+		{name: "nothing allowed", endpointID: testEndpointID, valid: true},
+		{
+			name:       "subscription",
+			spec:       apl.PrivateLinkConnectionPolicySpec{AllowedSubscriptions: []string{"PARTNER-SUB"}, AllowedTenants: []string{"other-tenant"}},
+			endpointID: testEndpointID,
+			want:       true,
+			valid:      true,
+		},
+		{
+			name:       "endpoint pattern",
+			spec:       apl.PrivateLinkConnectionPolicySpec{AllowedEndpoints: []string{"*/privateEndpoints/orders"}, AllowedTenants: []string{"other-tenant"}},
+			endpointID: testEndpointID,
+			want:       true,
+			valid:      true,
+		},
+		{
+			name:       "tenant",
+			spec:       apl.PrivateLinkConnectionPolicySpec{AllowedSubscriptions: []string{"other-sub"}, AllowedTenants: []string{"Partner-Tenant"}},
+			endpointID: testEndpointID,
+			want:       true,
+			lookups:    1,
+			valid:      true,
+		},
+		{
+			name:       "other tenant",
+			spec:       apl.PrivateLinkConnectionPolicySpec{AllowedTenants: []string{"other-tenant"}},
+			endpointID: testEndpointID,
+			lookups:    1,
+			valid:      true,
+		},
+		{
+			name:       "failed tenant lookup",
+			spec:       apl.PrivateLinkConnectionPolicySpec{AllowedTenants: []string{"partner-tenant"}},
+			endpointID: testEndpointID,
+			lookupErr:  errors.New("forbidden"),
+			lookups:    1,
+		},
+		{
+			name:       "not a resource ID",
+			spec:       apl.PrivateLinkConnectionPolicySpec{AllowedEndpoints: []string{"*"}},
+			endpointID: "orders",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lookups := 0
+			lookup := func(subscriptionID string) (string, error) {
+				lookups++
+				return tenants[subscriptionID], test.lookupErr
+			}
+
+			policy := &apl.PrivateLinkConnectionPolicy{Spec: test.spec}
+			got, err := PolicyAllows(policy, test.endpointID, lookup)
+
+			if lookups != test.lookups {
+				t.Errorf("PolicyAllows() looked up %v tenants, want %v", lookups, test.lookups)
+			}
+			if !test.valid {
+				if err == nil {
+					t.Fatal("PolicyAllows() = nil error, want an error")
+				}
+				return
+			}
+			if err != nil || got != test.want {
+				t.Fatalf("PolicyAllows() = %v, %v, want %v", got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestPolicyAction(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		deniedAction string
+		state        string
+		allowed      bool
+		want         string
+	}{
+		{name: "allowed pending", state: pending, allowed: true, want: PolicyApprove},
+		{name: "allowed approved", state: approved, allowed: true},
+		{name: "allowed rejected stays rejected", deniedAction: apl.DeniedActionRemove, state: ConnectionRejected, allowed: true},
+		{name: "default leaves denied connections", state: pending},
+		{name: "leave", deniedAction: apl.DeniedActionLeave, state: approved},
+		{name: "reject pending", deniedAction: apl.DeniedActionReject, state: pending, want: PolicyReject},
+		{name: "reject leaves approved", deniedAction: apl.DeniedActionReject, state: approved},
+		{name: "reject rejected", deniedAction: apl.DeniedActionReject, state: ConnectionRejected},
+		{name: "reject disconnected", deniedAction: apl.DeniedActionReject, state: ConnectionDisconnected},
+		{name: "remove pending", deniedAction: apl.DeniedActionRemove, state: pending, want: PolicyRemove},
+		{name: "remove approved", deniedAction: apl.DeniedActionRemove, state: approved, want: PolicyRemove},
+		{name: "remove rejected", deniedAction: apl.DeniedActionRemove, state: ConnectionRejected, want: PolicyRemove},
+		{name: "remove disconnected", deniedAction: apl.DeniedActionRemove, state: ConnectionDisconnected, want: PolicyRemove},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := &apl.PrivateLinkConnectionPolicy{Spec: apl.PrivateLinkConnectionPolicySpec{DeniedAction: test.deniedAction}}
+
+			if got := PolicyAction(policy, test.state, test.allowed); got != test.want {
+				t.Fatalf("PolicyAction(%q, %v) = %q, want %q", test.state, test.allowed, got, test.want)
+			}
+		})
+	}
+}
+
+func TestManagedEndpointIDs(t *testing.T) {
+
+	cfg := config.Config{ClusterName: "aks", PrivateEndpointNameTemplate: "{name}"}
+	specID := "/subscriptions/sub/resourceGroups/endpoints/providers/Microsoft.Network/privateEndpoints/db"
+	renamedID := "/subscriptions/sub/resourceGroups/endpoints/providers/Microsoft.Network/privateEndpoints/web-db"
+
+	tests := []struct {
+		name     string
+		statusID string
+		want     []string
+	}{
+		{name: "endpoint not created yet", want: []string{specID}},
+		{name: "endpoint recorded in the status", statusID: specID, want: []string{specID}},
+		{name: "status in another case", statusID: "/SUBSCRIPTIONS/sub/resourceGroups/endpoints/providers/Microsoft.Network/privateEndpoints/DB", want: []string{specID}},
+		{name: "endpoint created under an older name template", statusID: renamedID, want: []string{specID, renamedID}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn := &apl.ServiceConnection{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: "db"},
+				Spec:       apl.ServiceConnectionSpec{ResourceGroup: "endpoints"},
+				Status:     apl.ServiceConnectionStatus{PrivateEndpointID: test.statusID},
+			}
+
+			if got := ManagedEndpointIDs(cfg, "sub", conn); !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("ManagedEndpointIDs() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
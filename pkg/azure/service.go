@@ -2,15 +2,19 @@ package azure
 
 import (
 	"context"
-	n "github.com/Azure/azure-sdk-for-go/services/network/mgmt/2020-05-01/network"
+	n "github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-05-01/network"
+	"github.com/garvinmsft/auto-private-link/pkg/config"
 	v1 "k8s.io/api/core/v1"
 	"fmt"
+	"strings"
 )
 
 
 const (
 	privateLinkServiceCreationError = "PrivateLinkServiceCreationError"
 	privateLinkServiceCreated = "PrivateLinkServiceCreated"
+	privateLinkServiceUpdated = "PrivateLinkServiceUpdated"
+	privateLinkServiceUpdateError = "PrivateLinkServiceUpdateError"
 	privateLinkServiceError = "PrivateLinkServiceError"
 	privateLinkServiceRemoved = "PrivateLinkServiceRemoved"
 	msgPrivateLinkServiceRemoved = "Private link service deleted!"
@@ -20,147 +24,246 @@ const (
 
 )
 
+//PrivateLinkServiceStatus is the state of a private link service as observed in Azure
+type PrivateLinkServiceStatus struct {
+	ID string
+	Alias string
+	ProvisioningState string
+	NatIPs []string
+	Connections []PrivateEndpointConnectionStatus
+}
+
+//PrivateEndpointConnectionStatus is the state of an endpoint connected to a private link service
+type PrivateEndpointConnectionStatus struct {
+	Name string
+	PrivateEndpointID string
+	Status string
+}
+
 //AddUpdatePrivateService adds or updates a private link service
-func (azCtx AzContext) AddUpdatePrivateService(service *v1.Service) error {
+func (azCtx armContext) AddUpdatePrivateService(service *v1.Service) (PrivateLinkServiceStatus, error) {
 
-	exists, err := azCtx.privateLinkServiceExists(service)
+	actual, exists, err := azCtx.getPrivateLinkService(service)
 
 	if err!=nil {
-		return err
+		return PrivateLinkServiceStatus{}, err
 	}
 
-	//Is there anything that may require an update in the resource? Don't think so
 	if exists {
-		return nil
+		if err := CheckOwner(azCtx.cfg, *actual.Name, actual.Tags, service); err != nil {
+			azCtx.warningEvent(service, resourceOwnershipConflict, err.Error())
+			return PrivateLinkServiceStatus{}, err
+		}
 	}
 
 	subnet , err := azCtx.getOrCreateNatSubnet(service)
 
 	if err != nil {
-		return err
+		return PrivateLinkServiceStatus{}, err
 	}
 
-	frontEndID, err := azCtx.getLoadBalancerFrontendIDForIP(service)
+	ips, err := ServiceIPs(service)
+
+	if err != nil {
+		azCtx.warningEvent(service, invalidAnnotation, err.Error())
+		return PrivateLinkServiceStatus{}, err
+	}
+
+	frontEndIDs, err := azCtx.getLoadBalancerFrontendIDs(service, ips)
 
 	if err!=nil {
-		return err
+		return PrivateLinkServiceStatus{}, err
 	}
 
-	aplID, err := azCtx.createPrivateLinkService(service, frontEndID, *subnet.ID)
-	
-	if err!= nil {
-		azCtx.warningEvent(service, privateLinkServiceCreationError, err.Error())
+	desired, err := DesiredPrivateLinkService(azCtx.cfg, azCtx.Location, service, frontEndIDs, subnet)
+
+	if err != nil {
+		azCtx.warningEvent(service, invalidAnnotation, err.Error())
+		return PrivateLinkServiceStatus{}, err
+	}
+
+	var current *n.PrivateLinkService
+	if exists {
+		current = &actual
+	}
+
+	if err := azCtx.checkNatCapacity(service, subnet, NatIPsNeeded(desired, current)); err != nil {
+		return PrivateLinkServiceStatus{}, err
 	}
+
+	if !exists {
+		pls, err := azCtx.putPrivateLinkService(desired)
 	
-	azCtx.successEvent(service, privateLinkServiceCreated, aplID)
+		if err!= nil {
+			azCtx.warningEvent(service, privateLinkServiceCreationError, err.Error())
+			return PrivateLinkServiceStatus{}, err
+		}
+	
+		azCtx.successEvent(service, privateLinkServiceCreated, *pls.ID)
 
-	return nil
+		return NewPrivateLinkServiceStatus(pls), nil
+	}
+
+	//Only update when something drifted. Frontend ips change when services are recreated and the PLS may be edited by hand
+	changed := DiffPrivateLinkService(desired, actual)
+
+	if len(changed) == 0 {
+		return NewPrivateLinkServiceStatus(actual), nil
+	}
+
+	pls, err := azCtx.putPrivateLinkService(mergePrivateLinkService(desired, actual))
+
+	if err != nil {
+		azCtx.warningEvent(service, privateLinkServiceUpdateError, err.Error())
+		return NewPrivateLinkServiceStatus(actual), err
+	}
+
+	azCtx.successEvent(service, privateLinkServiceUpdated, fmt.Sprintf("Updated %v of %v", strings.Join(changed, ", "), *pls.ID))
+
+	return NewPrivateLinkServiceStatus(pls), nil
 }
 
-func (azCtx AzContext) getLoadBalancerFrontendIDForIP(service *v1.Service) (string, error){
-	ctx := context.TODO() 
-		
-	lfcList, err := azCtx.LbFrontEndConfigClient.List(ctx, 
-		azCtx.cfg.LoadBalancerResourceGroup, 
-		azCtx.cfg.LoadBalancerName)
-	
-	if err!=nil {
-		return "", err
+//NewPrivateLinkServiceStatus reads the status of a private link service resource
+func NewPrivateLinkServiceStatus(pls n.PrivateLinkService) PrivateLinkServiceStatus {
+
+	status := PrivateLinkServiceStatus{
+		ID: *pls.ID,
 	}
 
-	var frontEndID string
+	if pls.PrivateLinkServiceProperties == nil {
+		return status
+	}
 
-	for _,i := range lfcList.Values() {
-		if service.Status.LoadBalancer.Ingress[0].IP == *i.PrivateIPAddress{
-			frontEndID = *i.ID
+	if pls.Alias != nil {
+		status.Alias = *pls.Alias
+	}
+
+	status.ProvisioningState = string(pls.ProvisioningState)
+
+	if pls.IPConfigurations != nil {
+		for _, item := range *pls.IPConfigurations {
+			if item.PrivateLinkServiceIPConfigurationProperties != nil && item.PrivateIPAddress != nil {
+				status.NatIPs = append(status.NatIPs, *item.PrivateIPAddress)
+			}
 		}
 	}
 
-	if frontEndID == "" {
-		return "", fmt.Errorf("Could not find service ip in the load balancer")
+	if pls.PrivateEndpointConnections == nil {
+		return status
 	}
 
-	return frontEndID, nil
+	for _, item := range *pls.PrivateEndpointConnections {
+		conn := PrivateEndpointConnectionStatus{
+			Name: *item.Name,
+		}
+
+		if item.PrivateEndpointConnectionProperties != nil {
+			if item.PrivateEndpoint != nil && item.PrivateEndpoint.ID != nil {
+				conn.PrivateEndpointID = *item.PrivateEndpoint.ID
+			}
+
+			if item.PrivateLinkServiceConnectionState != nil && item.PrivateLinkServiceConnectionState.Status != nil {
+				conn.Status = *item.PrivateLinkServiceConnectionState.Status
+			}
+		}
+
+		status.Connections = append(status.Connections, conn)
+	}
+
+	return status
 }
 
-func (azCtx AzContext) privateLinkServiceExists(service *v1.Service) (bool, error) {
+func (azCtx armContext) getPrivateLinkService(service *v1.Service) (n.PrivateLinkService, bool, error) {
 	ctx:= context.TODO()
 
-	result, err := azCtx.PrivateLinkServicesClient.Get(ctx, azCtx.cfg.LoadBalancerResourceGroup, service.Name, "")
+	result, err := azCtx.PrivateLinkServicesClient.Get(ctx, 
+		azCtx.cfg.LoadBalancerResourceGroup, 
+		PrivateLinkServiceName(azCtx.cfg, service.Namespace, service.Name),
+		"")
 
 	//3 possible states. There could be a permission error for example.
 	if err != nil {
-		if result.Response.Response.StatusCode == 404 {
-			return false, nil
+		if result.Response.Response != nil && result.Response.Response.StatusCode == 404 {
+			return result, false, nil
 		}
-		return false, err
+		return result, false, err
 	} 
 
-	return true, nil
+	return result, true, nil
 
 }
 
-func (azCtx AzContext) createPrivateLinkService(service *v1.Service, frontEndID string, subnetID string ) (string, error) {
+//DesiredPrivateLinkService builds the private link service the kubernetes service should have
+func DesiredPrivateLinkService(cfg config.Config, location string, service *v1.Service, frontEndIDs []string, subnet n.Subnet) (n.PrivateLinkService, error) {
 
-	ctx:= context.TODO()
+	name := PrivateLinkServiceName(cfg, service.Namespace, service.Name)
 
-	future, err := azCtx.PrivateLinkServicesClient.CreateOrUpdate(ctx, azCtx.cfg.LoadBalancerResourceGroup, service.Name, 
-		n.PrivateLinkService{
-			Name: &service.Name,
-			Location: &azCtx.Location,
-			PrivateLinkServiceProperties: &n.PrivateLinkServiceProperties{
-					LoadBalancerFrontendIPConfigurations: &[]n.FrontendIPConfiguration{
-					{
-						ID: &frontEndID,
-					},
-				},
-				IPConfigurations: &[]n.PrivateLinkServiceIPConfiguration{
-					{
-						PrivateLinkServiceIPConfigurationProperties: &n.PrivateLinkServiceIPConfigurationProperties{
-							Subnet: &n.Subnet{
-								ID: &subnetID,
-							},
-						},
-						Name: &service.Name,//should be unique accross namespaces unless namespace appended
-					},
-					
-				},
-			},
+	frontends := []n.FrontendIPConfiguration{}
+	for i := range frontEndIDs {
+		frontends = append(frontends, n.FrontendIPConfiguration{ID: &frontEndIDs[i]})
+	}
+
+	pls := n.PrivateLinkService{
+		Name: &name,
+		Location: &location,
+		PrivateLinkServiceProperties: &n.PrivateLinkServiceProperties{
+			LoadBalancerFrontendIPConfigurations: &frontends,
 		},
-	)
+	}
+
+	ipConfigs, err := NatIPConfigurations(service, name, subnet)
 
 	if err != nil {
-		return "", err
+		return pls, err
 	}
 
-	err = future.WaitForCompletionRef(ctx, azCtx.PrivateLinkServicesClient.Client)
+	pls.IPConfigurations = &ipConfigs
 
-	if err!= nil {
-		return "", err
+	if err := ApplyServiceAnnotations(service, &pls); err != nil {
+		return pls, err
+	}
+
+	//Ownership tags can't be overridden by annotations
+	for k, v := range OwnerTags(cfg, service) {
+		pls.Tags[k] = v
 	}
-	aplService, err := future.Result(azCtx.PrivateLinkServicesClient)
+
+	return pls, nil
+}
+
+func (azCtx armContext) putPrivateLinkService(pls n.PrivateLinkService) (n.PrivateLinkService, error) {
+
+	ctx:= context.TODO()
+
+	future, err := azCtx.PrivateLinkServicesClient.CreateOrUpdate(ctx, azCtx.cfg.LoadBalancerResourceGroup, *pls.Name, pls)
 
 	if err != nil {
-		return "", err
+		return n.PrivateLinkService{}, err
+	}
+
+	err = future.WaitForCompletionRef(ctx, azCtx.PrivateLinkServicesClient.Client)
+
+	if err!= nil {
+		return n.PrivateLinkService{}, err
 	}
 
-	return *aplService.ID, nil
+	return future.Result(azCtx.PrivateLinkServicesClient)
 }
 
-func (azCtx AzContext) createNatSubnet(service *v1.Service) (n.Subnet, error) {
+func (azCtx armContext) createNatSubnet(natSubnet NatSubnet) (n.Subnet, error) {
 
 	ctx := context.TODO()
 
 	var subnet n.Subnet
 
 	future, err := azCtx.SubnetClient.CreateOrUpdate(ctx,
-		azCtx.cfg.VnetResourceGroupName,
-		azCtx.cfg.VnetName,
-		azCtx.cfg.NatSubnetName,
+		natSubnet.ResourceGroup,
+		natSubnet.VnetName,
+		natSubnet.Name,
 		n.Subnet{
 			SubnetPropertiesFormat: &n.SubnetPropertiesFormat{
-				AddressPrefix: &azCtx.cfg.NatSubnetPrefix,
-				PrivateLinkServiceNetworkPolicies: &policyDisabled,
+				AddressPrefix: &natSubnet.Prefix,
+				PrivateLinkServiceNetworkPolicies: n.VirtualNetworkPrivateLinkServiceNetworkPoliciesDisabled,
 			},
 		},
 	)
@@ -186,18 +289,25 @@ func (azCtx AzContext) createNatSubnet(service *v1.Service) (n.Subnet, error) {
 	
 }
 
-//GetNatSubnetID gets the id of the NAT subnet. Create it if it doesn't exist
-func (azCtx AzContext) getOrCreateNatSubnet(service *v1.Service) (n.Subnet, error) {
+//getOrCreateNatSubnet gets the NAT subnet of a service. Create it if it doesn't exist and a prefix is given or a free one of the requested length is found
+func (azCtx armContext) getOrCreateNatSubnet(service *v1.Service) (n.Subnet, error) {
 
 	ctx := context.TODO()
 
+	natSubnet, err := NatSubnetFor(azCtx.cfg, service)
+
+	if err != nil {
+		azCtx.warningEvent(service, invalidAnnotation, err.Error())
+		return n.Subnet{}, err
+	}
+
 	//Get the NAT subnet if it exists
 	subnet, err := azCtx.SubnetClient.Get(ctx, 
-		azCtx.cfg.VnetResourceGroupName, 
-		azCtx.cfg.VnetName, 
-		azCtx.cfg.NatSubnetName,"")
+		natSubnet.ResourceGroup, 
+		natSubnet.VnetName, 
+		natSubnet.Name,"")
 
-	if err != nil && subnet.Response.Response.StatusCode != 404 {
+	if err != nil && !isNotFound(subnet.Response.Response) {
 		return subnet, err
 	} 
 
@@ -205,10 +315,18 @@ func (azCtx AzContext) getOrCreateNatSubnet(service *v1.Service) (n.Subnet, erro
 		return subnet, nil
 	}
 
-	subnet, err = azCtx.createNatSubnet(service)
+	natSubnet.Prefix, err = azCtx.natSubnetPrefix(natSubnet)
+
+	if err != nil {
+		azCtx.warningEvent(service, natSubnetCreationError, err.Error())
+		return subnet, err
+	}
+
+	subnet, err = azCtx.createNatSubnet(natSubnet)
 
 	if err!=nil {
 		azCtx.warningEvent(service, natSubnetCreationError, err.Error())
+		return subnet, err
 	}
 	
 	azCtx.successEvent(service, natSubnetCreated, *subnet.ID)
@@ -218,61 +336,66 @@ func (azCtx AzContext) getOrCreateNatSubnet(service *v1.Service) (n.Subnet, erro
 
 
 //RemoveService removes a private link service if it exists
-func (azCtx AzContext) RemoveService(service *v1.Service) error {
+func (azCtx armContext) RemoveService(service *v1.Service) error {
 
-	ctx := context.TODO()
-
-	apl, err := azCtx.PrivateLinkServicesClient.Get(ctx, 
-		azCtx.cfg.LoadBalancerResourceGroup,
-		service.Name,
-		"",
-	)
-	
+	apl, exists, err := azCtx.getPrivateLinkService(service)
 
 	if err != nil {
-		if apl.Response.Response.StatusCode == 404  {
-			return nil
-		}
+		return err
+	}
+
+	if !exists {
+		return nil
+	}
 
+	//Never delete a resource that another service or cluster owns
+	if err := CheckOwner(azCtx.cfg, *apl.Name, apl.Tags, service); err != nil {
+		azCtx.warningEvent(service, resourceOwnershipConflict, err.Error())
+		return nil
+	}
+
+	if err := azCtx.deletePrivateLinkService(azCtx.cfg.LoadBalancerResourceGroup, apl); err != nil {
+		azCtx.warningEvent(service, privateLinkServiceRemovalError, err.Error())
 		return err
 	}
 
-	for _, item := range *apl.PrivateEndpointConnections {
-		future, err := azCtx.PrivateLinkServicesClient.DeletePrivateEndpointConnection(ctx,
-			azCtx.cfg.LoadBalancerResourceGroup,
-			service.Name,
-			*item.Name,
-		)
+	azCtx.successEvent(service, privateLinkServiceRemoved, msgPrivateLinkServiceRemoved)
+	return nil
+}
 
-		if err != nil {
-			return err
-		}
+//deletePrivateLinkService removes the endpoint connections of a private link service and then the service itself
+func (azCtx armContext) deletePrivateLinkService(resourceGroup string, pls n.PrivateLinkService) error {
 
-		err = future.WaitForCompletionRef(ctx, azCtx.PrivateEndpointsClient.Client)
+	ctx := context.TODO()
 
-		if err != nil {
-			return err
+	if pls.PrivateLinkServiceProperties != nil && pls.PrivateEndpointConnections != nil {
+		for _, item := range *pls.PrivateEndpointConnections {
+			future, err := azCtx.PrivateLinkServicesClient.DeletePrivateEndpointConnection(ctx,
+				resourceGroup,
+				*pls.Name,
+				*item.Name,
+			)
+
+			if err != nil {
+				return err
+			}
+
+			err = future.WaitForCompletionRef(ctx, azCtx.PrivateLinkServicesClient.Client)
+
+			if err != nil {
+				return err
+			}
 		}
 	}
 
 	future, err := azCtx.PrivateLinkServicesClient.Delete(ctx,
-		azCtx.cfg.LoadBalancerResourceGroup,
-		service.Name,
+		resourceGroup,
+		*pls.Name,
 	)
 
 	if err != nil {
 		return err
 	}
 
-	err = future.WaitForCompletionRef(ctx, azCtx.PrivateLinkServicesClient.Client)
-
-	if err != nil {
-		azCtx.warningEvent(service, privateLinkServiceRemovalError, err.Error())
-		return err
-	}
-
-	azCtx.successEvent(service, privateLinkServiceRemoved, msgPrivateLinkServiceRemoved)
-	return nil
+	return future.WaitForCompletionRef(ctx, azCtx.PrivateLinkServicesClient.Client)
 }
-
-
@@ -0,0 +1,117 @@
+package azure
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	n "github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-05-01/network"
+	"github.com/Azure/azure-sdk-for-go/services/privatedns/mgmt/2018-09-01/privatedns"
+	"github.com/Azure/go-autorest/autorest"
+	apl "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
+)
+
+const (
+	authorizationFailed = "AuthorizationFailed"
+)
+
+//endpointClients are the clients that act on the consumer side of a connection, which can live in another subscription.
+//This includes the private DNS records pointing at the endpoint.
+type endpointClients struct {
+	SubnetClient n.SubnetsClient
+	PrivateEndpointsClient n.PrivateEndpointsClient
+	InterfacesClient n.InterfacesClient
+	RecordSetsClient privatedns.RecordSetsClient
+	PrivateZonesClient privatedns.PrivateZonesClient
+}
+
+//clientCache builds the endpoint clients of a subscription once and shares them between reconciles
+type clientCache struct {
+	mu sync.Mutex
+	baseURI string
+	authorizer autorest.Authorizer
+	sender autorest.Sender
+	lastSuccess *int64
+	clients map[string]endpointClients
+}
+
+func newClientCache(baseURI string, authorizer autorest.Authorizer, sender autorest.Sender, lastSuccess *int64) *clientCache {
+	return &clientCache{
+		baseURI: baseURI,
+		authorizer: authorizer,
+		sender: sender,
+		lastSuccess: lastSuccess,
+		clients: map[string]endpointClients{},
+	}
+}
+
+func (c *clientCache) get(subscriptionID string) endpointClients {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := strings.ToLower(subscriptionID)
+
+	if clients, ok := c.clients[key]; ok {
+		return clients
+	}
+
+	clients := endpointClients{
+		SubnetClient: n.NewSubnetsClientWithBaseURI(c.baseURI, subscriptionID),
+		PrivateEndpointsClient: n.NewPrivateEndpointsClientWithBaseURI(c.baseURI, subscriptionID),
+		InterfacesClient: n.NewInterfacesClientWithBaseURI(c.baseURI, subscriptionID),
+		RecordSetsClient: privatedns.NewRecordSetsClientWithBaseURI(c.baseURI, subscriptionID),
+		PrivateZonesClient: privatedns.NewPrivateZonesClientWithBaseURI(c.baseURI, subscriptionID),
+	}
+
+	prepareClient(&clients.SubnetClient.Client, c.authorizer, c.sender, c.lastSuccess)
+	prepareClient(&clients.PrivateEndpointsClient.Client, c.authorizer, c.sender, c.lastSuccess)
+	prepareClient(&clients.InterfacesClient.Client, c.authorizer, c.sender, c.lastSuccess)
+	prepareClient(&clients.RecordSetsClient.Client, c.authorizer, c.sender, c.lastSuccess)
+	prepareClient(&clients.PrivateZonesClient.Client, c.authorizer, c.sender, c.lastSuccess)
+
+	c.clients[key] = clients
+	return clients
+}
+
+//clientsFor returns the endpoint clients of a subscription, defaulting to the controller's own
+func (azCtx armContext) clientsFor(subscriptionID string) endpointClients {
+	if subscriptionID == "" {
+		subscriptionID = azCtx.SubscriptionID
+	}
+	return azCtx.endpointClients.get(subscriptionID)
+}
+
+//connectionSubscription is the subscription the endpoint of a connection is created in
+func (azCtx armContext) connectionSubscription(conn *apl.ServiceConnection) string {
+	if conn.Spec.SubscriptionID != "" {
+		return conn.Spec.SubscriptionID
+	}
+	return azCtx.SubscriptionID
+}
+
+//authorizationEvent raises a warning naming the subscription when ARM refused a request of the connection
+//because the controller identity lacks a role there. It reports whether the error was such a refusal.
+func (azCtx armContext) authorizationEvent(conn *apl.ServiceConnection, err error) bool {
+	if !isForbidden(err) {
+		return false
+	}
+
+	azCtx.warningEvent(conn, authorizationFailed,
+		fmt.Sprintf("The controller identity is not allowed to manage private endpoints in resource group %v of subscription %v. Grant it Network Contributor there: %v",
+			conn.Spec.ResourceGroup, azCtx.connectionSubscription(conn), err))
+
+	return true
+}
+
+func isForbidden(err error) bool {
+	var detailed autorest.DetailedError
+
+	if !errors.As(err, &detailed) {
+		return false
+	}
+
+	code, ok := detailed.StatusCode.(int)
+	return ok && code == http.StatusForbidden
+}
@@ -0,0 +1,78 @@
+package azure
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tenantLookupAPIVersion = "2020-01-01"
+	tenantLookupTimeout    = 10 * time.Second
+)
+
+var (
+	authorizationURIPattern = regexp.MustCompile(`authorization_uri="[^"]*/([0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})"`)
+)
+
+//tenantCache finds the Azure AD tenant of subscriptions the controller has no access to.
+//ARM answers an anonymous request for a subscription with a challenge naming the tenant's authority.
+type tenantCache struct {
+	mu      sync.Mutex
+	baseURI string
+	client  *http.Client
+	tenants map[string]string
+}
+
+//newTenantCache builds a tenant cache asking ARM at baseURI. A nil client uses one with tenantLookupTimeout
+func newTenantCache(baseURI string, client *http.Client) *tenantCache {
+	if client == nil {
+		client = &http.Client{Timeout: tenantLookupTimeout}
+	}
+
+	return &tenantCache{
+		baseURI: strings.TrimSuffix(baseURI, "/"),
+		client:  client,
+		tenants: map[string]string{},
+	}
+}
+
+//get returns the tenant of a subscription, asking ARM the first time
+func (c *tenantCache) get(subscriptionID string) (string, error) {
+
+	key := strings.ToLower(subscriptionID)
+
+	c.mu.Lock()
+	tenant, ok := c.tenants[key]
+	c.mu.Unlock()
+
+	if ok {
+		return tenant, nil
+	}
+
+	url := fmt.Sprintf("%v/subscriptions/%v?api-version=%v", c.baseURI, subscriptionID, tenantLookupAPIVersion)
+	response, err := c.client.Get(url)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer response.Body.Close()
+
+	match := authorizationURIPattern.FindStringSubmatch(response.Header.Get("WWW-Authenticate"))
+
+	if match == nil {
+		return "", fmt.Errorf("Could not find the tenant of subscription %v, ARM answered %v", subscriptionID, response.Status)
+	}
+
+	tenant = strings.ToLower(match[1])
+
+	c.mu.Lock()
+	c.tenants[key] = tenant
+	c.mu.Unlock()
+
+	return tenant, nil
+}
@@ -3,7 +3,9 @@ package config
 import (
 	"os"
 	"net"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 	v1 "k8s.io/api/core/v1"
 )
@@ -30,6 +32,12 @@ const (
 	//MaxRetryDelayEnvName the maximum amount of time (in seconds) to wait before retry sync
 	MaxRetryDelayEnvName = "MAX_RETRY_DELAY_SECONDS"
 
+	//PolicySyncPeriodEnvName the amount of time (in seconds) between checks of the connections a PrivateLinkConnectionPolicy applies to
+	PolicySyncPeriodEnvName = "POLICY_SYNC_PERIOD_SECONDS"
+
+	//DefaultPolicySyncPeriod is the default time (in seconds) between connection policy checks
+	DefaultPolicySyncPeriod = 60
+
 	//ServiceAnnotationEnvName name of the annotation the controller will used to select APL services
 	ServiceAnnotationEnvName = "SERVICE_ANNOTATION"
 
@@ -45,21 +53,151 @@ const (
 	//NatSubnetPrefixEnvName is the cidr value used for the apl NAT subnet (Required if submit doesn't exist)
 	NatSubnetPrefixEnvName = "NAT_SUBNET_PREFIX"
 
-	//LoadBalancerResourceGroupEnvName the name of the resource group containing the kubernetes internal load balancer
+	//NatSubnetPrefixLengthEnvName is the size (e.g. 28 for a /28) of the free prefix picked in the vnet for a NAT subnet created without a prefix. 0 disables it
+	NatSubnetPrefixLengthEnvName = "NAT_SUBNET_PREFIX_LENGTH"
+
+	//NatSubnetWarningPercentEnvName is the share (in percent) of used NAT subnet addresses above which a warning is raised
+	NatSubnetWarningPercentEnvName = "NAT_SUBNET_WARNING_PERCENT"
+
+	//DefaultNatSubnetWarningPercent is the default NAT subnet usage warning threshold in percent
+	DefaultNatSubnetWarningPercent = 80
+
+	//LoadBalancerResourceGroupEnvName the node resource group, searched for the load balancer of each service and holding the private link services
 	LoadBalancerResourceGroupEnvName = "KUB_INTERNAL_LOADBALANCER_RESOURCE_GROUP"
 
-	//LoadBalancerEnvName the name of the kubernetes internal load balancer
+	//LoadBalancerEnvName the name of the load balancer searched when discovery finds no frontend for a service ip. Optional
 	LoadBalancerEnvName = "KUB_INTERNAL_LOADBALANCER_NAME"
 
 	//AzureAuthLocationEnvName Location of the azure auth config file
 	AzureAuthLocationEnvName = "AZURE_AUTH_LOCATION"
 
+	//AuthModeEnvName selects how the controller authenticates to ARM
+	AuthModeEnvName = "AZURE_AUTH_MODE"
+
+	//AuthModeFile reads service principal credentials from the file at AZURE_AUTH_LOCATION
+	AuthModeFile = "file"
+
+	//AuthModeManagedIdentity uses the system or user assigned managed identity from IMDS
+	AuthModeManagedIdentity = "managedIdentity"
+
+	//AuthModePodIdentity uses the identity bound to the pod by AAD pod identity, which answers on the IMDS endpoint
+	AuthModePodIdentity = "podIdentity"
+
+	//AuthModeWorkloadIdentity exchanges the federated token in AZURE_FEDERATED_TOKEN_FILE for an AAD token
+	AuthModeWorkloadIdentity = "workloadIdentity"
+
+	//AuthModeCertificate authenticates a service principal with the PKCS#12 certificate at AZURE_CLIENT_CERTIFICATE_PATH
+	AuthModeCertificate = "certificate"
+
+	//CloudEnvironmentNameEnvName is the name of the Azure cloud, e.g. AzureUSGovernmentCloud or AzureChinaCloud
+	CloudEnvironmentNameEnvName = "AZURE_ENVIRONMENT"
+
+	//DefaultCloudEnvironmentName is the Azure public cloud
+	DefaultCloudEnvironmentName = "AzurePublicCloud"
+
+	//CloudEnvironmentURLEnvName is an ARM endpoint serving /metadata/endpoints, e.g. Azure Stack Hub. Overrides the environment name
+	CloudEnvironmentURLEnvName = "AZURE_ENVIRONMENT_URL"
+
+	//SubscriptionIDEnvName is the subscription of the network resources. Required unless the auth file provides it
+	SubscriptionIDEnvName = "AZURE_SUBSCRIPTION_ID"
+
+	//TenantIDEnvName is the AAD tenant of the identity
+	TenantIDEnvName = "AZURE_TENANT_ID"
+
+	//ClientIDEnvName is the client ID of the identity. Selects the user assigned identity for managed identity
+	ClientIDEnvName = "AZURE_CLIENT_ID"
+
+	//FederatedTokenFileEnvName is the path of the projected service account token used by workload identity
+	FederatedTokenFileEnvName = "AZURE_FEDERATED_TOKEN_FILE"
+
+	//AuthorityHostEnvName is the AAD endpoint used by workload identity
+	AuthorityHostEnvName = "AZURE_AUTHORITY_HOST"
+
+	//ClientCertificatePathEnvName is the path of the PKCS#12 client certificate
+	ClientCertificatePathEnvName = "AZURE_CLIENT_CERTIFICATE_PATH"
+
+	//ClientCertificatePasswordEnvName is the password of the client certificate
+	ClientCertificatePasswordEnvName = "AZURE_CLIENT_CERTIFICATE_PASSWORD"
+
+	//ClusterNameEnvName is the name identifying this cluster in Azure resource names and ownership tags
+	ClusterNameEnvName = "CLUSTER_NAME"
+
+	//PrivateLinkServiceNameTemplateEnvName is the template for private link service names
+	PrivateLinkServiceNameTemplateEnvName = "PRIVATE_LINK_SERVICE_NAME_TEMPLATE"
+
+	//PrivateEndpointNameTemplateEnvName is the template for private endpoint names
+	PrivateEndpointNameTemplateEnvName = "PRIVATE_ENDPOINT_NAME_TEMPLATE"
+
+	//DefaultNameTemplate names Azure resources after the namespace and name of the kubernetes object, so objects with the
+	//same name in different namespaces do not collide. Use {cluster}, {namespace} and {name} to build others
+	DefaultNameTemplate = "{namespace}-{name}"
+
+	//NameTemplatePlaceholder must appear in every name template
+	NameTemplatePlaceholder = "{name}"
+
+	//GarbageCollectionPeriodEnvName the amount of time (in seconds) between garbage collections of orphaned Azure resources. 0 disables it
+	GarbageCollectionPeriodEnvName = "GC_PERIOD_SECONDS"
+
+	//DefaultGarbageCollectionPeriod is the default time (in seconds) between garbage collections
+	DefaultGarbageCollectionPeriod = 600
+
+	//GarbageCollectionDryRunEnvName only reports orphaned Azure resources instead of deleting them when true
+	GarbageCollectionDryRunEnvName = "GC_DRY_RUN"
+
+	//GarbageCollectionResourceGroupsEnvName comma separated resource groups searched for orphaned Azure resources
+	GarbageCollectionResourceGroupsEnvName = "GC_RESOURCE_GROUPS"
+
+	//MetricsAddressEnvName is the address the prometheus /metrics endpoint listens on
+	MetricsAddressEnvName = "METRICS_BIND_ADDRESS"
+
+	//DefaultMetricsAddress is the default address of the /metrics endpoint
+	DefaultMetricsAddress = ":8080"
+
+	//HealthAddressEnvName is the address the /healthz, /readyz and pprof endpoints listen on
+	HealthAddressEnvName = "HEALTH_BIND_ADDRESS"
+
+	//DefaultHealthAddress is the default address of the health endpoints
+	DefaultHealthAddress = ":8081"
+
+	//EnablePprofEnvName serves /debug/pprof on the health address when true
+	EnablePprofEnvName = "ENABLE_PPROF"
+
+	//ArmHealthMaxAgeEnvName the amount of time (in seconds) without a successful ARM request before readiness checks ARM again
+	ArmHealthMaxAgeEnvName = "ARM_HEALTH_MAX_AGE_SECONDS"
+
+	//DefaultArmHealthMaxAge is the default ARM health max age in seconds
+	DefaultArmHealthMaxAge = 300
+
 	//AplPodEnvName name of pod currently running this controller
 	AplPodEnvName = "APL_POD_NAME"
 
 	//AplPodNamespaceEnvName name of pod currently running this controller
 	AplPodNamespaceEnvName = "APL_POD_NAMESPACE_NAME"
 
+	//LeaseNameEnvName is the name of the lease replicas of the controller compete for
+	LeaseNameEnvName = "LEADER_ELECTION_LEASE_NAME"
+
+	//DefaultLeaseName is the default name of the leader election lease
+	DefaultLeaseName = "auto-private-link"
+
+	//LeaseDurationEnvName the amount of time (in seconds) other replicas wait before taking over the lease of a leader that stopped renewing it
+	LeaseDurationEnvName = "LEADER_ELECTION_LEASE_DURATION_SECONDS"
+
+	//DefaultLeaseDuration is the default lease duration in seconds
+	DefaultLeaseDuration = 15
+
+	//RenewDeadlineEnvName the amount of time (in seconds) the leader keeps retrying to renew the lease before giving up leadership
+	RenewDeadlineEnvName = "LEADER_ELECTION_RENEW_DEADLINE_SECONDS"
+
+	//DefaultRenewDeadline is the default renew deadline in seconds
+	DefaultRenewDeadline = 10
+
+	//RetryPeriodEnvName the amount of time (in seconds) between attempts to acquire or renew the lease
+	RetryPeriodEnvName = "LEADER_ELECTION_RETRY_PERIOD_SECONDS"
+
+	//DefaultRetryPeriod is the default retry period in seconds
+	DefaultRetryPeriod = 2
+
 )
 
 //Config contains all variables needed to run a unique instance of the controller 
@@ -68,14 +206,43 @@ type Config struct {
 	VnetName string
 	NatSubnetName string
 	NatSubnetPrefix string
+	NatSubnetPrefixLength int
+	NatSubnetWarningPercent int
 	LoadBalancerResourceGroup string
 	LoadBalancerName string
 	SyncPeriod time.Duration
 	MinRetryDelay time.Duration
 	MaxRetryDelay time.Duration
+	PolicySyncPeriod time.Duration
 	ServiceAnnotation string
 	AzureAuthLocation string
+	AuthMode string
+	CloudEnvironmentName string
+	CloudEnvironmentURL string
+	SubscriptionID string
+	TenantID string
+	ClientID string
+	FederatedTokenFile string
+	AuthorityHost string
+	ClientCertificatePath string
+	ClientCertificatePassword string
+	ClusterName string
+	PrivateLinkServiceNameTemplate string
+	PrivateEndpointNameTemplate string
+	GarbageCollectionPeriod time.Duration
+	GarbageCollectionDryRun bool
+	GarbageCollectionResourceGroups []string
+	MetricsAddress string
+	HealthAddress string
+	EnablePprof bool
+	ArmHealthMaxAge time.Duration
 	APlPod *v1.Pod
+	PodName string
+	PodNamespace string
+	LeaseName string
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod time.Duration
 }
 
 //NewConfigFromEnv get config from env
@@ -89,6 +256,24 @@ func NewConfigFromEnv() (Config, error) {
 		LoadBalancerName: os.Getenv(LoadBalancerEnvName),
 		ServiceAnnotation: os.Getenv(ServiceAnnotationEnvName),
 		AzureAuthLocation: os.Getenv(AzureAuthLocationEnvName),
+		AuthMode: os.Getenv(AuthModeEnvName),
+		CloudEnvironmentName: os.Getenv(CloudEnvironmentNameEnvName),
+		CloudEnvironmentURL: os.Getenv(CloudEnvironmentURLEnvName),
+		SubscriptionID: os.Getenv(SubscriptionIDEnvName),
+		TenantID: os.Getenv(TenantIDEnvName),
+		ClientID: os.Getenv(ClientIDEnvName),
+		FederatedTokenFile: os.Getenv(FederatedTokenFileEnvName),
+		AuthorityHost: os.Getenv(AuthorityHostEnvName),
+		ClientCertificatePath: os.Getenv(ClientCertificatePathEnvName),
+		ClientCertificatePassword: os.Getenv(ClientCertificatePasswordEnvName),
+		ClusterName: os.Getenv(ClusterNameEnvName),
+		PrivateLinkServiceNameTemplate: os.Getenv(PrivateLinkServiceNameTemplateEnvName),
+		PrivateEndpointNameTemplate: os.Getenv(PrivateEndpointNameTemplateEnvName),
+		PodName: os.Getenv(AplPodEnvName),
+		PodNamespace: os.Getenv(AplPodNamespaceEnvName),
+		LeaseName: os.Getenv(LeaseNameEnvName),
+		MetricsAddress: os.Getenv(MetricsAddressEnvName),
+		HealthAddress: os.Getenv(HealthAddressEnvName),
 	}
 
 	if i, err := strconv.Atoi(os.Getenv(SyncPeriodEnvName)); err == nil{
@@ -109,10 +294,102 @@ func NewConfigFromEnv() (Config, error) {
 		cfg.MaxRetryDelay = time.Duration(DefaultMaxRetryDelay) * time.Second
 	}
 
+	if i, err := strconv.Atoi(os.Getenv(PolicySyncPeriodEnvName)); err == nil{
+		cfg.PolicySyncPeriod = time.Duration(i) * time.Second
+	} else {
+		cfg.PolicySyncPeriod = time.Duration(DefaultPolicySyncPeriod) * time.Second
+	}
+
+	if i, err := strconv.Atoi(os.Getenv(GarbageCollectionPeriodEnvName)); err == nil{
+		cfg.GarbageCollectionPeriod = time.Duration(i) * time.Second
+	} else {
+		cfg.GarbageCollectionPeriod = time.Duration(DefaultGarbageCollectionPeriod) * time.Second
+	}
+
+	if i, err := strconv.Atoi(os.Getenv(LeaseDurationEnvName)); err == nil{
+		cfg.LeaseDuration = time.Duration(i) * time.Second
+	} else {
+		cfg.LeaseDuration = time.Duration(DefaultLeaseDuration) * time.Second
+	}
+
+	if i, err := strconv.Atoi(os.Getenv(RenewDeadlineEnvName)); err == nil{
+		cfg.RenewDeadline = time.Duration(i) * time.Second
+	} else {
+		cfg.RenewDeadline = time.Duration(DefaultRenewDeadline) * time.Second
+	}
+
+	if i, err := strconv.Atoi(os.Getenv(RetryPeriodEnvName)); err == nil{
+		cfg.RetryPeriod = time.Duration(i) * time.Second
+	} else {
+		cfg.RetryPeriod = time.Duration(DefaultRetryPeriod) * time.Second
+	}
+
+	if i, err := strconv.Atoi(os.Getenv(ArmHealthMaxAgeEnvName)); err == nil{
+		cfg.ArmHealthMaxAge = time.Duration(i) * time.Second
+	} else {
+		cfg.ArmHealthMaxAge = time.Duration(DefaultArmHealthMaxAge) * time.Second
+	}
+
+	if i, err := strconv.Atoi(os.Getenv(NatSubnetWarningPercentEnvName)); err == nil{
+		cfg.NatSubnetWarningPercent = i
+	} else {
+		cfg.NatSubnetWarningPercent = DefaultNatSubnetWarningPercent
+	}
+
+	cfg.NatSubnetPrefixLength, _ = strconv.Atoi(os.Getenv(NatSubnetPrefixLengthEnvName))
+
+	cfg.EnablePprof, _ = strconv.ParseBool(os.Getenv(EnablePprofEnvName))
+
+	if cfg.HealthAddress == "" {
+		cfg.HealthAddress = DefaultHealthAddress
+	}
+
+	if cfg.MetricsAddress == "" {
+		cfg.MetricsAddress = DefaultMetricsAddress
+	}
+
+	if cfg.LeaseName == "" {
+		cfg.LeaseName = DefaultLeaseName
+	}
+
+	cfg.GarbageCollectionDryRun, _ = strconv.ParseBool(os.Getenv(GarbageCollectionDryRunEnvName))
+
+	for _, rg := range strings.Split(os.Getenv(GarbageCollectionResourceGroupsEnvName), ",") {
+		if rg = strings.TrimSpace(rg); rg != "" {
+			cfg.GarbageCollectionResourceGroups = append(cfg.GarbageCollectionResourceGroups, rg)
+		}
+	}
+
+	//Private link services are created next to the load balancer
+	if len(cfg.GarbageCollectionResourceGroups) == 0 {
+		cfg.GarbageCollectionResourceGroups = []string{cfg.LoadBalancerResourceGroup}
+	}
+
+	if cfg.AuthMode == "" {
+		cfg.AuthMode = AuthModeFile
+	}
+
+	if cfg.CloudEnvironmentName == "" {
+		cfg.CloudEnvironmentName = DefaultCloudEnvironmentName
+	}
+
 	if cfg.ServiceAnnotation == "" {
 		cfg.ServiceAnnotation = DefaultServiceAnnotation
 	}
 
+	//The node resource group is unique per AKS cluster
+	if cfg.ClusterName == "" {
+		cfg.ClusterName = cfg.LoadBalancerResourceGroup
+	}
+
+	if cfg.PrivateLinkServiceNameTemplate == "" {
+		cfg.PrivateLinkServiceNameTemplate = DefaultNameTemplate
+	}
+
+	if cfg.PrivateEndpointNameTemplate == "" {
+		cfg.PrivateEndpointNameTemplate = DefaultNameTemplate
+	}
+
 	if err := cfg.parse(); err != nil {
 		return cfg, err
 	} 
@@ -120,6 +397,11 @@ func NewConfigFromEnv() (Config, error) {
 	return cfg, nil
 }
 
+//LeaderElection is enabled when the controller knows the name of its pod, which identifies it in the lease
+func (cfg Config) LeaderElection() bool {
+	return cfg.PodName != ""
+}
+
 func (cfg* Config) parse() error {
 	if cfg.VnetResourceGroupName == "" {
 		return ErrorNoVnetResourceGroup
@@ -137,18 +419,76 @@ func (cfg* Config) parse() error {
 		return ErrorNoSubnetPrefix
 	} 
 
+	if cfg.NatSubnetPrefixLength < 0 || cfg.NatSubnetPrefixLength > 29 {
+		return ErrorInvalidSubnetPrefixLength
+	}
+
+	if cfg.NatSubnetWarningPercent < 1 || cfg.NatSubnetWarningPercent > 100 {
+		return ErrorInvalidSubnetWarningPercent
+	}
+
 	if cfg.LoadBalancerResourceGroup == ""{
 		return ErrorNoLoadBalancerResourceGroup
 	}
 
-	if cfg.LoadBalancerName == "" {
-		return ErrorNoLoadBalancer
+	if u, err := url.Parse(cfg.CloudEnvironmentURL); cfg.CloudEnvironmentURL != "" && (err != nil || !u.IsAbs()) {
+		return ErrorInvalidCloudEnvironmentURL
 	}
 
-	if cfg.AzureAuthLocation == "" {
-		return ErrorNoAzureConfigFile
+	if err := cfg.parseAuth(); err != nil {
+		return err
+	}
+
+	if !strings.Contains(cfg.PrivateLinkServiceNameTemplate, NameTemplatePlaceholder) ||
+		!strings.Contains(cfg.PrivateEndpointNameTemplate, NameTemplatePlaceholder) {
+		return ErrorInvalidNameTemplate
+	}
+
+	if cfg.PodName != "" && cfg.PodNamespace == "" {
+		return ErrorNoPodNamespace
+	}
+
+	if cfg.RetryPeriod <= 0 || cfg.RenewDeadline <= cfg.RetryPeriod || cfg.LeaseDuration <= cfg.RenewDeadline {
+		return ErrorInvalidLeaderElection
 	}
 
 
 	return nil
-}
\ No newline at end of file
+}
+
+func (cfg* Config) parseAuth() error {
+	switch cfg.AuthMode {
+	case AuthModeFile:
+		if cfg.AzureAuthLocation == "" {
+			return ErrorNoAzureConfigFile
+		}
+		//The subscription comes from the auth file
+		return nil
+	case AuthModeManagedIdentity, AuthModePodIdentity:
+		//IMDS needs no further settings
+	case AuthModeWorkloadIdentity:
+		if cfg.TenantID == "" || cfg.ClientID == "" {
+			return ErrorNoIdentity
+		}
+
+		if cfg.FederatedTokenFile == "" {
+			return ErrorNoFederatedTokenFile
+		}
+	case AuthModeCertificate:
+		if cfg.TenantID == "" || cfg.ClientID == "" {
+			return ErrorNoIdentity
+		}
+
+		if cfg.ClientCertificatePath == "" {
+			return ErrorNoClientCertificate
+		}
+	default:
+		return ErrorInvalidAuthMode
+	}
+
+	if cfg.SubscriptionID == "" {
+		return ErrorNoSubscriptionID
+	}
+
+	return nil
+}
@@ -17,18 +17,48 @@ var (
 	//ErrorNoSubnetPrefix is displayed when the resource group param is missing
 	ErrorNoSubnetPrefix = errors.New("Sudnet prefix must be in cidr notation: y.y.y.y/z")
 
+	//ErrorInvalidSubnetPrefixLength is displayed when the NAT subnet prefix length is not between 1 and 29, the smallest subnet Azure allows
+	ErrorInvalidSubnetPrefixLength = errors.New("NAT subnet prefix length must be from 1 to 29, or 0 to disable picking a prefix")
+
+	//ErrorInvalidSubnetWarningPercent is displayed when the NAT subnet warning threshold is not a percentage
+	ErrorInvalidSubnetWarningPercent = errors.New("NAT subnet warning percent must be from 1 to 100")
+
 	//ErrorNoLoadBalancerResourceGroup is displayed when the load balancer resource group param is missing
 	ErrorNoLoadBalancerResourceGroup = errors.New("Missing Resource Group param for load balancer")
 
-	//ErrorNoLoadBalancer is displayed when the load balancer param is missing
-	ErrorNoLoadBalancer = errors.New("Missing load balancer")
-
 	//ErrorNoReconcilePeriod is displayed when the load balancer param is missing
 	ErrorNoReconcilePeriod = errors.New("Missing reconcile period")
 
 	//ErrorNoAzureConfigFile is displayed when the load balancer param is missing
 	ErrorNoAzureConfigFile = errors.New("Missing azure config file location")
 
+	//ErrorInvalidNameTemplate is displayed when a resource name template does not contain {name}
+	ErrorInvalidNameTemplate = errors.New("Resource name templates must contain {name}")
+
+	//ErrorNoPodNamespace is displayed when the pod name is set without the pod namespace
+	ErrorNoPodNamespace = errors.New("Leader election requires the namespace of the pod")
+
+	//ErrorInvalidLeaderElection is displayed when the leader election durations do not satisfy lease duration > renew deadline > retry period > 0
+	ErrorInvalidLeaderElection = errors.New("Lease duration must be greater than renew deadline, which must be greater than retry period")
+
+	//ErrorInvalidAuthMode is displayed when the auth mode is not one of the supported modes
+	ErrorInvalidAuthMode = errors.New("Auth mode must be file, managedIdentity, podIdentity, workloadIdentity or certificate")
+
+	//ErrorNoSubscriptionID is displayed when the subscription is missing and there is no auth file to read it from
+	ErrorNoSubscriptionID = errors.New("Missing subscription id")
+
+	//ErrorNoIdentity is displayed when the tenant or client id needed by the auth mode is missing
+	ErrorNoIdentity = errors.New("Missing tenant id or client id")
+
+	//ErrorNoFederatedTokenFile is displayed when workload identity is used without a token file
+	ErrorNoFederatedTokenFile = errors.New("Missing federated token file")
+
+	//ErrorNoClientCertificate is displayed when certificate auth is used without a certificate
+	ErrorNoClientCertificate = errors.New("Missing client certificate path")
+
+	//ErrorInvalidCloudEnvironmentURL is displayed when the cloud metadata endpoint is not an absolute URL
+	ErrorInvalidCloudEnvironmentURL = errors.New("Cloud environment URL must be an absolute URL")
+
 	//ErrorNoAzureRegion is displayed when the load balancer param is missing
 	ErrorNoAzureRegion = errors.New("Missing azure region configuration")
 )
\ No newline at end of file
@@ -4,7 +4,9 @@ import (
 
 	"fmt"
 	"time"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/wait"
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
@@ -14,6 +16,7 @@ import (
 	apl "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
 	"github.com/garvinmsft/auto-private-link/pkg/azure"
 	"github.com/garvinmsft/auto-private-link/pkg/config"
+	"github.com/garvinmsft/auto-private-link/pkg/metrics"
 	connClientset "github.com/garvinmsft/auto-private-link/pkg/generated/clientset/versioned"
 	informers "github.com/garvinmsft/auto-private-link/pkg/generated/informers/externalversions/apl/v1alpha1"
 	listers "github.com/garvinmsft/auto-private-link/pkg/generated/listers/apl/v1alpha1"
@@ -26,6 +29,9 @@ const (
 	component = "auto-private-link"
 	controllerTag = "apl-connection"
 	noServiceForPrivateConnection ="NoServiceForPrivateConnection"
+	invalidApproval = "InvalidApproval"
+	reconcileError = "ReconcileError"
+	metricsController = "connection"
 )
 
 var (
@@ -92,6 +98,21 @@ func New(
 		cfg.SyncPeriod,
 	)
 
+	//Approvals are given on the service, so its connections are synced when its approval annotations change.
+	//The status annotations the service controller writes on every sync are left out
+	svcIformer.Informer().AddEventHandler(
+		cache.ResourceEventHandlerFuncs{
+			UpdateFunc: func(old, cur interface{}) {
+				oldService, ok := old.(*v1.Service)
+				service, curOk := cur.(*v1.Service)
+
+				if ok && curOk && approvalAnnotationsChanged(oldService, service) {
+					s.enqueueServiceConnections(service)
+				}
+			},
+		},
+	)
+
 	return s
 }
 
@@ -109,6 +130,11 @@ func (s *Controller) Run(stopCh <-chan struct{}, workers int) {
 	}
 }
 
+//HasSynced reports whether the connection and service caches have synced
+func (s *Controller) HasSynced() bool {
+	return s.connListerSynced() && s.serviceListerSynced()
+}
+
 //ShutDown does cleanup when controller is terminated 
 func (s *Controller) ShutDown() {
 	klog.Info("Shutting down connection controller")
@@ -126,6 +152,22 @@ func (s *Controller) enqueueConnection(conn *apl.ServiceConnection ) {
 	s.queue.Add(key)
 }
 
+//enqueueServiceConnections queues the connections to a service
+func (s *Controller) enqueueServiceConnections(service *v1.Service) {
+
+	conns, err := s.connLister.ServiceConnections(service.Namespace).List(labels.Everything())
+	if err != nil {
+		klog.Error(err.Error())
+		return
+	}
+
+	for _, conn := range conns {
+		if conn.Spec.ServiceName == service.Name {
+			s.enqueueConnection(conn)
+		}
+	}
+}
+
 func (s *Controller) connWorker() {
 	for s.processNextConnItem() {
 	}
@@ -138,7 +180,10 @@ func (s *Controller) processNextConnItem() bool {
 	}
 	defer s.queue.Done(key)
 
+	start := time.Now()
 	err := s.syncConnection(key.(string))
+	metrics.ObserveReconcile(metricsController, start, err)
+
 	if err == nil {
 		s.queue.Forget(key)
 		return true
@@ -167,38 +212,102 @@ func (s *Controller) syncConnection(key string) error {
 		// processing.
 		if errors.IsNotFound(err) {
 			klog.V(5).Infof("connection '%s' in work queue no longer exists", key)
+			metrics.ForgetPrivateEndpoint(key)
 			return nil
 		} 
 		
 		return err	
 	}
 
-	service, err := s.serviceLister.Services(namespace).Get(conn.Spec.ServiceName)
+	var service *v1.Service
+	serviceDeleted := false
 
-	if err!= nil {
-		if errors.IsNotFound(err) {
-			msg := fmt.Sprintf("Tried to sync connection: %s but service: %s does not exist in namespace: %s",  conn.Name, conn.Spec.ServiceName, namespace)
-			klog.Warning(msg)
-			s.eventRecorder.Event(conn, v1.EventTypeWarning, noServiceForPrivateConnection ,msg)
-			return s.cleanupConnection(conn)
+	//Connections to private link services outside the cluster have no service to follow
+	if conn.Spec.ServiceName != "" {
+		service, err = s.serviceLister.Services(namespace).Get(conn.Spec.ServiceName)
+
+		if err!= nil {
+			if errors.IsNotFound(err) {
+				msg := fmt.Sprintf("Tried to sync connection: %s but service: %s does not exist in namespace: %s",  conn.Name, conn.Spec.ServiceName, namespace)
+				klog.Warning(msg)
+				s.eventRecorder.Event(conn, v1.EventTypeWarning, noServiceForPrivateConnection ,msg)
+
+				if conn.DeletionTimestamp == nil {
+					if err := s.updateStatus(conn, azure.PrivateEndpointStatus{}, noServiceForPrivateConnection, fmt.Errorf(msg)); err != nil {
+						return err
+					}
+				}
+
+				return s.cleanupConnection(conn)
+			}
+			return err
 		}
-		return err
+
+		serviceDeleted = service.DeletionTimestamp != nil
 	}
 
-	if service.DeletionTimestamp != nil || conn.DeletionTimestamp != nil {
+	if serviceDeleted || conn.DeletionTimestamp != nil {
 		return s.cleanupConnection(conn)
 	}
 	
 
 	klog.V(5).Infof("Syncing for apl service connection: %v", conn.Name)
 
-	err = s.addFinalizer(s.connClient, conn)
+	conn, err = s.addFinalizer(s.connClient, conn)
 	if err!= nil {
 		return err
 	}
 	
-	return s.azContext.AddUpdatePrivateConnection(conn, conn.Spec.ServiceName)
+	if isFailed(conn) {
+		klog.V(5).Infof("connection %v failed with recovery policy Fail, waiting for a spec change", key)
+		return nil
+	}
+
+	var approval *azure.Approval
+
+	if service != nil {
+		//A broken approval annotation leaves the connection pending rather than blocking the endpoint
+		if approval, err = azure.ConnectionApproval(service, conn); err != nil {
+			s.eventRecorder.Event(conn, v1.EventTypeWarning, invalidApproval, err.Error())
+		}
+	}
+
+	ep, err := s.azContext.AddUpdatePrivateConnection(conn, conn.Spec.ServiceName, approval)
+
+	if err != nil && !needsRecovery(ep) {
+		metrics.SetPrivateEndpointState(key, metrics.ResultError)
+	} else {
+		metrics.SetPrivateEndpointState(key, ep.ConnectionStatus)
+	}
+
+	if err != nil && needsRecovery(ep) {
+		return s.recoverConnection(conn, ep, err)
+	}
+
+	if statusErr := s.updateStatus(conn, ep, errorReason(err), err); statusErr != nil {
+		klog.Errorf("Could not update status of connection %v: %v", key, statusErr)
 
+		if err == nil {
+			return statusErr
+		}
+	}
+
+	return err
+}
+
+//updateStatus writes the observed state of the endpoint to the connection if it changed
+func (s *Controller) updateStatus(conn *apl.ServiceConnection, ep azure.PrivateEndpointStatus, reason string, err error) error {
+
+	status := newConnectionStatus(conn, ep, reason, err)
+
+	if equality.Semantic.DeepEqual(conn.Status, status) {
+		return nil
+	}
+
+	updated := conn.DeepCopy()
+	updated.Status = status
+
+	return updateConnectionStatus(s.connClient, updated)
 }
 
 
@@ -211,6 +320,10 @@ func (s *Controller) cleanupConnection(conn *apl.ServiceConnection) error {
 		return err
 	}
 
+	if key, err := cache.MetaNamespaceKeyFunc(conn); err == nil {
+		metrics.ForgetPrivateEndpoint(key)
+	}
+
 	return removeFinalizer(s.connClient, conn)
 
 }
@@ -0,0 +1,523 @@
+package connection
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	apl "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
+	"github.com/garvinmsft/auto-private-link/pkg/azure"
+	"github.com/garvinmsft/auto-private-link/pkg/azure/fake"
+	"github.com/garvinmsft/auto-private-link/pkg/config"
+	aplfake "github.com/garvinmsft/auto-private-link/pkg/generated/clientset/versioned/fake"
+	aplinformers "github.com/garvinmsft/auto-private-link/pkg/generated/informers/externalversions"
+)
+
+const (
+	testServiceIP     = "10.0.0.4"
+	testResourceGroup = "consumer-rg"
+)
+
+func testConfig() config.Config {
+	return config.Config{
+		VnetResourceGroupName:          "vnet-rg",
+		VnetName:                       "vnet",
+		NatSubnetName:                  "nat",
+		LoadBalancerResourceGroup:      "mc_rg",
+		LoadBalancerName:               "kubernetes-internal",
+		ServiceAnnotation:              "garvinmsft.github.com/apl",
+		ClusterName:                    "aks",
+		PrivateLinkServiceNameTemplate: "{name}",
+		PrivateEndpointNameTemplate:    "{name}",
+		NatSubnetWarningPercent:        80,
+		MinRetryDelay:                  time.Millisecond,
+		MaxRetryDelay:                  time.Second,
+	}
+}
+
+func testService(annotations map[string]string) *v1.Service {
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: "frontend", UID: "uid-frontend", Annotations: annotations},
+		Spec:       v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+		Status: v1.ServiceStatus{
+			LoadBalancer: v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: testServiceIP}}},
+		},
+	}
+}
+
+func testConnection(recoveryPolicy string) *apl.ServiceConnection {
+	return &apl.ServiceConnection{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: "db", UID: "uid-db", Generation: 1},
+		Spec: apl.ServiceConnectionSpec{
+			ServiceName:    "frontend",
+			RecoveryPolicy: recoveryPolicy,
+			ResourceGroup:  testResourceGroup,
+			VnetName:       "consumer-vnet",
+			SubnetName:     "endpoints",
+		},
+	}
+}
+
+//testController is a connection controller against the fake ARM backend, with the private link service
+//of the service already created. Objects are put in the listers as the informers would, without running them
+type testController struct {
+	*Controller
+	az            *fake.AzContext
+	aplClient     *aplfake.Clientset
+	kubeInformers kubeinformers.SharedInformerFactory
+	aplInformers  aplinformers.SharedInformerFactory
+}
+
+func newTestController(t *testing.T, service *v1.Service, conn *apl.ServiceConnection) *testController {
+	t.Helper()
+
+	cfg := testConfig()
+	az := fake.NewAzContext(cfg)
+	az.AddSubnet(cfg.VnetResourceGroupName, cfg.VnetName, cfg.NatSubnetName, "10.0.2.0/24")
+	az.AddSubnet(testResourceGroup, "consumer-vnet", "endpoints", "10.1.0.0/24")
+	az.AddFrontendIPConfiguration(testServiceIP)
+
+	if _, err := az.AddUpdatePrivateService(service); err != nil {
+		t.Fatal(err)
+	}
+
+	kubeClient := kubefake.NewSimpleClientset(service)
+	aplClient := aplfake.NewSimpleClientset(conn)
+	kubeInformers := kubeinformers.NewSharedInformerFactory(kubeClient, 0)
+	aplInformers := aplinformers.NewSharedInformerFactory(aplClient, 0)
+
+	c := &testController{
+		Controller: New(aplClient, kubeClient, aplInformers.Apl().V1alpha1().ServiceConnections(),
+			kubeInformers.Core().V1().Services(), cfg, az, record.NewFakeRecorder(100)),
+		az:            az,
+		aplClient:     aplClient,
+		kubeInformers: kubeInformers,
+		aplInformers:  aplInformers,
+	}
+
+	c.observeService(t, service)
+	c.observe(t, conn)
+
+	return c
+}
+
+func (c *testController) observeService(t *testing.T, service *v1.Service) {
+	t.Helper()
+
+	if err := c.kubeInformers.Core().V1().Services().Informer().GetIndexer().Update(service); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *testController) observe(t *testing.T, conn *apl.ServiceConnection) {
+	t.Helper()
+
+	if err := c.aplInformers.Apl().V1alpha1().ServiceConnections().Informer().GetIndexer().Update(conn); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//sync reconciles the connection as last written to the api server
+func (c *testController) sync(t *testing.T) (*apl.ServiceConnection, error) {
+	t.Helper()
+
+	c.observe(t, c.current(t))
+	err := c.syncConnection("web/db")
+
+	return c.current(t), err
+}
+
+func (c *testController) current(t *testing.T) *apl.ServiceConnection {
+	t.Helper()
+
+	conn, err := c.aplClient.AplV1alpha1().ServiceConnections("web").Get(context.TODO(), "db", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func condition(conn *apl.ServiceConnection, conditionType string) apl.Condition {
+	for _, item := range conn.Status.Conditions {
+		if item.Type == conditionType {
+			return item
+		}
+	}
+	return apl.Condition{}
+}
+
+func TestSyncConnectionApprovesAutomatically(t *testing.T) {
+
+	c := newTestController(t, testService(nil), testConnection(""))
+
+	conn, err := c.sync(t)
+	if err != nil {
+		t.Fatalf("syncConnection() = %v", err)
+	}
+
+	ep, ok := c.az.PrivateEndpoint(testResourceGroup, "db")
+	if !ok {
+		t.Fatal("private endpoint was not created")
+	}
+
+	if !hasFinalizer(conn) {
+		t.Error("connection has no finalizer")
+	}
+	if conn.Status.PrivateEndpointID != *ep.ID {
+		t.Errorf("status endpoint = %q, want %q", conn.Status.PrivateEndpointID, *ep.ID)
+	}
+	if conn.Status.ConnectionStatus != connectionApproved {
+		t.Errorf("status connection = %q, want %v", conn.Status.ConnectionStatus, connectionApproved)
+	}
+	if ready := condition(conn, apl.ConditionReady); ready.Status != metav1.ConditionTrue {
+		t.Errorf("Ready condition = %+v, want True", ready)
+	}
+}
+
+func TestSyncConnectionWaitsForManualApproval(t *testing.T) {
+
+	service := testService(map[string]string{azure.ApprovalModeAnnotation: "manual"})
+	c := newTestController(t, service, testConnection(""))
+
+	conn, err := c.sync(t)
+	if err != nil {
+		t.Fatalf("syncConnection() = %v", err)
+	}
+
+	if conn.Status.ConnectionStatus != "Pending" {
+		t.Errorf("status connection = %q, want Pending", conn.Status.ConnectionStatus)
+	}
+	if ready := condition(conn, apl.ConditionReady); ready.Status != metav1.ConditionFalse {
+		t.Errorf("Ready condition = %+v, want False", ready)
+	}
+
+	approved := service.DeepCopy()
+	approved.Annotations[azure.ApprovalsAnnotation] = `{"db": {"approvedBy": "alice", "description": "ticket 42"}}`
+	c.observeService(t, approved)
+
+	conn, err = c.sync(t)
+	if err != nil {
+		t.Fatalf("syncConnection() = %v", err)
+	}
+
+	if conn.Status.ConnectionStatus != connectionApproved {
+		t.Errorf("status connection = %q, want %v", conn.Status.ConnectionStatus, connectionApproved)
+	}
+	if approval := condition(conn, apl.ConditionApproved); approval.Message != "The private link service connection is Approved: Approved by alice: ticket 42" {
+		t.Errorf("Approved condition message = %q", approval.Message)
+	}
+}
+
+func TestApprovalAnnotationsChanged(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		changed map[string]string
+		want    bool
+	}{
+		{name: "approval mode", changed: map[string]string{azure.ApprovalModeAnnotation: "auto"}, want: true},
+		{name: "approvals", changed: map[string]string{azure.ApprovalsAnnotation: `{"db": {"approvedBy": "alice"}}`}, want: true},
+		{name: "status written by the service controller", changed: map[string]string{"garvinmsft.github.com/apl-pls-condition": `{"type": "Ready"}`}},
+		{name: "unrelated annotation", changed: map[string]string{"team": "payments"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			old := testService(map[string]string{azure.ApprovalModeAnnotation: "manual"})
+			cur := old.DeepCopy()
+			for k, v := range test.changed {
+				cur.Annotations[k] = v
+			}
+
+			if got := approvalAnnotationsChanged(old, cur); got != test.want {
+				t.Fatalf("approvalAnnotationsChanged() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSyncConnectionCreatesEndpointInAnotherSubscription(t *testing.T) {
+
+	conn := testConnection("")
+	conn.Spec.SubscriptionID = "11111111-2222-3333-4444-555555555555"
+	c := newTestController(t, testService(nil), conn)
+	c.az.AddSubnetInSubscription(conn.Spec.SubscriptionID, testResourceGroup, "consumer-vnet", "endpoints", "10.1.0.0/24")
+
+	conn, err := c.sync(t)
+	if err != nil {
+		t.Fatalf("syncConnection() = %v", err)
+	}
+
+	want := "/subscriptions/11111111-2222-3333-4444-555555555555/resourceGroups/consumer-rg/providers/Microsoft.Network/privateEndpoints/db"
+
+	if conn.Status.PrivateEndpointID != want {
+		t.Errorf("status endpoint = %q, want %q", conn.Status.PrivateEndpointID, want)
+	}
+}
+
+func TestSyncConnectionWaitsForExternalPrivateLinkService(t *testing.T) {
+
+	target := "/subscriptions/partner/resourceGroups/partner-rg/providers/Microsoft.Network/privateLinkServices/orders"
+
+	conn := testConnection("")
+	conn.Spec.ServiceName = ""
+	conn.Spec.PrivateLinkServiceID = target
+	conn.Spec.RequestMessage = "aks web/db"
+	c := newTestController(t, testService(nil), conn)
+
+	conn, err := c.sync(t)
+	if err != nil {
+		t.Fatalf("syncConnection() = %v", err)
+	}
+
+	ep, ok := c.az.PrivateEndpoint(testResourceGroup, "db")
+	if !ok {
+		t.Fatal("private endpoint was not created")
+	}
+	if ep.PrivateLinkServiceConnections == nil || len(*ep.PrivateLinkServiceConnections) != 1 {
+		t.Fatalf("endpoint connections = %+v, want one connection that needs approval", ep.PrivateLinkServiceConnections)
+	}
+	if connection := (*ep.PrivateLinkServiceConnections)[0]; *connection.PrivateLinkServiceID != target || *connection.RequestMessage != "aks web/db" {
+		t.Errorf("endpoint connection = %v %q, want %v %q", *connection.PrivateLinkServiceID, *connection.RequestMessage, target, "aks web/db")
+	}
+	if ready := condition(conn, apl.ConditionReady); ready.Status != metav1.ConditionFalse {
+		t.Errorf("Ready condition = %+v, want False until the owner approves", ready)
+	}
+
+	if err := c.az.SetConnectionState(testResourceGroup, "db", connectionApproved); err != nil {
+		t.Fatal(err)
+	}
+
+	if conn, err = c.sync(t); err != nil {
+		t.Fatalf("syncConnection() = %v", err)
+	}
+
+	if ready := condition(conn, apl.ConditionReady); ready.Status != metav1.ConditionTrue {
+		t.Errorf("Ready condition = %+v, want True", ready)
+	}
+}
+
+func TestSyncConnectionUsesStaticIP(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		ipAddress string
+		reason    string
+	}{
+		{name: "free address", ipAddress: "10.1.0.10"},
+		{name: "reserved address", ipAddress: "10.1.0.1", reason: azure.InvalidPrivateIPAddress},
+		{name: "outside the subnet", ipAddress: "10.2.0.10", reason: azure.InvalidPrivateIPAddress},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn := testConnection("")
+			conn.Spec.IPAddress = test.ipAddress
+			c := newTestController(t, testService(nil), conn)
+
+			conn, err := c.sync(t)
+
+			if test.reason == "" {
+				if err != nil {
+					t.Fatalf("syncConnection() = %v", err)
+				}
+				if len(conn.Status.PrivateIPAddresses) != 1 || conn.Status.PrivateIPAddresses[0] != test.ipAddress {
+					t.Errorf("status addresses = %v, want [%v]", conn.Status.PrivateIPAddresses, test.ipAddress)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("syncConnection() = nil, want an error")
+			}
+			if ready := condition(conn, apl.ConditionReady); ready.Reason != test.reason {
+				t.Errorf("Ready condition = %+v, want reason %v", ready, test.reason)
+			}
+			if _, ok := c.az.PrivateEndpoint(testResourceGroup, "db"); ok {
+				t.Error("private endpoint was created with an invalid address")
+			}
+		})
+	}
+}
+
+func TestSyncConnectionMaintainsDNSRecord(t *testing.T) {
+
+	conn := testConnection("")
+	conn.Spec.DNS = &apl.DNSSpec{ZoneName: "privatelink.contoso.com", ResourceGroup: "dns"}
+	c := newTestController(t, testService(nil), conn)
+	c.az.AddPrivateDNSZone("dns", "privatelink.contoso.com")
+
+	conn, err := c.sync(t)
+	if err != nil {
+		t.Fatalf("syncConnection() = %v", err)
+	}
+
+	if conn.Status.DNSRecord != "frontend.privatelink.contoso.com" {
+		t.Errorf("status dns record = %q, want frontend.privatelink.contoso.com", conn.Status.DNSRecord)
+	}
+
+	record, ok := c.az.DNSRecord(conn.Status.DNSRecordID)
+	if !ok {
+		t.Fatalf("DNS record %v was not created", conn.Status.DNSRecordID)
+	}
+	if got := *(*record.ARecords)[0].Ipv4Address; len(conn.Status.PrivateIPAddresses) != 1 || got != conn.Status.PrivateIPAddresses[0] {
+		t.Errorf("DNS record points at %v, want the endpoint addresses %v", got, conn.Status.PrivateIPAddresses)
+	}
+
+	now := metav1.Now()
+	conn.DeletionTimestamp = &now
+
+	if _, err = c.aplClient.AplV1alpha1().ServiceConnections("web").Update(context.TODO(), conn, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = c.sync(t); err != nil {
+		t.Fatalf("syncConnection() = %v", err)
+	}
+
+	if _, ok := c.az.DNSRecord(*record.ID); ok {
+		t.Error("DNS record was not removed with the connection")
+	}
+}
+
+func TestSyncConnectionWaitsForLongRunningOperations(t *testing.T) {
+
+	c := newTestController(t, testService(nil), testConnection(""))
+	c.az.OperationPolls = 2
+
+	conn, err := c.sync(t)
+	if err != nil {
+		t.Fatalf("syncConnection() = %v", err)
+	}
+
+	if provisioned := condition(conn, apl.ConditionEndpointProvisioned); provisioned.Status != metav1.ConditionTrue {
+		t.Errorf("EndpointProvisioned condition = %+v, want True", provisioned)
+	}
+	if ready := condition(conn, apl.ConditionReady); ready.Status != metav1.ConditionTrue {
+		t.Errorf("Ready condition = %+v, want True", ready)
+	}
+}
+
+func TestSyncConnectionReportsFailedEndpoint(t *testing.T) {
+
+	c := newTestController(t, testService(nil), testConnection(""))
+
+	if _, err := c.sync(t); err != nil {
+		t.Fatalf("syncConnection() = %v", err)
+	}
+
+	if err := c.az.SetEndpointProvisioningState(testResourceGroup, "db", "Failed"); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := c.sync(t)
+	if err != nil {
+		t.Fatalf("syncConnection() = %v", err)
+	}
+
+	if provisioned := condition(conn, apl.ConditionEndpointProvisioned); provisioned.Status != metav1.ConditionFalse || provisioned.Reason != "Failed" {
+		t.Errorf("EndpointProvisioned condition = %+v, want False with reason Failed", provisioned)
+	}
+	if ready := condition(conn, apl.ConditionReady); ready.Status != metav1.ConditionFalse {
+		t.Errorf("Ready condition = %+v, want False", ready)
+	}
+}
+
+func TestSyncConnectionRecoversRejectedConnection(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		recoveryPolicy string
+		removed        bool
+		failed         bool
+	}{
+		{name: "leave", recoveryPolicy: apl.RecoveryPolicyLeave},
+		{name: "recreate", recoveryPolicy: apl.RecoveryPolicyRecreate, removed: true},
+		{name: "fail", recoveryPolicy: apl.RecoveryPolicyFail, failed: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newTestController(t, testService(nil), testConnection(test.recoveryPolicy))
+
+			if _, err := c.sync(t); err != nil {
+				t.Fatalf("syncConnection() = %v", err)
+			}
+
+			if err := c.az.SetConnectionState(testResourceGroup, "db", azure.ConnectionRejected); err != nil {
+				t.Fatal(err)
+			}
+
+			conn, _ := c.sync(t)
+
+			if _, ok := c.az.PrivateEndpoint(testResourceGroup, "db"); ok == test.removed {
+				t.Errorf("private endpoint exists = %v, want %v", ok, !test.removed)
+			}
+			if failed := isFailed(conn); failed != test.failed {
+				t.Errorf("failed = %v, want %v", failed, test.failed)
+			}
+			if conn.Status.ConnectionStatus != azure.ConnectionRejected {
+				t.Errorf("status connection = %q, want %v", conn.Status.ConnectionStatus, azure.ConnectionRejected)
+			}
+		})
+	}
+}
+
+func TestSyncConnectionRemovesEndpointOnDeletion(t *testing.T) {
+
+	c := newTestController(t, testService(nil), testConnection(""))
+
+	conn, err := c.sync(t)
+	if err != nil {
+		t.Fatalf("syncConnection() = %v", err)
+	}
+
+	now := metav1.Now()
+	conn.DeletionTimestamp = &now
+
+	if _, err = c.aplClient.AplV1alpha1().ServiceConnections("web").Update(context.TODO(), conn, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if conn, err = c.sync(t); err != nil {
+		t.Fatalf("syncConnection() = %v", err)
+	}
+
+	if _, ok := c.az.PrivateEndpoint(testResourceGroup, "db"); ok {
+		t.Error("private endpoint was not removed")
+	}
+	if hasFinalizer(conn) {
+		t.Error("finalizer was not removed")
+	}
+}
+
+func TestSyncConnectionRemovesEndpointWithoutService(t *testing.T) {
+
+	c := newTestController(t, testService(nil), testConnection(""))
+
+	if _, err := c.sync(t); err != nil {
+		t.Fatalf("syncConnection() = %v", err)
+	}
+
+	if err := c.kubeInformers.Core().V1().Services().Informer().GetIndexer().Delete(testService(nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := c.sync(t)
+	if err != nil {
+		t.Fatalf("syncConnection() = %v", err)
+	}
+
+	if _, ok := c.az.PrivateEndpoint(testResourceGroup, "db"); ok {
+		t.Error("private endpoint of a connection without service was not removed")
+	}
+	if hasFinalizer(conn) {
+		t.Error("finalizer was not removed")
+	}
+}
@@ -2,17 +2,33 @@ package connection
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	apl "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
+	"github.com/garvinmsft/auto-private-link/pkg/azure"
 	connClientset "github.com/garvinmsft/auto-private-link/pkg/generated/clientset/versioned"
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	
 )
 
 const (
 	connectionFinalizer =  "garvinmsft.github.com/apl-cleanup"
+	provisioningSucceeded = "Succeeded"
+	connectionApproved = "Approved"
 )
 
+//approvalAnnotationsChanged reports whether the annotations the connection controller reads from a service changed
+func approvalAnnotationsChanged(old *v1.Service, cur *v1.Service) bool {
+	for _, key := range []string{azure.ApprovalModeAnnotation, azure.ApprovalsAnnotation} {
+		if old.Annotations[key] != cur.Annotations[key] {
+			return true
+		}
+	}
+	return false
+}
+
 func needsCleanup(conn *apl.ServiceConnection) bool {
 	return conn.DeletionTimestamp != nil
 }
@@ -26,9 +42,9 @@ func hasFinalizer(conn *apl.ServiceConnection) bool {
 	return false
 }
 
-func (s *Controller) addFinalizer(client connClientset.Interface, conn *apl.ServiceConnection) error {
+func (s *Controller) addFinalizer(client connClientset.Interface, conn *apl.ServiceConnection) (*apl.ServiceConnection, error) {
 	if hasFinalizer(conn) {
-		return nil
+		return conn, nil
 	}
 
 	updated := conn.DeepCopy()
@@ -36,9 +52,7 @@ func (s *Controller) addFinalizer(client connClientset.Interface, conn *apl.Serv
 
 	//klog.V(2).Infof("Adding finalizer to service %s/%s", updated.Namespace, updated.Name)
 	
-	err := updateConnection(client, updated)
-
-	return err
+	return updateConnection(client, updated)
 }
 
 func removeFinalizer(client connClientset.Interface, conn *apl.ServiceConnection) error {
@@ -57,16 +71,114 @@ func removeFinalizer(client connClientset.Interface, conn *apl.ServiceConnection
 
 	updated.ObjectMeta.Finalizers = removed
 	
-	err := updateConnection(client, updated)
+	_, err := updateConnection(client, updated)
 
 	return err
 }
 
-func updateConnection(client connClientset.Interface, conn *apl.ServiceConnection) error {
+func updateConnection(client connClientset.Interface, conn *apl.ServiceConnection) (*apl.ServiceConnection, error) {
+
+	ctx := context.TODO()
+
+	return client.AplV1alpha1().ServiceConnections(conn.Namespace).Update(ctx, conn,  metav1.UpdateOptions{})
+}
+
+func updateConnectionStatus(client connClientset.Interface, conn *apl.ServiceConnection) error {
 
 	ctx := context.TODO()
 
-	_, err := 	client.AplV1alpha1().ServiceConnections(conn.Namespace).Update(ctx, conn,  metav1.UpdateOptions{})
+	_, err := client.AplV1alpha1().ServiceConnections(conn.Namespace).UpdateStatus(ctx, conn, metav1.UpdateOptions{})
 
 	return err
-}
\ No newline at end of file
+}
+
+//errorReason is the condition reason of a failed reconcile
+func errorReason(err error) string {
+	var connErr *azure.ConnectionError
+
+	if errors.As(err, &connErr) {
+		return connErr.Reason
+	}
+
+	return reconcileError
+}
+
+//newConnectionStatus builds the status of a connection from the observed endpoint and the result of the reconcile
+func newConnectionStatus(conn *apl.ServiceConnection, ep azure.PrivateEndpointStatus, reason string, err error) apl.ServiceConnectionStatus {
+
+	status := conn.Status.DeepCopy()
+	clearFailed(status)
+	status.PrivateEndpointID = ep.ID
+	status.PrivateIPAddresses = ep.IPAddresses
+	status.ConnectionStatus = ep.ConnectionStatus
+	status.ObservedGeneration = conn.Generation
+
+	//A failed reconcile does not know whether the record changed, so keep the last one written
+	if err == nil {
+		status.DNSRecord = ep.FQDN
+		status.DNSRecordID = ep.DNSRecordID
+	}
+
+	provisioned := apl.Condition{
+		Type: apl.ConditionEndpointProvisioned,
+		Status: metav1.ConditionFalse,
+		Reason: ep.ProvisioningState,
+	}
+
+	switch {
+	case ep.ID == "":
+		provisioned.Reason = "NotProvisioned"
+		provisioned.Message = "The private endpoint does not exist"
+	case ep.ProvisioningState == provisioningSucceeded:
+		provisioned.Status = metav1.ConditionTrue
+		provisioned.Reason = "Provisioned"
+		provisioned.Message = ep.ID
+	default:
+		provisioned.Message = fmt.Sprintf("The private endpoint is in provisioning state %v", ep.ProvisioningState)
+	}
+
+	approval := apl.Condition{
+		Type: apl.ConditionApproved,
+		Status: metav1.ConditionUnknown,
+		Reason: "Unknown",
+		Message: "The connection state is not known yet",
+	}
+
+	if ep.ConnectionStatus != "" {
+		approval.Status = metav1.ConditionFalse
+		approval.Reason = ep.ConnectionStatus
+		approval.Message = fmt.Sprintf("The private link service connection is %v", ep.ConnectionStatus)
+
+		if ep.ConnectionDescription != "" {
+			approval.Message = fmt.Sprintf("%v: %v", approval.Message, ep.ConnectionDescription)
+		}
+
+		if ep.ConnectionStatus == connectionApproved {
+			approval.Status = metav1.ConditionTrue
+		}
+	}
+
+	ready := apl.Condition{
+		Type: apl.ConditionReady,
+		Status: metav1.ConditionFalse,
+		Reason: "NotReady",
+		Message: "Waiting for the private endpoint to be provisioned and approved",
+	}
+
+	switch {
+	case err != nil:
+		ready.Reason = reason
+		ready.Message = err.Error()
+	case provisioned.Status == metav1.ConditionTrue && approval.Status == metav1.ConditionTrue:
+		ready.Status = metav1.ConditionTrue
+		ready.Reason = "Ready"
+		ready.Message = "The private endpoint is connected"
+	}
+
+	for _, condition := range []apl.Condition{provisioned, approval, ready} {
+		condition.ObservedGeneration = conn.Generation
+		apl.SetCondition(&status.Conditions, condition)
+	}
+
+	return *status
+}
@@ -0,0 +1,102 @@
+package connection
+
+import (
+	"fmt"
+
+	apl "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
+	"github.com/garvinmsft/auto-private-link/pkg/azure"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+const (
+	recreatingPrivateEndpoint = "RecreatingPrivateEndpoint"
+	connectionFailed = "ConnectionFailed"
+	connectionLeft = "ConnectionLeft"
+)
+
+//needsRecovery reports whether the endpoint connection was rejected or disconnected
+func needsRecovery(ep azure.PrivateEndpointStatus) bool {
+	return ep.ConnectionStatus == azure.ConnectionRejected || ep.ConnectionStatus == azure.ConnectionDisconnected
+}
+
+//recoveryPolicy is the recovery policy of a connection, defaulting to Leave
+func recoveryPolicy(conn *apl.ServiceConnection) string {
+	switch conn.Spec.RecoveryPolicy {
+	case apl.RecoveryPolicyRecreate, apl.RecoveryPolicyFail:
+		return conn.Spec.RecoveryPolicy
+	}
+	return apl.RecoveryPolicyLeave
+}
+
+//isFailed reports whether the Fail recovery policy stopped reconciling the current spec of a connection
+func isFailed(conn *apl.ServiceConnection) bool {
+	for _, condition := range conn.Status.Conditions {
+		if condition.Type == apl.ConditionFailed {
+			return condition.Status == metav1.ConditionTrue && condition.ObservedGeneration == conn.Generation
+		}
+	}
+	return false
+}
+
+//recoverConnection applies the recovery policy of a connection whose endpoint was rejected or disconnected
+func (s *Controller) recoverConnection(conn *apl.ServiceConnection, ep azure.PrivateEndpointStatus, err error) error {
+
+	switch recoveryPolicy(conn) {
+	case apl.RecoveryPolicyRecreate:
+		s.eventRecorder.Event(conn, v1.EventTypeWarning, recreatingPrivateEndpoint,
+			fmt.Sprintf("The connection is %v. Deleting the private endpoint so it is created and requested again", ep.ConnectionStatus))
+
+		if statusErr := s.updateStatus(conn, ep, ep.ConnectionStatus, err); statusErr != nil {
+			klog.Errorf("Could not update status of connection %v/%v: %v", conn.Namespace, conn.Name, statusErr)
+		}
+
+		if err := s.azContext.RemoveEndpoint(conn); err != nil {
+			return err
+		}
+
+		//Requeue with backoff so a target that keeps rejecting is not flooded with requests
+		return fmt.Errorf("Recreating the private endpoint of connection %v/%v after it was %v", conn.Namespace, conn.Name, ep.ConnectionStatus)
+
+	case apl.RecoveryPolicyFail:
+		s.eventRecorder.Event(conn, v1.EventTypeWarning, connectionFailed,
+			fmt.Sprintf("The connection is %v. Recovery policy Fail stops reconciling it until the spec changes", ep.ConnectionStatus))
+
+		status := newConnectionStatus(conn, ep, ep.ConnectionStatus, err)
+		apl.SetCondition(&status.Conditions, apl.Condition{
+			Type: apl.ConditionFailed,
+			Status: metav1.ConditionTrue,
+			Reason: ep.ConnectionStatus,
+			Message: err.Error(),
+			ObservedGeneration: conn.Generation,
+		})
+
+		updated := conn.DeepCopy()
+		updated.Status = status
+
+		return updateConnectionStatus(s.connClient, updated)
+
+	default:
+		if conn.Status.ConnectionStatus != ep.ConnectionStatus {
+			s.eventRecorder.Event(conn, v1.EventTypeWarning, connectionLeft,
+				fmt.Sprintf("The connection is %v. Recovery policy Leave keeps the private endpoint and reports its state", ep.ConnectionStatus))
+		}
+
+		//The state is observed again every sync period, so an owner approving later is picked up without retries
+		return s.updateStatus(conn, ep, ep.ConnectionStatus, err)
+	}
+}
+
+//clearFailed removes the Failed condition once a new spec is reconciled
+func clearFailed(status *apl.ServiceConnectionStatus) {
+	conditions := status.Conditions[:0]
+
+	for _, condition := range status.Conditions {
+		if condition.Type != apl.ConditionFailed {
+			conditions = append(conditions, condition)
+		}
+	}
+
+	status.Conditions = conditions
+}
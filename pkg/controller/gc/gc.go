@@ -0,0 +1,178 @@
+package gc
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+
+	apl "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
+	"github.com/garvinmsft/auto-private-link/pkg/azure"
+	"github.com/garvinmsft/auto-private-link/pkg/config"
+	"github.com/garvinmsft/auto-private-link/pkg/controller/service"
+	informers "github.com/garvinmsft/auto-private-link/pkg/generated/informers/externalversions/apl/v1alpha1"
+	listers "github.com/garvinmsft/auto-private-link/pkg/generated/listers/apl/v1alpha1"
+)
+
+const (
+	component = "auto-private-link-gc"
+)
+
+// Collector periodically deletes Azure resources tagged as created by this cluster
+// whose kubernetes service or service connection no longer exists or no longer asks for them
+type Collector struct {
+	cfg                    config.Config
+	azContext              azure.AzContext
+	serviceLister          corelisters.ServiceLister
+	serviceListerSynced    cache.InformerSynced
+	connectionLister       listers.ServiceConnectionLister
+	connectionListerSynced cache.InformerSynced
+}
+
+// New returns a new garbage collector for orphaned Azure resources
+func New(
+	svcInformer coreinformers.ServiceInformer,
+	aplInformer informers.ServiceConnectionInformer,
+	cfg config.Config,
+	azCtx azure.AzContext,
+) *Collector {
+	return &Collector{
+		cfg:                    cfg,
+		azContext:              azCtx,
+		serviceLister:          svcInformer.Lister(),
+		serviceListerSynced:    svcInformer.Informer().HasSynced,
+		connectionLister:       aplInformer.Lister(),
+		connectionListerSynced: aplInformer.Informer().HasSynced,
+	}
+}
+
+// Run starts collecting every GarbageCollectionPeriod. A period of 0 disables the collector.
+func (c *Collector) Run(stopCh <-chan struct{}) {
+
+	if c.cfg.GarbageCollectionPeriod <= 0 {
+		klog.Info("Garbage collection of orphaned Azure resources is disabled")
+		return
+	}
+
+	klog.Info("Starting garbage collector")
+
+	//An empty cache would make every resource look orphaned
+	if !cache.WaitForNamedCacheSync(component, stopCh, c.serviceListerSynced, c.connectionListerSynced) {
+		return
+	}
+
+	go wait.Until(c.collect, c.cfg.GarbageCollectionPeriod, stopCh)
+}
+
+func (c *Collector) collect() {
+
+	//A partial list is still collected; what could not be listed is collected on a later run
+	resources, err := c.azContext.ListOwnedResources()
+
+	if err != nil {
+		klog.Errorf("Garbage collection could not list all Azure resources: %v", err)
+	}
+
+	for _, resource := range resources {
+
+		orphaned, err := c.isOrphaned(resource)
+
+		if err != nil {
+			klog.Errorf("Garbage collection could not find the owner of %v: %v", resource.ID, err)
+			continue
+		}
+
+		if !orphaned {
+			continue
+		}
+
+		if c.cfg.GarbageCollectionDryRun {
+			klog.Infof("Garbage collection dry run: would delete %v owned by %v/%v", resource.ID, resource.Namespace, resource.OwnerName)
+			continue
+		}
+
+		klog.Infof("Garbage collection: deleting %v owned by %v/%v", resource.ID, resource.Namespace, resource.OwnerName)
+
+		if err := c.azContext.RemoveOwnedResource(resource); err != nil {
+			klog.Errorf("Garbage collection could not delete %v: %v", resource.ID, err)
+		}
+	}
+}
+
+//isOrphaned checks whether the kubernetes object named in the tags of a resource still exists and, for a service,
+//still asks for a private link service. An object recreated with the same name adopts the resources it would create
+//itself on its next sync, so those are not orphaned. Resources whose UID tag names an earlier object with the same
+//name and that the current object does not use, e.g. the endpoint of a connection recreated in another resource
+//group, are orphaned.
+func (c *Collector) isOrphaned(resource azure.OwnedResource) (bool, error) {
+
+	var err error
+
+	switch resource.Type {
+	case azure.PrivateLinkServiceResource:
+		var svc *v1.Service
+		svc, err = c.serviceLister.Services(resource.Namespace).Get(resource.OwnerName)
+
+		//Services being deleted are cleaned up by the service controller
+		if err == nil && svc.DeletionTimestamp == nil {
+			if !service.IsPrivateLinkService(svc, c.cfg.ServiceAnnotation) {
+				return true, nil
+			}
+
+			used := strings.EqualFold(resource.Name, azure.PrivateLinkServiceName(c.cfg, svc.Namespace, svc.Name))
+			return replaced(resource, svc) && !used, nil
+		}
+	case azure.PrivateEndpointResource:
+		var conn *apl.ServiceConnection
+		conn, err = c.connectionLister.ServiceConnections(resource.Namespace).Get(resource.OwnerName)
+
+		if err == nil {
+			subscriptionID := c.cfg.SubscriptionID
+			if conn.Spec.SubscriptionID != "" {
+				subscriptionID = conn.Spec.SubscriptionID
+			}
+
+			used := containsFold(azure.ManagedEndpointIDs(c.cfg, subscriptionID, conn), resource.ID)
+			return replaced(resource, conn) && !used, nil
+		}
+	case azure.PrivateDNSRecordResource:
+		var conn *apl.ServiceConnection
+		conn, err = c.connectionLister.ServiceConnections(resource.Namespace).Get(resource.OwnerName)
+
+		//The record of a connection is only known once its status names it
+		if err == nil {
+			used := conn.Status.DNSRecordID == "" || strings.EqualFold(conn.Status.DNSRecordID, resource.ID)
+			return replaced(resource, conn) && !used, nil
+		}
+	default:
+		return false, fmt.Errorf("unknown resource type %v", resource.Type)
+	}
+
+	if errors.IsNotFound(err) {
+		return true, nil
+	}
+
+	return false, err
+}
+
+//replaced reports whether the UID tag of a resource names an earlier object with the name of owner.
+//Resources tagged before the UID was recorded are never considered replaced
+func replaced(resource azure.OwnedResource, owner metav1.Object) bool {
+	return resource.OwnerUID != "" && resource.OwnerUID != string(owner.GetUID())
+}
+
+func containsFold(values []string, value string) bool {
+	for _, item := range values {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
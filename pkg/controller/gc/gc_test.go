@@ -0,0 +1,168 @@
+package gc
+
+import (
+	"net/http"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	apl "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
+	"github.com/garvinmsft/auto-private-link/pkg/azure"
+	"github.com/garvinmsft/auto-private-link/pkg/azure/fake"
+	"github.com/garvinmsft/auto-private-link/pkg/config"
+	listers "github.com/garvinmsft/auto-private-link/pkg/generated/listers/apl/v1alpha1"
+)
+
+const testAnnotation = "garvinmsft.github.com/apl"
+
+func testService(name string, annotations map[string]string, deleting bool) *v1.Service {
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: name, UID: types.UID("uid-" + name), Annotations: annotations},
+		Spec:       v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+	}
+	if deleting {
+		now := metav1.Now()
+		service.DeletionTimestamp = &now
+	}
+	return service
+}
+
+func TestIsOrphaned(t *testing.T) {
+
+	endpointID := "/subscriptions/sub/resourceGroups/endpoints/providers/Microsoft.Network/privateEndpoints/web-db"
+	movedEndpointID := "/subscriptions/sub/resourceGroups/old-endpoints/providers/Microsoft.Network/privateEndpoints/web-db"
+	recordID := "/subscriptions/sub/resourceGroups/dns/providers/Microsoft.Network/privateDnsZones/privatelink.contoso.com/A/db"
+	oldRecordID := "/subscriptions/sub/resourceGroups/dns/providers/Microsoft.Network/privateDnsZones/privatelink.fabrikam.com/A/db"
+
+	internal := map[string]string{testAnnotation: "true", "service.beta.kubernetes.io/azure-load-balancer-internal": "true"}
+	public := map[string]string{testAnnotation: "true"}
+	unannotated := map[string]string{"service.beta.kubernetes.io/azure-load-balancer-internal": "true"}
+
+	services := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, service := range []*v1.Service{
+		testService("internal", internal, false),
+		testService("public", public, false),
+		testService("unannotated", unannotated, false),
+		testService("deleting", unannotated, true),
+	} {
+		services.Add(service)
+	}
+
+	connections := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	connections.Add(&apl.ServiceConnection{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: "db", UID: "uid-db"},
+		Spec:       apl.ServiceConnectionSpec{ResourceGroup: "endpoints"},
+		Status:     apl.ServiceConnectionStatus{DNSRecordID: recordID},
+	})
+
+	collector := &Collector{
+		cfg: config.Config{
+			ServiceAnnotation:              testAnnotation,
+			SubscriptionID:                 "sub",
+			ClusterName:                    "aks",
+			PrivateLinkServiceNameTemplate: "{namespace}-{name}",
+			PrivateEndpointNameTemplate:    "{namespace}-{name}",
+		},
+		serviceLister:    corelisters.NewServiceLister(services),
+		connectionLister: listers.NewServiceConnectionLister(connections),
+	}
+
+	tests := []struct {
+		name         string
+		resourceType string
+		resourceName string
+		id           string
+		owner        string
+		uid          string
+		want         bool
+	}{
+		{name: "service asking for a private link service", resourceType: azure.PrivateLinkServiceResource, owner: "internal"},
+		{name: "service that is gone", resourceType: azure.PrivateLinkServiceResource, owner: "gone", want: true},
+		{name: "service made public", resourceType: azure.PrivateLinkServiceResource, owner: "public", want: true},
+		{name: "service that lost the annotation", resourceType: azure.PrivateLinkServiceResource, owner: "unannotated", want: true},
+		{name: "service being deleted", resourceType: azure.PrivateLinkServiceResource, owner: "deleting"},
+		{name: "service recreated with the same name", resourceType: azure.PrivateLinkServiceResource, resourceName: "web-internal", owner: "internal", uid: "uid-old"},
+		{name: "service recreated under another name template", resourceType: azure.PrivateLinkServiceResource, resourceName: "internal", owner: "internal", uid: "uid-old", want: true},
+		{name: "endpoint of a connection", resourceType: azure.PrivateEndpointResource, owner: "db"},
+		{name: "endpoint of a connection that is gone", resourceType: azure.PrivateEndpointResource, owner: "gone", want: true},
+		{name: "endpoint of a connection recreated with the same spec", resourceType: azure.PrivateEndpointResource, id: endpointID, owner: "db", uid: "uid-old"},
+		{name: "endpoint of a connection recreated in another resource group", resourceType: azure.PrivateEndpointResource, id: movedEndpointID, owner: "db", uid: "uid-old", want: true},
+		{name: "endpoint of the current connection in another resource group", resourceType: azure.PrivateEndpointResource, id: movedEndpointID, owner: "db", uid: "uid-db"},
+		{name: "dns record of a connection", resourceType: azure.PrivateDNSRecordResource, owner: "db"},
+		{name: "dns record of a connection that is gone", resourceType: azure.PrivateDNSRecordResource, owner: "gone", want: true},
+		{name: "dns record of a connection recreated with the same record", resourceType: azure.PrivateDNSRecordResource, id: recordID, owner: "db", uid: "uid-old"},
+		{name: "dns record of a connection recreated in another zone", resourceType: azure.PrivateDNSRecordResource, id: oldRecordID, owner: "db", uid: "uid-old", want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resource := azure.OwnedResource{
+				ID:        test.id,
+				Type:      test.resourceType,
+				Name:      test.resourceName,
+				Namespace: "web",
+				OwnerName: test.owner,
+				OwnerUID:  test.uid,
+			}
+
+			got, err := collector.isOrphaned(resource)
+
+			if err != nil || got != test.want {
+				t.Fatalf("isOrphaned() = %v, %v, want %v", got, err, test.want)
+			}
+		})
+	}
+
+	if _, err := collector.isOrphaned(azure.OwnedResource{Type: "Microsoft.Network/loadBalancers"}); err == nil {
+		t.Fatal("isOrphaned() of an unknown resource type = nil error, want an error")
+	}
+}
+
+func TestCollectContinuesWhenListingFails(t *testing.T) {
+
+	cfg := config.Config{
+		VnetResourceGroupName:           "vnet-rg",
+		VnetName:                        "vnet",
+		NatSubnetName:                   "nat",
+		LoadBalancerResourceGroup:       "mc_rg",
+		LoadBalancerName:                "kubernetes-internal",
+		ServiceAnnotation:               testAnnotation,
+		ClusterName:                     "aks",
+		PrivateLinkServiceNameTemplate:  "{namespace}-{name}",
+		PrivateEndpointNameTemplate:     "{namespace}-{name}",
+		NatSubnetWarningPercent:         80,
+		GarbageCollectionResourceGroups: []string{"mc_rg"},
+	}
+
+	az := fake.NewAzContext(cfg)
+	az.AddSubnet(cfg.VnetResourceGroupName, cfg.VnetName, cfg.NatSubnetName, "10.0.2.0/24")
+	az.AddFrontendIPConfiguration("10.0.0.4")
+
+	//The service of this private link service is gone
+	gone := testService("gone", map[string]string{testAnnotation: "true"}, false)
+	gone.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: "10.0.0.4"}}
+
+	if _, err := az.AddUpdatePrivateService(gone); err != nil {
+		t.Fatal(err)
+	}
+
+	az.SetError("list", "privateDnsZones", http.StatusNotFound)
+	az.SetError("list", "privateEndpoints", http.StatusForbidden)
+
+	collector := &Collector{
+		cfg:              cfg,
+		azContext:        az,
+		serviceLister:    corelisters.NewServiceLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})),
+		connectionLister: listers.NewServiceConnectionLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})),
+	}
+
+	collector.collect()
+
+	if _, ok := az.PrivateLinkService("web-gone"); ok {
+		t.Error("orphaned private link service was not deleted after the private endpoints could not be listed")
+	}
+}
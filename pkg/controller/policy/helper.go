@@ -0,0 +1,46 @@
+package policy
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apl "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
+	"github.com/garvinmsft/auto-private-link/pkg/azure"
+)
+
+//updateStatus writes the connection counts and the result of applying a policy
+func (s *Controller) updateStatus(policy *apl.PrivateLinkConnectionPolicy, counts azure.ConnectionPolicyStatus, reason string, err error) error {
+
+	updated := policy.DeepCopy()
+	now := metav1.Now()
+
+	//Counts are only known after a successful sync
+	if err == nil {
+		updated.Status.Approved = counts.Approved
+		updated.Status.Pending = counts.Pending
+		updated.Status.Rejected = counts.Rejected
+		updated.Status.LastSyncTime = &now
+	}
+
+	updated.Status.ObservedGeneration = policy.Generation
+
+	ready := apl.Condition{
+		Type:               apl.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Applied",
+		Message:            "The policy was applied to the connections of the private link service",
+		ObservedGeneration: policy.Generation,
+	}
+
+	if err != nil {
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = reason
+		ready.Message = err.Error()
+	}
+
+	apl.SetCondition(&updated.Status.Conditions, ready)
+
+	_, err = s.aplClient.AplV1alpha1().PrivateLinkConnectionPolicies(policy.Namespace).UpdateStatus(context.TODO(), updated, metav1.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,239 @@
+package policy
+
+import (
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog"
+
+	apl "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
+	"github.com/garvinmsft/auto-private-link/pkg/azure"
+	"github.com/garvinmsft/auto-private-link/pkg/config"
+	aplClientset "github.com/garvinmsft/auto-private-link/pkg/generated/clientset/versioned"
+	informers "github.com/garvinmsft/auto-private-link/pkg/generated/informers/externalversions/apl/v1alpha1"
+	listers "github.com/garvinmsft/auto-private-link/pkg/generated/listers/apl/v1alpha1"
+	"github.com/garvinmsft/auto-private-link/pkg/metrics"
+)
+
+const (
+	controllerTag      = "apl-policy"
+	noServiceForPolicy = "NoServiceForPolicy"
+	reconcileError     = "ReconcileError"
+	metricsController  = "policy"
+)
+
+//Controller applies PrivateLinkConnectionPolicies to the connections made to private link services from outside the cluster.
+//Azure does not notify about new connections, so every policy is checked again each PolicySyncPeriod.
+type Controller struct {
+	cfg                 config.Config
+	azContext           azure.AzContext
+	aplClient           aplClientset.Interface
+	policyLister        listers.PrivateLinkConnectionPolicyLister
+	policyListerSynced  cache.InformerSynced
+	connLister          listers.ServiceConnectionLister
+	connListerSynced    cache.InformerSynced
+	serviceLister       corelisters.ServiceLister
+	serviceListerSynced cache.InformerSynced
+	eventRecorder       record.EventRecorder
+	queue               workqueue.RateLimitingInterface
+}
+
+//New returns a new policy controller
+func New(
+	aplClient aplClientset.Interface,
+	policyInformer informers.PrivateLinkConnectionPolicyInformer,
+	connInformer informers.ServiceConnectionInformer,
+	svcInformer coreinformers.ServiceInformer,
+	cfg config.Config,
+	azCtx azure.AzContext,
+	recorder record.EventRecorder,
+) *Controller {
+
+	limiter := workqueue.NewItemExponentialFailureRateLimiter(cfg.MinRetryDelay, cfg.MaxRetryDelay)
+
+	s := &Controller{
+		cfg:                 cfg,
+		azContext:           azCtx,
+		aplClient:           aplClient,
+		policyLister:        policyInformer.Lister(),
+		policyListerSynced:  policyInformer.Informer().HasSynced,
+		connLister:          connInformer.Lister(),
+		connListerSynced:    connInformer.Informer().HasSynced,
+		serviceLister:       svcInformer.Lister(),
+		serviceListerSynced: svcInformer.Informer().HasSynced,
+		eventRecorder:       recorder,
+		queue:               workqueue.NewNamedRateLimitingQueue(limiter, controllerTag),
+	}
+
+	//The resync is what picks up new connections. Status writes are skipped so a sync does not trigger the next one
+	policyInformer.Informer().AddEventHandlerWithResyncPeriod(
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: func(cur interface{}) {
+				if policy, ok := cur.(*apl.PrivateLinkConnectionPolicy); ok {
+					s.enqueuePolicy(policy)
+				}
+			},
+			UpdateFunc: func(old, cur interface{}) {
+				oldPolicy, ok := old.(*apl.PrivateLinkConnectionPolicy)
+				policy, curOk := cur.(*apl.PrivateLinkConnectionPolicy)
+
+				if ok && curOk && (oldPolicy.ResourceVersion == policy.ResourceVersion || oldPolicy.Generation != policy.Generation) {
+					s.enqueuePolicy(policy)
+				}
+			},
+		},
+		cfg.PolicySyncPeriod,
+	)
+
+	return s
+}
+
+//Run starts the controller
+func (s *Controller) Run(stopCh <-chan struct{}, workers int) {
+
+	klog.Info("Starting connection policy controller")
+
+	//Connections of ServiceConnections must be known before any policy can reject them
+	if !cache.WaitForNamedCacheSync(controllerTag, stopCh, s.policyListerSynced, s.connListerSynced, s.serviceListerSynced) {
+		return
+	}
+
+	for i := 0; i < workers; i++ {
+		go wait.Until(s.policyWorker, time.Second, stopCh)
+	}
+}
+
+//HasSynced reports whether the policy, connection and service caches have synced
+func (s *Controller) HasSynced() bool {
+	return s.policyListerSynced() && s.connListerSynced() && s.serviceListerSynced()
+}
+
+//ShutDown does cleanup when controller is terminated
+func (s *Controller) ShutDown() {
+	klog.Info("Shutting down connection policy controller")
+	s.queue.ShutDown()
+}
+
+func (s *Controller) enqueuePolicy(policy *apl.PrivateLinkConnectionPolicy) {
+
+	key, err := cache.MetaNamespaceKeyFunc(policy)
+	if err != nil {
+		klog.Error(err.Error())
+		return
+	}
+	s.queue.Add(key)
+}
+
+func (s *Controller) policyWorker() {
+	for s.processNextPolicyItem() {
+	}
+}
+
+func (s *Controller) processNextPolicyItem() bool {
+	key, quit := s.queue.Get()
+	if quit {
+		return false
+	}
+	defer s.queue.Done(key)
+
+	start := time.Now()
+	err := s.syncPolicy(key.(string))
+	metrics.ObserveReconcile(metricsController, start, err)
+
+	if err == nil {
+		s.queue.Forget(key)
+		return true
+	}
+
+	klog.V(5).Infof("error policy %v (will retry): %v", key, err)
+	s.queue.AddRateLimited(key)
+	return true
+}
+
+func (s *Controller) syncPolicy(key string) error {
+
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		klog.V(5).Infof("invalid resource key: %s", key)
+		return nil
+	}
+
+	policy, err := s.policyLister.PrivateLinkConnectionPolicies(namespace).Get(name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			klog.V(5).Infof("policy '%s' in work queue no longer exists", key)
+			return nil
+		}
+		return err
+	}
+
+	//Deleting a policy leaves the connections as they are
+	if policy.DeletionTimestamp != nil {
+		return nil
+	}
+
+	service, err := s.serviceLister.Services(namespace).Get(policy.Spec.ServiceName)
+
+	if err != nil {
+		if errors.IsNotFound(err) {
+			msg := fmt.Sprintf("Tried to apply policy: %s but service: %s does not exist in namespace: %s", policy.Name, policy.Spec.ServiceName, namespace)
+			s.eventRecorder.Event(policy, v1.EventTypeWarning, noServiceForPolicy, msg)
+
+			//The policy is checked again at the next resync
+			return s.updateStatus(policy, azure.ConnectionPolicyStatus{}, noServiceForPolicy, fmt.Errorf(msg))
+		}
+		return err
+	}
+
+	if service.DeletionTimestamp != nil {
+		return nil
+	}
+
+	managed, err := s.managedEndpoints(policy)
+	if err != nil {
+		return err
+	}
+
+	klog.V(5).Infof("Applying connection policy: %v", key)
+
+	counts, err := s.azContext.ApplyConnectionPolicy(policy, managed)
+
+	if statusErr := s.updateStatus(policy, counts, reconcileError, err); statusErr != nil {
+		klog.Errorf("Could not update status of policy %v: %v", key, statusErr)
+
+		if err == nil {
+			return statusErr
+		}
+	}
+
+	return err
+}
+
+//managedEndpoints are the ServiceConnections to the policy's service, whose endpoints the connection controller approves.
+//They are taken from the spec, as the status only names the endpoint once it was created and recorded
+func (s *Controller) managedEndpoints(policy *apl.PrivateLinkConnectionPolicy) ([]*apl.ServiceConnection, error) {
+
+	conns, err := s.connLister.ServiceConnections(policy.Namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	var managed []*apl.ServiceConnection
+
+	for _, conn := range conns {
+		if conn.Spec.ServiceName == policy.Spec.ServiceName {
+			managed = append(managed, conn)
+		}
+	}
+
+	return managed, nil
+}
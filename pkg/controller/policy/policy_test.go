@@ -0,0 +1,277 @@
+package policy
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/to"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	apl "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
+	"github.com/garvinmsft/auto-private-link/pkg/azure"
+	"github.com/garvinmsft/auto-private-link/pkg/azure/fake"
+	"github.com/garvinmsft/auto-private-link/pkg/config"
+	aplfake "github.com/garvinmsft/auto-private-link/pkg/generated/clientset/versioned/fake"
+	aplinformers "github.com/garvinmsft/auto-private-link/pkg/generated/informers/externalversions"
+)
+
+const (
+	testServiceIP      = "10.0.0.4"
+	testResourceGroup  = "consumer-rg"
+	partnerEndpointID  = "/subscriptions/partner-sub/resourceGroups/partner-rg/providers/Microsoft.Network/privateEndpoints/orders"
+	strangerEndpointID = "/subscriptions/other-sub/resourceGroups/other-rg/providers/Microsoft.Network/privateEndpoints/scraper"
+)
+
+func testConfig() config.Config {
+	return config.Config{
+		VnetResourceGroupName:          "vnet-rg",
+		VnetName:                       "vnet",
+		NatSubnetName:                  "nat",
+		LoadBalancerResourceGroup:      "mc_rg",
+		LoadBalancerName:               "kubernetes-internal",
+		ServiceAnnotation:              "garvinmsft.github.com/apl",
+		ClusterName:                    "aks",
+		PrivateLinkServiceNameTemplate: "{name}",
+		PrivateEndpointNameTemplate:    "{name}",
+		NatSubnetWarningPercent:        80,
+		MinRetryDelay:                  time.Millisecond,
+		MaxRetryDelay:                  time.Second,
+	}
+}
+
+func testPolicy() *apl.PrivateLinkConnectionPolicy {
+	return &apl.PrivateLinkConnectionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: "partners", Generation: 1},
+		Spec: apl.PrivateLinkConnectionPolicySpec{
+			ServiceName:          "frontend",
+			AllowedSubscriptions: []string{"partner-sub"},
+			DeniedAction:         apl.DeniedActionReject,
+		},
+	}
+}
+
+//newTestController builds a policy controller against the fake ARM backend. Objects are put in the listers
+//as the informers would, without running them
+func newTestController(t *testing.T, az *fake.AzContext, policy *apl.PrivateLinkConnectionPolicy, objects ...interface{}) (*Controller, *aplfake.Clientset) {
+	t.Helper()
+
+	aplClient := aplfake.NewSimpleClientset(policy)
+	kubeClient := kubefake.NewSimpleClientset()
+	aplInformers := aplinformers.NewSharedInformerFactory(aplClient, 0)
+	kubeInformers := kubeinformers.NewSharedInformerFactory(kubeClient, 0)
+
+	c := New(aplClient, aplInformers.Apl().V1alpha1().PrivateLinkConnectionPolicies(), aplInformers.Apl().V1alpha1().ServiceConnections(),
+		kubeInformers.Core().V1().Services(), testConfig(), az, record.NewFakeRecorder(100))
+
+	indexers := map[string]func(interface{}) error{
+		"policy":     aplInformers.Apl().V1alpha1().PrivateLinkConnectionPolicies().Informer().GetIndexer().Add,
+		"connection": aplInformers.Apl().V1alpha1().ServiceConnections().Informer().GetIndexer().Add,
+		"service":    kubeInformers.Core().V1().Services().Informer().GetIndexer().Add,
+	}
+
+	add := func(kind string, obj interface{}) {
+		if err := indexers[kind](obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	add("policy", policy)
+	for _, obj := range objects {
+		switch obj.(type) {
+		case *v1.Service:
+			add("service", obj)
+		case *apl.ServiceConnection:
+			add("connection", obj)
+		}
+	}
+
+	return c, aplClient
+}
+
+func currentPolicy(t *testing.T, client *aplfake.Clientset) *apl.PrivateLinkConnectionPolicy {
+	t.Helper()
+
+	policy, err := client.AplV1alpha1().PrivateLinkConnectionPolicies("web").Get(context.TODO(), "partners", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+func readyCondition(policy *apl.PrivateLinkConnectionPolicy) apl.Condition {
+	for _, item := range policy.Status.Conditions {
+		if item.Type == apl.ConditionReady {
+			return item
+		}
+	}
+	return apl.Condition{}
+}
+
+func connectionStates(t *testing.T, az *fake.AzContext) map[string]string {
+	t.Helper()
+
+	pls, ok := az.PrivateLinkService("frontend")
+	if !ok {
+		t.Fatal("private link service does not exist")
+	}
+
+	states := map[string]string{}
+	for _, item := range *pls.PrivateEndpointConnections {
+		states[strings.ToLower(to.String(item.PrivateEndpoint.ID))] = to.String(item.PrivateLinkServiceConnectionState.Status)
+	}
+	return states
+}
+
+func TestSyncPolicyLeavesPendingServiceConnections(t *testing.T) {
+
+	cfg := testConfig()
+	az := fake.NewAzContext(cfg)
+	az.AddSubnet(cfg.VnetResourceGroupName, cfg.VnetName, cfg.NatSubnetName, "10.0.2.0/24")
+	az.AddSubnet(testResourceGroup, "consumer-vnet", "endpoints", "10.1.0.0/24")
+	az.AddFrontendIPConfiguration(testServiceIP)
+
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: "frontend", UID: "uid-frontend"},
+		Spec:       v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+		Status: v1.ServiceStatus{
+			LoadBalancer: v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: testServiceIP}}},
+		},
+	}
+
+	if _, err := az.AddUpdatePrivateService(service); err != nil {
+		t.Fatal(err)
+	}
+
+	//The endpoint of the ServiceConnection waits for approval and its status was never written
+	conn := &apl.ServiceConnection{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: "db", UID: "uid-db"},
+		Spec: apl.ServiceConnectionSpec{
+			ServiceName:   "frontend",
+			ResourceGroup: testResourceGroup,
+			VnetName:      "consumer-vnet",
+			SubnetName:    "endpoints",
+		},
+	}
+
+	ep, err := az.AddUpdatePrivateConnection(conn, "frontend", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{partnerEndpointID, strangerEndpointID} {
+		if err := az.AddExternalConnection("frontend", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, client := newTestController(t, az, testPolicy(), service, conn)
+
+	if err := c.syncPolicy("web/partners"); err != nil {
+		t.Fatalf("syncPolicy() = %v", err)
+	}
+
+	states := connectionStates(t, az)
+	want := map[string]string{
+		strings.ToLower(ep.ID):              "Pending",
+		strings.ToLower(partnerEndpointID):  "Approved",
+		strings.ToLower(strangerEndpointID): azure.ConnectionRejected,
+	}
+
+	for id, state := range want {
+		if states[id] != state {
+			t.Errorf("connection of %v is %q, want %q", id, states[id], state)
+		}
+	}
+
+	policy := currentPolicy(t, client)
+
+	if policy.Status.Approved != 1 || policy.Status.Pending != 0 || policy.Status.Rejected != 1 {
+		t.Errorf("status counts = %v approved, %v pending, %v rejected, want 1, 0, 1", policy.Status.Approved, policy.Status.Pending, policy.Status.Rejected)
+	}
+	if ready := readyCondition(policy); ready.Status != metav1.ConditionTrue || ready.ObservedGeneration != 1 {
+		t.Errorf("Ready condition = %+v, want True for generation 1", ready)
+	}
+}
+
+func TestSyncPolicyWithoutService(t *testing.T) {
+
+	az := fake.NewAzContext(testConfig())
+	c, client := newTestController(t, az, testPolicy())
+
+	if err := c.syncPolicy("web/partners"); err != nil {
+		t.Fatalf("syncPolicy() = %v", err)
+	}
+
+	if ready := readyCondition(currentPolicy(t, client)); ready.Status != metav1.ConditionFalse || ready.Reason != noServiceForPolicy {
+		t.Errorf("Ready condition = %+v, want False with reason %v", ready, noServiceForPolicy)
+	}
+
+	if actions := az.Actions(); len(actions) != 0 {
+		t.Errorf("policy without a service called ARM: %v", actions)
+	}
+}
+
+func TestSyncPolicyRejectLeavesAutoApprovedConnections(t *testing.T) {
+
+	cfg := testConfig()
+	az := fake.NewAzContext(cfg)
+	az.AddSubnet(cfg.VnetResourceGroupName, cfg.VnetName, cfg.NatSubnetName, "10.0.2.0/24")
+	az.AddFrontendIPConfiguration(testServiceIP)
+
+	//The private link service approves the endpoints of this subscription itself, the policy does not allow them
+	autoApproved := "11111111-2222-3333-4444-555555555555"
+	autoApprovedEndpointID := "/subscriptions/" + autoApproved + "/resourceGroups/shared-rg/providers/Microsoft.Network/privateEndpoints/reports"
+
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "web",
+			Name:        "frontend",
+			UID:         "uid-frontend",
+			Annotations: map[string]string{azure.AutoApprovalAnnotation: autoApproved},
+		},
+		Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+		Status: v1.ServiceStatus{
+			LoadBalancer: v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: testServiceIP}}},
+		},
+	}
+
+	if _, err := az.AddUpdatePrivateService(service); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{autoApprovedEndpointID, strangerEndpointID} {
+		if err := az.AddExternalConnection("frontend", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, client := newTestController(t, az, testPolicy(), service)
+
+	if err := c.syncPolicy("web/partners"); err != nil {
+		t.Fatalf("syncPolicy() = %v", err)
+	}
+
+	states := connectionStates(t, az)
+	want := map[string]string{
+		strings.ToLower(autoApprovedEndpointID): "Approved",
+		strings.ToLower(strangerEndpointID):     azure.ConnectionRejected,
+	}
+
+	for id, state := range want {
+		if states[id] != state {
+			t.Errorf("connection of %v is %q, want %q", id, states[id], state)
+		}
+	}
+
+	policy := currentPolicy(t, client)
+
+	if policy.Status.Approved != 1 || policy.Status.Rejected != 1 {
+		t.Errorf("status counts = %v approved, %v rejected, want 1, 1", policy.Status.Approved, policy.Status.Rejected)
+	}
+}
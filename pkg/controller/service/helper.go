@@ -2,41 +2,94 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clientset "k8s.io/client-go/kubernetes"
 
+	"github.com/garvinmsft/auto-private-link/pkg/azure"
 )
 
 const (
 	internalLoadBalancerKey = "service.beta.kubernetes.io/azure-load-balancer-internal"
-    serviceFinalizer = "garvinmsft.github.com/apl-cleanup"
+	serviceFinalizer        = "garvinmsft.github.com/apl-cleanup"
+
+	//PrivateLinkServiceIDAnnotation is written by the controller with the resource ID of the private link service
+	PrivateLinkServiceIDAnnotation = "garvinmsft.github.com/apl-pls-id"
+
+	//PrivateLinkServiceAliasAnnotation is written by the controller with the alias consumers use to connect
+	PrivateLinkServiceAliasAnnotation = "garvinmsft.github.com/apl-pls-alias"
+
+	//PrivateLinkServiceNatIPsAnnotation is written by the controller with the NAT ips backends see as the source of private link traffic
+	PrivateLinkServiceNatIPsAnnotation = "garvinmsft.github.com/apl-pls-nat-ips"
+
+	//PrivateLinkServiceConnectionsAnnotation is written by the controller with the endpoints connected to the private link service
+	PrivateLinkServiceConnectionsAnnotation = "garvinmsft.github.com/apl-pls-connections"
+
+	//PrivateLinkServiceConditionAnnotation is written by the controller with the Ready condition of the private link service, as services have no conditions of their own
+	PrivateLinkServiceConditionAnnotation = "garvinmsft.github.com/apl-pls-condition"
+
+	conditionReady = "Ready"
+	reconcileError = "ReconcileError"
+)
+
+var (
+	statusAnnotations = []string{
+		PrivateLinkServiceIDAnnotation,
+		PrivateLinkServiceAliasAnnotation,
+		PrivateLinkServiceNatIPsAnnotation,
+		PrivateLinkServiceConnectionsAnnotation,
+		PrivateLinkServiceConditionAnnotation,
+	}
 )
 
+//connectionAnnotation is the json form of a connection in the connections annotation
+type connectionAnnotation struct {
+	Name              string `json:"name"`
+	PrivateEndpointID string `json:"privateEndpointId"`
+	Status            string `json:"status"`
+}
+
+//conditionAnnotation is the json form of the condition annotation
+type conditionAnnotation struct {
+	Type    string             `json:"type"`
+	Status  v1.ConditionStatus `json:"status"`
+	Reason  string             `json:"reason"`
+	Message string             `json:"message,omitempty"`
+}
+
 func shouldProcess(service *v1.Service, annotation string) bool {
-	
+
 	isILB := isILBService(service)
 	hasIP := serviceHasIP(service)
 	isAPL := isAPLService(service, annotation)
-	
-	return  isILB && hasIP && isAPL
+
+	return isILB && hasIP && isAPL
+}
+
+//IsPrivateLinkService reports whether a service still asks for a private link service: an internal load balancer
+//carrying the configured annotation. Its private link service is removed once it no longer does
+func IsPrivateLinkService(service *v1.Service, annotation string) bool {
+	return isILBService(service) && isAPLService(service, annotation)
 }
 
 func serviceHasIP(service *v1.Service) bool {
 	return len(service.Status.LoadBalancer.Ingress) > 0
 }
 
-
-
 func isILBService(service *v1.Service) bool {
 	if val, ok := service.Annotations[internalLoadBalancerKey]; ok {
-		return val =="true" && service.Spec.Type == v1.ServiceTypeLoadBalancer
+		return val == "true" && service.Spec.Type == v1.ServiceTypeLoadBalancer
 	}
 	return false
 }
 
 func isAPLService(service *v1.Service, annotation string) bool {
-	if val, ok := service.Annotations[annotation]; ok && val!="" {
+	if val, ok := service.Annotations[annotation]; ok && val != "" {
 		return val == "true"
 	}
 	return false
@@ -51,8 +104,9 @@ func hasFinalizer(service *v1.Service) bool {
 	return false
 }
 
-func removeFinalizer(client clientset.Interface, service *v1.Service) error {
-	if !hasFinalizer(service) {
+//releaseService removes the finalizer and the status annotations written by the controller
+func releaseService(client clientset.Interface, service *v1.Service) error {
+	if !hasFinalizer(service) && !hasStatusAnnotations(service) {
 		return nil
 	}
 
@@ -66,29 +120,127 @@ func removeFinalizer(client clientset.Interface, service *v1.Service) error {
 	}
 
 	updated.ObjectMeta.Finalizers = removed
-	
-	err := updateService(client, updated)
+
+	for _, key := range statusAnnotations {
+		delete(updated.Annotations, key)
+	}
+
+	_, err := updateService(client, updated)
 
 	return err
 }
 
-func (s *Controller) addFinalizer(client clientset.Interface, service *v1.Service) error {
-	if hasFinalizer(service) {
-		return nil
+func hasStatusAnnotations(service *v1.Service) bool {
+	for _, key := range statusAnnotations {
+		if _, ok := service.Annotations[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+//updateStatusAnnotations records the state of the private link service on the kubernetes service
+func updateStatusAnnotations(client clientset.Interface, service *v1.Service, status azure.PrivateLinkServiceStatus) error {
+
+	connections := []connectionAnnotation{}
+	for _, item := range status.Connections {
+		connections = append(connections, connectionAnnotation{
+			Name:              item.Name,
+			PrivateEndpointID: item.PrivateEndpointID,
+			Status:            item.Status,
+		})
+	}
+
+	value, err := json.Marshal(connections)
+	if err != nil {
+		return err
+	}
+
+	condition, err := json.Marshal(conditionAnnotation{
+		Type:   conditionReady,
+		Status: v1.ConditionTrue,
+		Reason: conditionReady,
+	})
+	if err != nil {
+		return err
 	}
+
 	updated := service.DeepCopy()
-	updated.ObjectMeta.Finalizers = append(updated.ObjectMeta.Finalizers, serviceFinalizer)
+	if updated.Annotations == nil {
+		updated.Annotations = map[string]string{}
+	}
 
-	//klog.V(2).Infof("Adding finalizer to service %s/%s", updated.Namespace, updated.Name)
-	
-	err := updateService(client, updated)
+	updated.Annotations[PrivateLinkServiceIDAnnotation] = status.ID
+	updated.Annotations[PrivateLinkServiceAliasAnnotation] = status.Alias
+	updated.Annotations[PrivateLinkServiceNatIPsAnnotation] = strings.Join(status.NatIPs, ",")
+	updated.Annotations[PrivateLinkServiceConnectionsAnnotation] = string(value)
+	updated.Annotations[PrivateLinkServiceConditionAnnotation] = string(condition)
+
+	if reflect.DeepEqual(updated.Annotations, service.Annotations) {
+		return nil
+	}
+
+	_, err = updateService(client, updated)
 
 	return err
 }
 
-func updateService(client clientset.Interface, service *v1.Service) error {
+//errorReason is the condition reason of a failed reconcile
+func errorReason(err error) string {
+	var plsErr *azure.PrivateLinkServiceError
+
+	if errors.As(err, &plsErr) {
+		return plsErr.Reason
+	}
+
+	return reconcileError
+}
+
+//updateConditionAnnotation records why the private link service of the kubernetes service could not be reconciled
+func updateConditionAnnotation(client clientset.Interface, service *v1.Service, reconcileErr error) error {
 
-	_, err := client.CoreV1().Services(service.Namespace).Update(context.TODO(), service, metav1.UpdateOptions{})
+	ready := conditionAnnotation{
+		Type:    conditionReady,
+		Status:  v1.ConditionFalse,
+		Reason:  errorReason(reconcileErr),
+		Message: reconcileErr.Error(),
+	}
+
+	//Every update of the service queues it again, so only a new reason is written. ARM messages differ on each attempt
+	var current conditionAnnotation
+	if json.Unmarshal([]byte(service.Annotations[PrivateLinkServiceConditionAnnotation]), &current) == nil &&
+		current.Status == ready.Status && current.Reason == ready.Reason {
+		return nil
+	}
+
+	condition, err := json.Marshal(ready)
+	if err != nil {
+		return err
+	}
+
+	updated := service.DeepCopy()
+	if updated.Annotations == nil {
+		updated.Annotations = map[string]string{}
+	}
+
+	updated.Annotations[PrivateLinkServiceConditionAnnotation] = string(condition)
+
+	_, err = updateService(client, updated)
 
 	return err
-}
\ No newline at end of file
+}
+
+func (s *Controller) addFinalizer(client clientset.Interface, service *v1.Service) (*v1.Service, error) {
+	if hasFinalizer(service) {
+		return service, nil
+	}
+	updated := service.DeepCopy()
+	updated.ObjectMeta.Finalizers = append(updated.ObjectMeta.Finalizers, serviceFinalizer)
+
+	return updateService(client, updated)
+}
+
+func updateService(client clientset.Interface, service *v1.Service) (*v1.Service, error) {
+
+	return client.CoreV1().Services(service.Namespace).Update(context.TODO(), service, metav1.UpdateOptions{})
+}
@@ -3,7 +3,6 @@ package service
 
 import (
 
-	"fmt"
 	"time"
 
 	v1 "k8s.io/api/core/v1"
@@ -18,11 +17,13 @@ import (
 	"k8s.io/klog"
 	"github.com/garvinmsft/auto-private-link/pkg/config"
 	"github.com/garvinmsft/auto-private-link/pkg/azure"
+	"github.com/garvinmsft/auto-private-link/pkg/metrics"
 
 )
 
 const (
 	component = "auto-private-link-service"
+	metricsController = "service"
 )
 
 
@@ -101,6 +102,11 @@ func (s *Controller) Run(stopCh <-chan struct{}, workers int) {
 
 }
 
+//HasSynced reports whether the service cache has synced
+func (s *Controller) HasSynced() bool {
+	return s.serviceListerSynced()
+}
+
 //ShutDown does cleanup when controller is terminated 
 func (s *Controller) ShutDown() {
 	klog.Info("Shutting down service controller")
@@ -130,7 +136,10 @@ func (s *Controller) processNextServiceItem() bool {
 	}
 	defer s.queue.Done(key)
 
+	start := time.Now()
 	err := s.syncService(key.(string))
+	metrics.ObserveReconcile(metricsController, start, err)
+
 	if err == nil {
 		s.queue.Forget(key)
 		return true
@@ -154,6 +163,7 @@ func (s *Controller) syncService(key string) error {
 		
 		if errors.IsNotFound(err) {
 			klog.V(5).Infof("Service '%s' in work queue no longer exists", key)
+			metrics.ForgetPrivateLinkService(key)
 			return nil
 		}
 
@@ -170,23 +180,37 @@ func (s *Controller) syncService(key string) error {
 	}
 
 	 
-	ok := isAPLService(service, s.cfg.ServiceAnnotation)
+	ok := IsPrivateLinkService(service, s.cfg.ServiceAnnotation)
 
-	//Should never happen ;)
+	//The annotation was removed from a service the controller used to manage, or its load balancer is no longer internal
 	if !ok {
-		return fmt.Errorf("Is not an APL service")
+		klog.V(5).Infof("Service '%s' is no longer an apl service. Cleaning up", key)
+		return s.cleanupService(service)
 	}
 
 	klog.V(5).Infof("Syncing for apl service: %v", service.Name)
 	
 	//Check finalizers
-	err = s.addFinalizer(s.kubeClient, service)
+	service, err = s.addFinalizer(s.kubeClient, service)
 	if err!= nil {
 		return err
 	}
 	
-	return s.azContext.AddUpdatePrivateService(service)
+	status, err := s.azContext.AddUpdatePrivateService(service)
+
+	if err != nil {
+		metrics.SetPrivateLinkServiceState(key, metrics.ResultError)
+
+		if updateErr := updateConditionAnnotation(s.kubeClient, service, err); updateErr != nil {
+			klog.Warningf("Could not record the condition of service %v: %v", key, updateErr)
+		}
+
+		return err
+	}
 
+	metrics.SetPrivateLinkServiceState(key, status.ProvisioningState)
+
+	return updateStatusAnnotations(s.kubeClient, service, status)
 }
 
 
@@ -197,8 +221,12 @@ func (s *Controller) cleanupService(service *v1.Service ) error {
 	if err != nil {
 		return err
 	}
+
+	if key, err := cache.MetaNamespaceKeyFunc(service); err == nil {
+		metrics.ForgetPrivateLinkService(key)
+	}
 	
-	return removeFinalizer(s.kubeClient, service)
+	return releaseService(s.kubeClient, service)
 }
 
 
@@ -0,0 +1,380 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/garvinmsft/auto-private-link/pkg/azure"
+	"github.com/garvinmsft/auto-private-link/pkg/azure/fake"
+	"github.com/garvinmsft/auto-private-link/pkg/config"
+)
+
+const (
+	testAnnotation = "garvinmsft.github.com/apl"
+	testServiceIP  = "10.0.0.4"
+)
+
+func testConfig() config.Config {
+	return config.Config{
+		VnetResourceGroupName:          "vnet-rg",
+		VnetName:                       "vnet",
+		NatSubnetName:                  "nat",
+		LoadBalancerResourceGroup:      "mc_rg",
+		LoadBalancerName:               "kubernetes-internal",
+		ServiceAnnotation:              testAnnotation,
+		ClusterName:                    "aks",
+		PrivateLinkServiceNameTemplate: "{name}",
+		PrivateEndpointNameTemplate:    "{name}",
+		NatSubnetWarningPercent:        80,
+		MinRetryDelay:                  time.Millisecond,
+		MaxRetryDelay:                  time.Second,
+	}
+}
+
+func testService(annotations map[string]string) *v1.Service {
+	all := map[string]string{
+		testAnnotation:          "true",
+		internalLoadBalancerKey: "true",
+	}
+	for k, v := range annotations {
+		all[k] = v
+	}
+
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: "frontend", UID: "uid-frontend", Annotations: all},
+		Spec:       v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+		Status: v1.ServiceStatus{
+			LoadBalancer: v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: testServiceIP}}},
+		},
+	}
+}
+
+//testController is a service controller against the fake ARM backend. The service is put in the lister
+//as the informer would, without running it
+type testController struct {
+	*Controller
+	az         *fake.AzContext
+	kubeClient *kubefake.Clientset
+	informers  kubeinformers.SharedInformerFactory
+}
+
+func newTestController(t *testing.T, natPrefix string, service *v1.Service) *testController {
+	t.Helper()
+
+	cfg := testConfig()
+	az := fake.NewAzContext(cfg)
+	az.AddSubnet(cfg.VnetResourceGroupName, cfg.VnetName, cfg.NatSubnetName, natPrefix)
+	az.AddFrontendIPConfiguration(testServiceIP)
+
+	kubeClient := kubefake.NewSimpleClientset(service)
+	informers := kubeinformers.NewSharedInformerFactory(kubeClient, 0)
+
+	c := &testController{
+		Controller: New(kubeClient, informers.Core().V1().Services(), cfg, az),
+		az:         az,
+		kubeClient: kubeClient,
+		informers:  informers,
+	}
+	c.observe(t, service)
+
+	return c
+}
+
+//observe puts the service in the lister
+func (c *testController) observe(t *testing.T, service *v1.Service) {
+	t.Helper()
+
+	if err := c.informers.Core().V1().Services().Informer().GetIndexer().Update(service); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//current reads the service back from the api server
+func (c *testController) current(t *testing.T) *v1.Service {
+	t.Helper()
+
+	service, err := c.kubeClient.CoreV1().Services("web").Get(context.TODO(), "frontend", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
+
+func TestSyncServiceCreatesPrivateLinkService(t *testing.T) {
+
+	c := newTestController(t, "10.0.2.0/24", testService(nil))
+
+	if err := c.syncService("web/frontend"); err != nil {
+		t.Fatalf("syncService() = %v", err)
+	}
+
+	pls, ok := c.az.PrivateLinkService("frontend")
+	if !ok {
+		t.Fatal("private link service was not created")
+	}
+	if pls.ProvisioningState != "Succeeded" {
+		t.Errorf("provisioning state = %v, want Succeeded", pls.ProvisioningState)
+	}
+
+	service := c.current(t)
+
+	if !hasFinalizer(service) {
+		t.Error("service has no finalizer")
+	}
+	if got := service.Annotations[PrivateLinkServiceIDAnnotation]; got != *pls.ID {
+		t.Errorf("%v = %q, want %q", PrivateLinkServiceIDAnnotation, got, *pls.ID)
+	}
+	if got := service.Annotations[PrivateLinkServiceAliasAnnotation]; got != *pls.Alias {
+		t.Errorf("%v = %q, want %q", PrivateLinkServiceAliasAnnotation, got, *pls.Alias)
+	}
+}
+
+func TestSyncServiceAppliesVisibilityAndAutoApproval(t *testing.T) {
+
+	partner := "11111111-2222-3333-4444-555555555555"
+	c := newTestController(t, "10.0.2.0/24", testService(map[string]string{
+		azure.VisibilityAnnotation:   "*",
+		azure.AutoApprovalAnnotation: partner,
+	}))
+
+	if err := c.syncService("web/frontend"); err != nil {
+		t.Fatalf("syncService() = %v", err)
+	}
+
+	pls, _ := c.az.PrivateLinkService("frontend")
+
+	if got := *pls.Visibility.Subscriptions; !reflect.DeepEqual(got, []string{"*"}) {
+		t.Errorf("visibility = %v, want [*]", got)
+	}
+	if got := *pls.AutoApproval.Subscriptions; !reflect.DeepEqual(got, []string{partner}) {
+		t.Errorf("auto approval = %v, want [%v]", got, partner)
+	}
+
+	service := c.current(t)
+	service.Annotations[azure.AutoApprovalAnnotation] = "not-a-subscription"
+	c.observe(t, service)
+
+	if err := c.syncService("web/frontend"); err == nil {
+		t.Error("syncService() = nil, want an error for an invalid auto approval annotation")
+	}
+
+	delete(service.Annotations, azure.AutoApprovalAnnotation)
+	c.observe(t, service)
+
+	if err := c.syncService("web/frontend"); err != nil {
+		t.Fatalf("syncService() = %v", err)
+	}
+
+	if pls, _ = c.az.PrivateLinkService("frontend"); len(*pls.AutoApproval.Subscriptions) != 0 {
+		t.Errorf("auto approval = %v, want none", *pls.AutoApproval.Subscriptions)
+	}
+}
+
+func TestSyncServiceTogglesProxyProtocol(t *testing.T) {
+
+	c := newTestController(t, "10.0.2.0/24", testService(map[string]string{azure.ProxyProtocolAnnotation: "true"}))
+
+	if err := c.syncService("web/frontend"); err != nil {
+		t.Fatalf("syncService() = %v", err)
+	}
+
+	if pls, _ := c.az.PrivateLinkService("frontend"); !*pls.EnableProxyProtocol {
+		t.Error("proxy protocol was not enabled")
+	}
+
+	service := c.current(t)
+	service.Annotations[azure.ProxyProtocolAnnotation] = "false"
+	c.observe(t, service)
+
+	if err := c.syncService("web/frontend"); err != nil {
+		t.Fatalf("syncService() = %v", err)
+	}
+
+	if pls, _ := c.az.PrivateLinkService("frontend"); *pls.EnableProxyProtocol {
+		t.Error("proxy protocol was not disabled")
+	}
+}
+
+func TestSyncServiceWaitsForLongRunningOperations(t *testing.T) {
+
+	c := newTestController(t, "10.0.2.0/24", testService(nil))
+	c.az.OperationPolls = 2
+
+	if err := c.syncService("web/frontend"); err != nil {
+		t.Fatalf("syncService() = %v", err)
+	}
+
+	if pls, _ := c.az.PrivateLinkService("frontend"); pls.ProvisioningState != "Succeeded" {
+		t.Errorf("provisioning state = %v, want Succeeded", pls.ProvisioningState)
+	}
+
+	polls := 0
+	for _, action := range c.az.Actions() {
+		if action.Verb == "poll" {
+			polls++
+		}
+	}
+
+	if polls != c.az.OperationPolls+1 {
+		t.Errorf("operation was polled %v times, want %v", polls, c.az.OperationPolls+1)
+	}
+
+	if got := c.current(t).Annotations[PrivateLinkServiceAliasAnnotation]; got == "" {
+		t.Errorf("%v was not set after the operation completed", PrivateLinkServiceAliasAnnotation)
+	}
+}
+
+func TestSyncServiceRemovesPrivateLinkServiceOfServiceThatNoLongerQualifies(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		change func(service *v1.Service)
+	}{
+		{
+			name:   "annotation removed",
+			change: func(service *v1.Service) { delete(service.Annotations, testAnnotation) },
+		},
+		{
+			name:   "load balancer made public",
+			change: func(service *v1.Service) { delete(service.Annotations, internalLoadBalancerKey) },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newTestController(t, "10.0.2.0/24", testService(nil))
+
+			if err := c.syncService("web/frontend"); err != nil {
+				t.Fatalf("syncService() = %v", err)
+			}
+
+			service := c.current(t)
+			test.change(service)
+
+			if _, err := c.kubeClient.CoreV1().Services("web").Update(context.TODO(), service, metav1.UpdateOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			c.observe(t, service)
+
+			if err := c.syncService("web/frontend"); err != nil {
+				t.Fatalf("syncService() = %v", err)
+			}
+
+			if _, ok := c.az.PrivateLinkService("frontend"); ok {
+				t.Error("private link service was not removed")
+			}
+
+			service = c.current(t)
+
+			if hasFinalizer(service) || hasStatusAnnotations(service) {
+				t.Errorf("service was not released: finalizers %v, annotations %v", service.Finalizers, service.Annotations)
+			}
+		})
+	}
+}
+
+func TestSyncServiceLeavesPrivateLinkServiceOfAnotherNamespace(t *testing.T) {
+
+	c := newTestController(t, "10.0.2.0/24", testService(nil))
+
+	other := testService(nil)
+	other.Namespace = "api"
+	other.UID = "uid-api-frontend"
+
+	if _, err := c.az.AddUpdatePrivateService(other); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.syncService("web/frontend"); err == nil {
+		t.Fatal("syncService() = nil, want an ownership conflict")
+	}
+
+	service := c.current(t)
+	now := metav1.Now()
+	service.DeletionTimestamp = &now
+	c.observe(t, service)
+
+	if err := c.syncService("web/frontend"); err != nil {
+		t.Fatalf("syncService() = %v", err)
+	}
+
+	pls, ok := c.az.PrivateLinkService("frontend")
+	if !ok {
+		t.Fatal("private link service of another namespace was removed")
+	}
+	if namespace := *pls.Tags[azure.NamespaceTag]; namespace != "api" {
+		t.Errorf("private link service belongs to %v, want api", namespace)
+	}
+
+	conflicts := 0
+	for _, event := range c.az.Events() {
+		if strings.HasPrefix(event, "Warning ResourceOwnershipConflict ") {
+			conflicts++
+		}
+	}
+
+	if conflicts != 2 {
+		t.Errorf("events = %v, want an ownership conflict on update and on deletion", c.az.Events())
+	}
+}
+
+func TestSyncServiceRemovesPrivateLinkServiceOnDeletion(t *testing.T) {
+
+	c := newTestController(t, "10.0.2.0/24", testService(nil))
+
+	if err := c.syncService("web/frontend"); err != nil {
+		t.Fatalf("syncService() = %v", err)
+	}
+
+	service := c.current(t)
+	now := metav1.Now()
+	service.DeletionTimestamp = &now
+
+	if _, err := c.kubeClient.CoreV1().Services("web").Update(context.TODO(), service, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	c.observe(t, service)
+
+	if err := c.syncService("web/frontend"); err != nil {
+		t.Fatalf("syncService() = %v", err)
+	}
+
+	if _, ok := c.az.PrivateLinkService("frontend"); ok {
+		t.Error("private link service was not removed")
+	}
+	if hasFinalizer(c.current(t)) {
+		t.Error("finalizer was not removed")
+	}
+}
+
+func TestSyncServiceReportsFullNatSubnet(t *testing.T) {
+
+	//A /29 has 3 usable addresses
+	c := newTestController(t, "10.0.2.0/29", testService(map[string]string{azure.NatIPCountAnnotation: "4"}))
+
+	if err := c.syncService("web/frontend"); err == nil {
+		t.Fatal("syncService() = nil, want an error")
+	}
+
+	if _, ok := c.az.PrivateLinkService("frontend"); ok {
+		t.Error("private link service was created in a full NAT subnet")
+	}
+
+	var condition conditionAnnotation
+	if err := json.Unmarshal([]byte(c.current(t).Annotations[PrivateLinkServiceConditionAnnotation]), &condition); err != nil {
+		t.Fatalf("condition annotation: %v", err)
+	}
+
+	if condition.Status != v1.ConditionFalse || condition.Reason != azure.NatSubnetFull {
+		t.Errorf("condition = %+v, want status False and reason %v", condition, azure.NatSubnetFull)
+	}
+}
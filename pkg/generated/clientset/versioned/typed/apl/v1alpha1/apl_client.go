@@ -10,6 +10,7 @@ import (
 
 type AplV1alpha1Interface interface {
 	RESTClient() rest.Interface
+	PrivateLinkConnectionPoliciesGetter
 	ServiceConnectionsGetter
 }
 
@@ -18,6 +19,10 @@ type AplV1alpha1Client struct {
 	restClient rest.Interface
 }
 
+func (c *AplV1alpha1Client) PrivateLinkConnectionPolicies(namespace string) PrivateLinkConnectionPolicyInterface {
+	return newPrivateLinkConnectionPolicies(c, namespace)
+}
+
 func (c *AplV1alpha1Client) ServiceConnections(namespace string) ServiceConnectionInterface {
 	return newServiceConnections(c, namespace)
 }
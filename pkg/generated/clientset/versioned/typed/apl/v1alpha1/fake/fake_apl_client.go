@@ -12,6 +12,10 @@ type FakeAplV1alpha1 struct {
 	*testing.Fake
 }
 
+func (c *FakeAplV1alpha1) PrivateLinkConnectionPolicies(namespace string) v1alpha1.PrivateLinkConnectionPolicyInterface {
+	return &FakePrivateLinkConnectionPolicies{c, namespace}
+}
+
 func (c *FakeAplV1alpha1) ServiceConnections(namespace string) v1alpha1.ServiceConnectionInterface {
 	return &FakeServiceConnections{c, namespace}
 }
@@ -0,0 +1,126 @@
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	"context"
+
+	v1alpha1 "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakePrivateLinkConnectionPolicies implements PrivateLinkConnectionPolicyInterface
+type FakePrivateLinkConnectionPolicies struct {
+	Fake *FakeAplV1alpha1
+	ns   string
+}
+
+var privatelinkconnectionpoliciesResource = schema.GroupVersionResource{Group: "apl.garvinmsft.github.com", Version: "v1alpha1", Resource: "privatelinkconnectionpolicies"}
+
+var privatelinkconnectionpoliciesKind = schema.GroupVersionKind{Group: "apl.garvinmsft.github.com", Version: "v1alpha1", Kind: "PrivateLinkConnectionPolicy"}
+
+// Get takes name of the privateLinkConnectionPolicy, and returns the corresponding privateLinkConnectionPolicy object, and an error if there is any.
+func (c *FakePrivateLinkConnectionPolicies) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1alpha1.PrivateLinkConnectionPolicy, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(privatelinkconnectionpoliciesResource, c.ns, name), &v1alpha1.PrivateLinkConnectionPolicy{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.PrivateLinkConnectionPolicy), err
+}
+
+// List takes label and field selectors, and returns the list of PrivateLinkConnectionPolicies that match those selectors.
+func (c *FakePrivateLinkConnectionPolicies) List(ctx context.Context, opts v1.ListOptions) (result *v1alpha1.PrivateLinkConnectionPolicyList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewListAction(privatelinkconnectionpoliciesResource, privatelinkconnectionpoliciesKind, c.ns, opts), &v1alpha1.PrivateLinkConnectionPolicyList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1alpha1.PrivateLinkConnectionPolicyList{ListMeta: obj.(*v1alpha1.PrivateLinkConnectionPolicyList).ListMeta}
+	for _, item := range obj.(*v1alpha1.PrivateLinkConnectionPolicyList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested privateLinkConnectionPolicies.
+func (c *FakePrivateLinkConnectionPolicies) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewWatchAction(privatelinkconnectionpoliciesResource, c.ns, opts))
+
+}
+
+// Create takes the representation of a privateLinkConnectionPolicy and creates it.  Returns the server's representation of the privateLinkConnectionPolicy, and an error, if there is any.
+func (c *FakePrivateLinkConnectionPolicies) Create(ctx context.Context, privateLinkConnectionPolicy *v1alpha1.PrivateLinkConnectionPolicy, opts v1.CreateOptions) (result *v1alpha1.PrivateLinkConnectionPolicy, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewCreateAction(privatelinkconnectionpoliciesResource, c.ns, privateLinkConnectionPolicy), &v1alpha1.PrivateLinkConnectionPolicy{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.PrivateLinkConnectionPolicy), err
+}
+
+// Update takes the representation of a privateLinkConnectionPolicy and updates it. Returns the server's representation of the privateLinkConnectionPolicy, and an error, if there is any.
+func (c *FakePrivateLinkConnectionPolicies) Update(ctx context.Context, privateLinkConnectionPolicy *v1alpha1.PrivateLinkConnectionPolicy, opts v1.UpdateOptions) (result *v1alpha1.PrivateLinkConnectionPolicy, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateAction(privatelinkconnectionpoliciesResource, c.ns, privateLinkConnectionPolicy), &v1alpha1.PrivateLinkConnectionPolicy{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.PrivateLinkConnectionPolicy), err
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakePrivateLinkConnectionPolicies) UpdateStatus(ctx context.Context, privateLinkConnectionPolicy *v1alpha1.PrivateLinkConnectionPolicy, opts v1.UpdateOptions) (*v1alpha1.PrivateLinkConnectionPolicy, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateSubresourceAction(privatelinkconnectionpoliciesResource, "status", c.ns, privateLinkConnectionPolicy), &v1alpha1.PrivateLinkConnectionPolicy{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.PrivateLinkConnectionPolicy), err
+}
+
+// Delete takes name of the privateLinkConnectionPolicy and deletes it. Returns an error if one occurs.
+func (c *FakePrivateLinkConnectionPolicies) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteAction(privatelinkconnectionpoliciesResource, c.ns, name), &v1alpha1.PrivateLinkConnectionPolicy{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakePrivateLinkConnectionPolicies) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(privatelinkconnectionpoliciesResource, c.ns, listOpts)
+
+	_, err := c.Fake.Invokes(action, &v1alpha1.PrivateLinkConnectionPolicyList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched privateLinkConnectionPolicy.
+func (c *FakePrivateLinkConnectionPolicies) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.PrivateLinkConnectionPolicy, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(privatelinkconnectionpoliciesResource, c.ns, name, pt, data, subresources...), &v1alpha1.PrivateLinkConnectionPolicy{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.PrivateLinkConnectionPolicy), err
+}
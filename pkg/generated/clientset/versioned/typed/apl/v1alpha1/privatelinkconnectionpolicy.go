@@ -0,0 +1,179 @@
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	"context"
+	"time"
+
+	v1alpha1 "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
+	scheme "github.com/garvinmsft/auto-private-link/pkg/generated/clientset/versioned/scheme"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// PrivateLinkConnectionPoliciesGetter has a method to return a PrivateLinkConnectionPolicyInterface.
+// A group's client should implement this interface.
+type PrivateLinkConnectionPoliciesGetter interface {
+	PrivateLinkConnectionPolicies(namespace string) PrivateLinkConnectionPolicyInterface
+}
+
+// PrivateLinkConnectionPolicyInterface has methods to work with PrivateLinkConnectionPolicy resources.
+type PrivateLinkConnectionPolicyInterface interface {
+	Create(ctx context.Context, privateLinkConnectionPolicy *v1alpha1.PrivateLinkConnectionPolicy, opts v1.CreateOptions) (*v1alpha1.PrivateLinkConnectionPolicy, error)
+	Update(ctx context.Context, privateLinkConnectionPolicy *v1alpha1.PrivateLinkConnectionPolicy, opts v1.UpdateOptions) (*v1alpha1.PrivateLinkConnectionPolicy, error)
+	UpdateStatus(ctx context.Context, privateLinkConnectionPolicy *v1alpha1.PrivateLinkConnectionPolicy, opts v1.UpdateOptions) (*v1alpha1.PrivateLinkConnectionPolicy, error)
+	Delete(ctx context.Context, name string, opts v1.DeleteOptions) error
+	DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error
+	Get(ctx context.Context, name string, opts v1.GetOptions) (*v1alpha1.PrivateLinkConnectionPolicy, error)
+	List(ctx context.Context, opts v1.ListOptions) (*v1alpha1.PrivateLinkConnectionPolicyList, error)
+	Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.PrivateLinkConnectionPolicy, err error)
+	PrivateLinkConnectionPolicyExpansion
+}
+
+// privateLinkConnectionPolicies implements PrivateLinkConnectionPolicyInterface
+type privateLinkConnectionPolicies struct {
+	client rest.Interface
+	ns     string
+}
+
+// newPrivateLinkConnectionPolicies returns a PrivateLinkConnectionPolicies
+func newPrivateLinkConnectionPolicies(c *AplV1alpha1Client, namespace string) *privateLinkConnectionPolicies {
+	return &privateLinkConnectionPolicies{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Get takes name of the privateLinkConnectionPolicy, and returns the corresponding privateLinkConnectionPolicy object, and an error if there is any.
+func (c *privateLinkConnectionPolicies) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1alpha1.PrivateLinkConnectionPolicy, err error) {
+	result = &v1alpha1.PrivateLinkConnectionPolicy{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("privatelinkconnectionpolicies").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of PrivateLinkConnectionPolicies that match those selectors.
+func (c *privateLinkConnectionPolicies) List(ctx context.Context, opts v1.ListOptions) (result *v1alpha1.PrivateLinkConnectionPolicyList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result = &v1alpha1.PrivateLinkConnectionPolicyList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("privatelinkconnectionpolicies").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested privateLinkConnectionPolicies.
+func (c *privateLinkConnectionPolicies) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("privatelinkconnectionpolicies").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Watch(ctx)
+}
+
+// Create takes the representation of a privateLinkConnectionPolicy and creates it.  Returns the server's representation of the privateLinkConnectionPolicy, and an error, if there is any.
+func (c *privateLinkConnectionPolicies) Create(ctx context.Context, privateLinkConnectionPolicy *v1alpha1.PrivateLinkConnectionPolicy, opts v1.CreateOptions) (result *v1alpha1.PrivateLinkConnectionPolicy, err error) {
+	result = &v1alpha1.PrivateLinkConnectionPolicy{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("privatelinkconnectionpolicies").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(privateLinkConnectionPolicy).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Update takes the representation of a privateLinkConnectionPolicy and updates it. Returns the server's representation of the privateLinkConnectionPolicy, and an error, if there is any.
+func (c *privateLinkConnectionPolicies) Update(ctx context.Context, privateLinkConnectionPolicy *v1alpha1.PrivateLinkConnectionPolicy, opts v1.UpdateOptions) (result *v1alpha1.PrivateLinkConnectionPolicy, err error) {
+	result = &v1alpha1.PrivateLinkConnectionPolicy{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("privatelinkconnectionpolicies").
+		Name(privateLinkConnectionPolicy.Name).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(privateLinkConnectionPolicy).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *privateLinkConnectionPolicies) UpdateStatus(ctx context.Context, privateLinkConnectionPolicy *v1alpha1.PrivateLinkConnectionPolicy, opts v1.UpdateOptions) (result *v1alpha1.PrivateLinkConnectionPolicy, err error) {
+	result = &v1alpha1.PrivateLinkConnectionPolicy{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("privatelinkconnectionpolicies").
+		Name(privateLinkConnectionPolicy.Name).
+		SubResource("status").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(privateLinkConnectionPolicy).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Delete takes name of the privateLinkConnectionPolicy and deletes it. Returns an error if one occurs.
+func (c *privateLinkConnectionPolicies) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("privatelinkconnectionpolicies").
+		Name(name).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *privateLinkConnectionPolicies) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	var timeout time.Duration
+	if listOpts.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOpts.TimeoutSeconds) * time.Second
+	}
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("privatelinkconnectionpolicies").
+		VersionedParams(&listOpts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// Patch applies the patch and returns the patched privateLinkConnectionPolicy.
+func (c *privateLinkConnectionPolicies) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.PrivateLinkConnectionPolicy, err error) {
+	result = &v1alpha1.PrivateLinkConnectionPolicy{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("privatelinkconnectionpolicies").
+		Name(name).
+		SubResource(subresources...).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(data).
+		Do(ctx).
+		Into(result)
+	return
+}
@@ -8,6 +8,8 @@ import (
 
 // Interface provides access to all the informers in this group version.
 type Interface interface {
+	// PrivateLinkConnectionPolicies returns a PrivateLinkConnectionPolicyInformer.
+	PrivateLinkConnectionPolicies() PrivateLinkConnectionPolicyInformer
 	// ServiceConnections returns a ServiceConnectionInformer.
 	ServiceConnections() ServiceConnectionInformer
 }
@@ -23,6 +25,11 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 	return &version{factory: f, namespace: namespace, tweakListOptions: tweakListOptions}
 }
 
+// PrivateLinkConnectionPolicies returns a PrivateLinkConnectionPolicyInformer.
+func (v *version) PrivateLinkConnectionPolicies() PrivateLinkConnectionPolicyInformer {
+	return &privateLinkConnectionPolicyInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
 // ServiceConnections returns a ServiceConnectionInformer.
 func (v *version) ServiceConnections() ServiceConnectionInformer {
 	return &serviceConnectionInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
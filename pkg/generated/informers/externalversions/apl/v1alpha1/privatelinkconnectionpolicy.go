@@ -0,0 +1,74 @@
+// Code generated by informer-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	"context"
+	time "time"
+
+	aplv1alpha1 "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
+	versioned "github.com/garvinmsft/auto-private-link/pkg/generated/clientset/versioned"
+	internalinterfaces "github.com/garvinmsft/auto-private-link/pkg/generated/informers/externalversions/internalinterfaces"
+	v1alpha1 "github.com/garvinmsft/auto-private-link/pkg/generated/listers/apl/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	watch "k8s.io/apimachinery/pkg/watch"
+	cache "k8s.io/client-go/tools/cache"
+)
+
+// PrivateLinkConnectionPolicyInformer provides access to a shared informer and lister for
+// PrivateLinkConnectionPolicies.
+type PrivateLinkConnectionPolicyInformer interface {
+	Informer() cache.SharedIndexInformer
+	Lister() v1alpha1.PrivateLinkConnectionPolicyLister
+}
+
+type privateLinkConnectionPolicyInformer struct {
+	factory          internalinterfaces.SharedInformerFactory
+	tweakListOptions internalinterfaces.TweakListOptionsFunc
+	namespace        string
+}
+
+// NewPrivateLinkConnectionPolicyInformer constructs a new informer for PrivateLinkConnectionPolicy type.
+// Always prefer using an informer factory to get a shared informer instead of getting an independent
+// one. This reduces memory footprint and number of connections to the server.
+func NewPrivateLinkConnectionPolicyInformer(client versioned.Interface, namespace string, resyncPeriod time.Duration, indexers cache.Indexers) cache.SharedIndexInformer {
+	return NewFilteredPrivateLinkConnectionPolicyInformer(client, namespace, resyncPeriod, indexers, nil)
+}
+
+// NewFilteredPrivateLinkConnectionPolicyInformer constructs a new informer for PrivateLinkConnectionPolicy type.
+// Always prefer using an informer factory to get a shared informer instead of getting an independent
+// one. This reduces memory footprint and number of connections to the server.
+func NewFilteredPrivateLinkConnectionPolicyInformer(client versioned.Interface, namespace string, resyncPeriod time.Duration, indexers cache.Indexers, tweakListOptions internalinterfaces.TweakListOptionsFunc) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options v1.ListOptions) (runtime.Object, error) {
+				if tweakListOptions != nil {
+					tweakListOptions(&options)
+				}
+				return client.AplV1alpha1().PrivateLinkConnectionPolicies(namespace).List(context.TODO(), options)
+			},
+			WatchFunc: func(options v1.ListOptions) (watch.Interface, error) {
+				if tweakListOptions != nil {
+					tweakListOptions(&options)
+				}
+				return client.AplV1alpha1().PrivateLinkConnectionPolicies(namespace).Watch(context.TODO(), options)
+			},
+		},
+		&aplv1alpha1.PrivateLinkConnectionPolicy{},
+		resyncPeriod,
+		indexers,
+	)
+}
+
+func (f *privateLinkConnectionPolicyInformer) defaultInformer(client versioned.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	return NewFilteredPrivateLinkConnectionPolicyInformer(client, f.namespace, resyncPeriod, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, f.tweakListOptions)
+}
+
+func (f *privateLinkConnectionPolicyInformer) Informer() cache.SharedIndexInformer {
+	return f.factory.InformerFor(&aplv1alpha1.PrivateLinkConnectionPolicy{}, f.defaultInformer)
+}
+
+func (f *privateLinkConnectionPolicyInformer) Lister() v1alpha1.PrivateLinkConnectionPolicyLister {
+	return v1alpha1.NewPrivateLinkConnectionPolicyLister(f.Informer().GetIndexer())
+}
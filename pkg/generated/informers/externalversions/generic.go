@@ -37,6 +37,8 @@ func (f *genericInformer) Lister() cache.GenericLister {
 func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource) (GenericInformer, error) {
 	switch resource {
 	// Group=apl.garvinmsft.github.com, Version=v1alpha1
+	case v1alpha1.SchemeGroupVersion.WithResource("privatelinkconnectionpolicies"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Apl().V1alpha1().PrivateLinkConnectionPolicies().Informer()}, nil
 	case v1alpha1.SchemeGroupVersion.WithResource("serviceconnections"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Apl().V1alpha1().ServiceConnections().Informer()}, nil
 
@@ -2,6 +2,14 @@
 
 package v1alpha1
 
+// PrivateLinkConnectionPolicyListerExpansion allows custom methods to be added to
+// PrivateLinkConnectionPolicyLister.
+type PrivateLinkConnectionPolicyListerExpansion interface{}
+
+// PrivateLinkConnectionPolicyNamespaceListerExpansion allows custom methods to be added to
+// PrivateLinkConnectionPolicyNamespaceLister.
+type PrivateLinkConnectionPolicyNamespaceListerExpansion interface{}
+
 // ServiceConnectionListerExpansion allows custom methods to be added to
 // ServiceConnectionLister.
 type ServiceConnectionListerExpansion interface{}
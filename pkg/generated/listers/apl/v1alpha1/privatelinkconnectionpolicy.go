@@ -0,0 +1,83 @@
+// Code generated by lister-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	v1alpha1 "github.com/garvinmsft/auto-private-link/pkg/apis/apl/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// PrivateLinkConnectionPolicyLister helps list PrivateLinkConnectionPolicies.
+// All objects returned here must be treated as read-only.
+type PrivateLinkConnectionPolicyLister interface {
+	// List lists all PrivateLinkConnectionPolicies in the indexer.
+	// Objects returned here must be treated as read-only.
+	List(selector labels.Selector) (ret []*v1alpha1.PrivateLinkConnectionPolicy, err error)
+	// PrivateLinkConnectionPolicies returns an object that can list and get PrivateLinkConnectionPolicies.
+	PrivateLinkConnectionPolicies(namespace string) PrivateLinkConnectionPolicyNamespaceLister
+	PrivateLinkConnectionPolicyListerExpansion
+}
+
+// privateLinkConnectionPolicyLister implements the PrivateLinkConnectionPolicyLister interface.
+type privateLinkConnectionPolicyLister struct {
+	indexer cache.Indexer
+}
+
+// NewPrivateLinkConnectionPolicyLister returns a new PrivateLinkConnectionPolicyLister.
+func NewPrivateLinkConnectionPolicyLister(indexer cache.Indexer) PrivateLinkConnectionPolicyLister {
+	return &privateLinkConnectionPolicyLister{indexer: indexer}
+}
+
+// List lists all PrivateLinkConnectionPolicies in the indexer.
+func (s *privateLinkConnectionPolicyLister) List(selector labels.Selector) (ret []*v1alpha1.PrivateLinkConnectionPolicy, err error) {
+	err = cache.ListAll(s.indexer, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1alpha1.PrivateLinkConnectionPolicy))
+	})
+	return ret, err
+}
+
+// PrivateLinkConnectionPolicies returns an object that can list and get PrivateLinkConnectionPolicies.
+func (s *privateLinkConnectionPolicyLister) PrivateLinkConnectionPolicies(namespace string) PrivateLinkConnectionPolicyNamespaceLister {
+	return privateLinkConnectionPolicyNamespaceLister{indexer: s.indexer, namespace: namespace}
+}
+
+// PrivateLinkConnectionPolicyNamespaceLister helps list and get PrivateLinkConnectionPolicies.
+// All objects returned here must be treated as read-only.
+type PrivateLinkConnectionPolicyNamespaceLister interface {
+	// List lists all PrivateLinkConnectionPolicies in the indexer for a given namespace.
+	// Objects returned here must be treated as read-only.
+	List(selector labels.Selector) (ret []*v1alpha1.PrivateLinkConnectionPolicy, err error)
+	// Get retrieves the PrivateLinkConnectionPolicy from the indexer for a given namespace and name.
+	// Objects returned here must be treated as read-only.
+	Get(name string) (*v1alpha1.PrivateLinkConnectionPolicy, error)
+	PrivateLinkConnectionPolicyNamespaceListerExpansion
+}
+
+// privateLinkConnectionPolicyNamespaceLister implements the PrivateLinkConnectionPolicyNamespaceLister
+// interface.
+type privateLinkConnectionPolicyNamespaceLister struct {
+	indexer   cache.Indexer
+	namespace string
+}
+
+// List lists all PrivateLinkConnectionPolicies in the indexer for a given namespace.
+func (s privateLinkConnectionPolicyNamespaceLister) List(selector labels.Selector) (ret []*v1alpha1.PrivateLinkConnectionPolicy, err error) {
+	err = cache.ListAllByNamespace(s.indexer, s.namespace, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1alpha1.PrivateLinkConnectionPolicy))
+	})
+	return ret, err
+}
+
+// Get retrieves the PrivateLinkConnectionPolicy from the indexer for a given namespace and name.
+func (s privateLinkConnectionPolicyNamespaceLister) Get(name string) (*v1alpha1.PrivateLinkConnectionPolicy, error) {
+	obj, exists, err := s.indexer.GetByKey(s.namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(v1alpha1.Resource("privatelinkconnectionpolicy"), name)
+	}
+	return obj.(*v1alpha1.PrivateLinkConnectionPolicy), nil
+}
@@ -0,0 +1,76 @@
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/garvinmsft/auto-private-link/pkg/azure"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+// Checker answers the liveness and readiness probes of the controller
+type Checker struct {
+	azContext azure.AzContext
+	armMaxAge time.Duration
+	synced    []cache.InformerSynced
+}
+
+// New returns a checker that is ready once every informer has synced and ARM
+// accepted a request within armMaxAge
+func New(azCtx azure.AzContext, armMaxAge time.Duration, synced ...cache.InformerSynced) *Checker {
+	return &Checker{
+		azContext: azCtx,
+		armMaxAge: armMaxAge,
+		synced:    synced,
+	}
+}
+
+// Handler serves /healthz, /readyz and, when enablePprof is set, /debug/pprof
+func (c *Checker) Handler(enablePprof bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", c.healthz)
+	mux.HandleFunc("/readyz", c.readyz)
+
+	if enablePprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+
+	return mux
+}
+
+// Ready returns an error describing why the controller is not ready
+func (c *Checker) Ready() error {
+	for _, synced := range c.synced {
+		if !synced() {
+			return fmt.Errorf("informer caches have not synced")
+		}
+	}
+
+	if err := c.azContext.Ping(c.armMaxAge); err != nil {
+		return fmt.Errorf("no successful ARM request in the last %v: %v", c.armMaxAge, err)
+	}
+
+	return nil
+}
+
+//healthz only shows the process is serving requests
+func (c *Checker) healthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "ok")
+}
+
+func (c *Checker) readyz(w http.ResponseWriter, r *http.Request) {
+	if err := c.Ready(); err != nil {
+		klog.V(3).Infof("Readiness check failed: %v", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Fprint(w, "ok")
+}
@@ -0,0 +1,178 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "apl"
+
+	//ResultSuccess is the outcome of a reconcile that returned no error
+	ResultSuccess = "success"
+
+	//ResultError is the outcome of a reconcile that returned an error and will be retried
+	ResultError = "error"
+)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Time taken to reconcile one object, by controller",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 15),
+	}, []string{"controller"})
+
+	reconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_total",
+		Help:      "Number of reconciles, by controller and result",
+	}, []string{"controller", "result"})
+
+	armRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "arm_request_duration_seconds",
+		Help:      "Latency of ARM requests, by resource type and operation",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"resource", "operation"})
+
+	armRequestTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "arm_requests_total",
+		Help:      "Number of ARM requests, by resource type, operation and HTTP status code. The code is empty when no response was received",
+	}, []string{"resource", "operation", "code"})
+
+	privateLinkServices = newStateGauge("private_link_services", "Number of managed private link services, by provisioning state")
+
+	privateEndpoints = newStateGauge("private_endpoints", "Number of managed private endpoints, by connection state")
+
+	natSubnetAddresses = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "nat_subnet_addresses",
+		Help:      "Number of usable addresses of a NAT subnet, by subnet ID",
+	}, []string{"subnet"})
+
+	natSubnetUsedAddresses = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "nat_subnet_used_addresses",
+		Help:      "Number of addresses of a NAT subnet held by ip configurations, by subnet ID",
+	}, []string{"subnet"})
+)
+
+func init() {
+	registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		reconcileDuration,
+		reconcileTotal,
+		armRequestDuration,
+		armRequestTotal,
+		privateLinkServices.gauge,
+		privateEndpoints.gauge,
+		natSubnetAddresses,
+		natSubnetUsedAddresses,
+	)
+}
+
+//Handler serves the metrics in the prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+//ObserveReconcile records the duration and outcome of a reconcile started at start
+func ObserveReconcile(controller string, start time.Time, err error) {
+	result := ResultSuccess
+	if err != nil {
+		result = ResultError
+	}
+
+	reconcileDuration.WithLabelValues(controller).Observe(time.Since(start).Seconds())
+	reconcileTotal.WithLabelValues(controller, result).Inc()
+}
+
+//ObserveARMRequest records an ARM request. A status code of 0 means no response was received.
+func ObserveARMRequest(resource string, operation string, statusCode int, duration time.Duration) {
+	code := ""
+	if statusCode != 0 {
+		code = strconv.Itoa(statusCode)
+	}
+
+	armRequestDuration.WithLabelValues(resource, operation).Observe(duration.Seconds())
+	armRequestTotal.WithLabelValues(resource, operation, code).Inc()
+}
+
+//SetPrivateLinkServiceState records the state of the private link service of the service with the given key
+func SetPrivateLinkServiceState(key string, state string) {
+	privateLinkServices.set(key, state)
+}
+
+//ForgetPrivateLinkService stops counting the private link service of the service with the given key
+func ForgetPrivateLinkService(key string) {
+	privateLinkServices.forget(key)
+}
+
+//SetPrivateEndpointState records the state of the private endpoint of the connection with the given key
+func SetPrivateEndpointState(key string, state string) {
+	privateEndpoints.set(key, state)
+}
+
+//ForgetPrivateEndpoint stops counting the private endpoint of the connection with the given key
+func ForgetPrivateEndpoint(key string) {
+	privateEndpoints.forget(key)
+}
+
+//SetNatSubnetCapacity records the usable and used addresses of the NAT subnet with the given name
+func SetNatSubnetCapacity(subnet string, usable int, used int) {
+	natSubnetAddresses.WithLabelValues(subnet).Set(float64(usable))
+	natSubnetUsedAddresses.WithLabelValues(subnet).Set(float64(used))
+}
+
+//stateGauge counts objects by their last known state
+type stateGauge struct {
+	mu     sync.Mutex
+	states map[string]string
+	gauge  *prometheus.GaugeVec
+}
+
+func newStateGauge(name string, help string) *stateGauge {
+	return &stateGauge{
+		states: map[string]string{},
+		gauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      name,
+			Help:      help,
+		}, []string{"state"}),
+	}
+}
+
+func (g *stateGauge) set(key string, state string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if old, ok := g.states[key]; ok {
+		if old == state {
+			return
+		}
+		g.gauge.WithLabelValues(old).Dec()
+	}
+
+	g.states[key] = state
+	g.gauge.WithLabelValues(state).Inc()
+}
+
+func (g *stateGauge) forget(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if old, ok := g.states[key]; ok {
+		g.gauge.WithLabelValues(old).Dec()
+		delete(g.states, key)
+	}
+}